@@ -0,0 +1,236 @@
+// Package abi encodes Ethereum contract calls, e.g. for the data field of
+// complex transactions. It supports the elementary Solidity types and arrays
+// of them; tuples are not supported.
+//
+// Usage:
+//
+//	data, err := abi.EncodeCall("transfer(address,uint256)", recipient, amount)
+//	tx := upvest.NewEthereumTx(tokenContract).WithData(data)
+package abi
+
+import (
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/upvestco/upvest-go"
+	"github.com/upvestco/upvest-go/internal/ethenc"
+)
+
+// signaturePattern matches a function signature such as "transfer(address,uint256)".
+var signaturePattern = regexp.MustCompile(`^([A-Za-z_$][A-Za-z0-9_$]*)\((.*)\)$`)
+
+// arrayPattern matches the outermost array suffix of a type.
+var arrayPattern = regexp.MustCompile(`^(.+)\[(\d*)\]$`)
+
+// Selector returns the 4 byte function selector of a signature
+func Selector(signature string) []byte {
+	return upvest.Keccak256([]byte(signature))[:4]
+}
+
+// EncodeCall returns the call data of a function: its selector followed by
+// the encoded arguments. The signature is canonical, without spaces or
+// argument names, e.g. "transferFrom(address,address,uint256)".
+func EncodeCall(signature string, args ...interface{}) ([]byte, error) {
+	m := signaturePattern.FindStringSubmatch(signature)
+	if m == nil {
+		return nil, fmt.Errorf("invalid function signature %q", signature)
+	}
+	var types []string
+	if m[2] != "" {
+		types = strings.Split(m[2], ",")
+	}
+	data, err := Encode(types, args...)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", m[1], err)
+	}
+	return append(Selector(signature), data...), nil
+}
+
+// Encode returns the ABI encoding of values of types. Values may be:
+//
+//   - address: a hex string or a [20]byte
+//   - uintN, intN: an int, int64, uint64, *big.Int, upvest.Amount in minor
+//     units, json.Number or decimal or 0x prefixed hex string
+//   - bool: a bool
+//   - bytesN, bytes: a []byte or a 0x prefixed hex string
+//   - string: a string
+//   - arrays: a slice or array of values of the element type
+func Encode(types []string, values ...interface{}) ([]byte, error) {
+	if len(types) != len(values) {
+		return nil, fmt.Errorf("expected %d arguments, got %d", len(types), len(values))
+	}
+	for i, typ := range types {
+		if strings.ContainsAny(typ, "() ") {
+			return nil, fmt.Errorf("unsupported type %q", typ)
+		}
+		if _, err := isDynamic(typ); err != nil {
+			return nil, fmt.Errorf("argument %d: %w", i, err)
+		}
+	}
+	return encodeTuple(types, values)
+}
+
+// encodeTuple encodes values as a sequence of heads, followed by the tails
+// of the dynamic values the heads point to.
+func encodeTuple(types []string, values []interface{}) ([]byte, error) {
+	var heads, tails [][]byte
+	headSize := 0
+	for i, typ := range types {
+		enc, err := encodeValue(typ, values[i])
+		if err != nil {
+			return nil, fmt.Errorf("argument %d: %w", i, err)
+		}
+		dynamic, _ := isDynamic(typ)
+		if dynamic {
+			heads = append(heads, nil)
+			tails = append(tails, enc)
+			headSize += 32
+		} else {
+			heads = append(heads, enc)
+			tails = append(tails, nil)
+			headSize += len(enc)
+		}
+	}
+	var out, tail []byte
+	for i, head := range heads {
+		if head == nil {
+			head = ethenc.Word(big.NewInt(int64(headSize + len(tail))))
+			tail = append(tail, tails[i]...)
+		}
+		out = append(out, head...)
+	}
+	return append(out, tail...), nil
+}
+
+// isDynamic reports whether values of a type are encoded in the tail.
+func isDynamic(typ string) (bool, error) {
+	if m := arrayPattern.FindStringSubmatch(typ); m != nil {
+		if m[2] == "" {
+			if _, err := isDynamic(m[1]); err != nil {
+				return false, err
+			}
+			return true, nil
+		}
+		return isDynamic(m[1])
+	}
+	switch {
+	case typ == "bytes" || typ == "string":
+		return true, nil
+	case typ == "address" || typ == "bool":
+		return false, nil
+	case strings.HasPrefix(typ, "bytes"):
+		n, err := strconv.Atoi(typ[len("bytes"):])
+		if err != nil || n < 1 || n > 32 {
+			return false, fmt.Errorf("unknown type %q", typ)
+		}
+		return false, nil
+	case strings.HasPrefix(typ, "uint") || strings.HasPrefix(typ, "int"):
+		if _, err := ethenc.IntSize(typ); err != nil {
+			return false, err
+		}
+		return false, nil
+	}
+	return false, fmt.Errorf("unknown type %q", typ)
+}
+
+// encodeValue encodes a value of a type.
+func encodeValue(typ string, v interface{}) ([]byte, error) {
+	if m := arrayPattern.FindStringSubmatch(typ); m != nil {
+		items := reflect.ValueOf(v)
+		if items.Kind() != reflect.Slice && items.Kind() != reflect.Array {
+			return nil, fmt.Errorf("%v is not an array", v)
+		}
+		if m[2] != "" {
+			if n, _ := strconv.Atoi(m[2]); n != items.Len() {
+				return nil, fmt.Errorf("expected %d items, got %d", n, items.Len())
+			}
+		}
+		types := make([]string, items.Len())
+		values := make([]interface{}, items.Len())
+		for i := range types {
+			types[i] = m[1]
+			values[i] = items.Index(i).Interface()
+		}
+		enc, err := encodeTuple(types, values)
+		if err != nil {
+			return nil, err
+		}
+		if m[2] == "" {
+			enc = append(ethenc.Word(big.NewInt(int64(items.Len()))), enc...)
+		}
+		return enc, nil
+	}
+
+	switch {
+	case typ == "address":
+		b, err := address(v)
+		if err != nil {
+			return nil, err
+		}
+		return append(make([]byte, 12), b...), nil
+	case typ == "bool":
+		b, ok := v.(bool)
+		if !ok {
+			return nil, fmt.Errorf("%v is not a bool", v)
+		}
+		if b {
+			return ethenc.Word(big.NewInt(1)), nil
+		}
+		return ethenc.Word(new(big.Int)), nil
+	case typ == "string":
+		s, ok := v.(string)
+		if !ok {
+			return nil, fmt.Errorf("%v is not a string", v)
+		}
+		return encodeBytes([]byte(s)), nil
+	case typ == "bytes":
+		b, err := ethenc.Bytes(v)
+		if err != nil {
+			return nil, err
+		}
+		return encodeBytes(b), nil
+	case strings.HasPrefix(typ, "bytes"):
+		n, _ := strconv.Atoi(typ[len("bytes"):])
+		b, err := ethenc.Bytes(v)
+		if err != nil {
+			return nil, err
+		}
+		if len(b) != n {
+			return nil, fmt.Errorf("expected %d bytes, got %d", n, len(b))
+		}
+		return padRight(b), nil
+	default:
+		return ethenc.EncodeInt(typ, v)
+	}
+}
+
+// encodeBytes encodes dynamic bytes: their length followed by the padded bytes.
+func encodeBytes(b []byte) []byte {
+	return append(ethenc.Word(big.NewInt(int64(len(b)))), padRight(b)...)
+}
+
+// padRight pads b with zeros to a multiple of 32 bytes.
+func padRight(b []byte) []byte {
+	out := make([]byte, (len(b)+31)/32*32)
+	copy(out, b)
+	return out
+}
+
+// address converts a hex string or a [20]byte to an address.
+func address(v interface{}) ([]byte, error) {
+	switch v := v.(type) {
+	case [20]byte:
+		return v[:], nil
+	case string:
+		if err := upvest.ValidateEthereumAddress(v); err != nil {
+			return nil, err
+		}
+		return hex.DecodeString(v[2:])
+	}
+	return nil, fmt.Errorf("%v is not an address", v)
+}
@@ -0,0 +1,110 @@
+package abi_test
+
+import (
+	"encoding/hex"
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/upvestco/upvest-go"
+	"github.com/upvestco/upvest-go/abi"
+)
+
+func TestSelector(t *testing.T) {
+	cases := map[string]string{
+		abi.ERC20TransferSignature:              "a9059cbb",
+		abi.ERC20ApproveSignature:               "095ea7b3",
+		abi.ERC20TransferFromSignature:          "23b872dd",
+		abi.ERC721SafeTransferFromSignature:     "42842e0e",
+		abi.ERC721SafeTransferFromDataSignature: "b88d4fde",
+		abi.ERC721SetApprovalForAllSignature:    "a22cb465",
+	}
+	for signature, want := range cases {
+		if got := hex.EncodeToString(abi.Selector(signature)); got != want {
+			t.Errorf("Selector(%s) = %s, want %s", signature, got, want)
+		}
+	}
+}
+
+func TestEncodeCall(t *testing.T) {
+	// the example of the Solidity ABI specification
+	data, err := abi.EncodeCall("f(uint256,uint32[],bytes10,bytes)",
+		0x123, []int{0x456, 0x789}, []byte("1234567890"), []byte("Hello, world!"))
+	if err != nil {
+		t.Fatalf("EncodeCall returned error: %v", err)
+	}
+	want := "8be65246" +
+		"0000000000000000000000000000000000000000000000000000000000000123" +
+		"0000000000000000000000000000000000000000000000000000000000000080" +
+		"3132333435363738393000000000000000000000000000000000000000000000" +
+		"00000000000000000000000000000000000000000000000000000000000000e0" +
+		"0000000000000000000000000000000000000000000000000000000000000002" +
+		"0000000000000000000000000000000000000000000000000000000000000456" +
+		"0000000000000000000000000000000000000000000000000000000000000789" +
+		"000000000000000000000000000000000000000000000000000000000000000d" +
+		"48656c6c6f2c20776f726c642100000000000000000000000000000000000000"
+	if got := hex.EncodeToString(data); got != want {
+		t.Errorf("Unexpected encoding\n got %s\nwant %s", got, want)
+	}
+
+	// nested dynamic values: a string[] holds offsets to its strings
+	data, err = abi.EncodeCall("g(string[])", []string{"a", "b"})
+	if err != nil {
+		t.Fatalf("EncodeCall returned error: %v", err)
+	}
+	want = "" +
+		"0000000000000000000000000000000000000000000000000000000000000020" +
+		"0000000000000000000000000000000000000000000000000000000000000002" +
+		"0000000000000000000000000000000000000000000000000000000000000040" +
+		"0000000000000000000000000000000000000000000000000000000000000080" +
+		"0000000000000000000000000000000000000000000000000000000000000001" +
+		"6100000000000000000000000000000000000000000000000000000000000000" +
+		"0000000000000000000000000000000000000000000000000000000000000001" +
+		"6200000000000000000000000000000000000000000000000000000000000000"
+	if got := hex.EncodeToString(data[4:]); got != want {
+		t.Errorf("Unexpected encoding of string[]\n got %s\nwant %s", got, want)
+	}
+
+	errCases := []struct {
+		signature string
+		args      []interface{}
+	}{
+		{"transfer(address,uint256)", []interface{}{"0x1234", 1}},
+		{"transfer(address,uint256)", []interface{}{"0xf9b44ba370cafc6a7af77d0bdb0d50106823d91b"}},
+		{"f(uint8)", []interface{}{256}},
+		{"f(int8)", []interface{}{-129}},
+		{"f(uint256)", []interface{}{-1}},
+		{"f(bytes4)", []interface{}{"0xdeadbeefff"}},
+		{"f(uint7)", []interface{}{1}},
+		{"f((uint256,bool))", []interface{}{1}},
+		{"not a signature", nil},
+	}
+	for _, c := range errCases {
+		if _, err := abi.EncodeCall(c.signature, c.args...); err == nil {
+			t.Errorf("Expected an error encoding %s with %v", c.signature, c.args)
+		}
+	}
+	if data, err := abi.EncodeCall("f(int8)", -1); err != nil || !strings.HasSuffix(hex.EncodeToString(data), strings.Repeat("f", 64)) {
+		t.Errorf("Unexpected encoding of -1: %x, %v", data, err)
+	}
+}
+
+func TestTokenTransfer(t *testing.T) {
+	token := "0x6B175474E89094C44Da98b954EedeAC495271d0F"
+	to := "0xf9b44Ba370CAfc6a7AF77D0BDB0d50106823D91b"
+	tx, err := abi.TokenTransfer(token, to, upvest.AmountFromMinor(1000, 18))
+	if err != nil {
+		t.Fatalf("TokenTransfer returned error: %v", err)
+	}
+	want := "a9059cbb" +
+		"000000000000000000000000f9b44ba370cafc6a7af77d0bdb0d50106823d91b" +
+		"00000000000000000000000000000000000000000000000000000000000003e8"
+	if tx.To != token || hex.EncodeToString(tx.Data) != want {
+		t.Errorf("Unexpected transaction to %s with data %x", tx.To, tx.Data)
+	}
+
+	data, err := abi.ERC721SafeTransferFrom(to, token, big.NewInt(1), []byte{})
+	if err != nil || hex.EncodeToString(data[:4]) != "b88d4fde" {
+		t.Errorf("Unexpected safeTransferFrom with data %x, %v", data, err)
+	}
+}
@@ -0,0 +1,92 @@
+package abi
+
+import (
+	"math/big"
+
+	"github.com/upvestco/upvest-go"
+)
+
+// Signatures of the common ERC-20 and ERC-721 methods
+const (
+	ERC20TransferSignature              = "transfer(address,uint256)"
+	ERC20ApproveSignature               = "approve(address,uint256)"
+	ERC20TransferFromSignature          = "transferFrom(address,address,uint256)"
+	ERC721TransferFromSignature         = "transferFrom(address,address,uint256)"
+	ERC721SafeTransferFromSignature     = "safeTransferFrom(address,address,uint256)"
+	ERC721SafeTransferFromDataSignature = "safeTransferFrom(address,address,uint256,bytes)"
+	ERC721ApproveSignature              = "approve(address,uint256)"
+	ERC721SetApprovalForAllSignature    = "setApprovalForAll(address,bool)"
+)
+
+// ERC20Transfer returns the call data transferring amount of a token to an address
+func ERC20Transfer(to string, amount upvest.Amount) ([]byte, error) {
+	return EncodeCall(ERC20TransferSignature, to, amount)
+}
+
+// ERC20Approve returns the call data allowing spender to transfer up to amount of a token
+func ERC20Approve(spender string, amount upvest.Amount) ([]byte, error) {
+	return EncodeCall(ERC20ApproveSignature, spender, amount)
+}
+
+// ERC20TransferFrom returns the call data transferring amount of a token
+// between two addresses, within the caller's allowance.
+func ERC20TransferFrom(from, to string, amount upvest.Amount) ([]byte, error) {
+	return EncodeCall(ERC20TransferFromSignature, from, to, amount)
+}
+
+// ERC721TransferFrom returns the call data transferring a token without
+// checking that the recipient can receive it.
+func ERC721TransferFrom(from, to string, tokenID *big.Int) ([]byte, error) {
+	return EncodeCall(ERC721TransferFromSignature, from, to, tokenID)
+}
+
+// ERC721SafeTransferFrom returns the call data transferring a token, which
+// fails if the recipient is a contract not accepting it. Data, if not nil,
+// is passed on to the recipient.
+func ERC721SafeTransferFrom(from, to string, tokenID *big.Int, data []byte) ([]byte, error) {
+	if data == nil {
+		return EncodeCall(ERC721SafeTransferFromSignature, from, to, tokenID)
+	}
+	return EncodeCall(ERC721SafeTransferFromDataSignature, from, to, tokenID, data)
+}
+
+// ERC721Approve returns the call data allowing an address to transfer a token
+func ERC721Approve(to string, tokenID *big.Int) ([]byte, error) {
+	return EncodeCall(ERC721ApproveSignature, to, tokenID)
+}
+
+// ERC721SetApprovalForAll returns the call data allowing or disallowing an
+// operator to transfer all tokens of the caller.
+func ERC721SetApprovalForAll(operator string, approved bool) ([]byte, error) {
+	return EncodeCall(ERC721SetApprovalForAllSignature, operator, approved)
+}
+
+// ContractCall returns a transaction calling a function of a contract
+func ContractCall(contract, signature string, args ...interface{}) (*upvest.EthereumTx, error) {
+	data, err := EncodeCall(signature, args...)
+	if err != nil {
+		return nil, err
+	}
+	tx := upvest.NewEthereumTx(contract).WithData(data)
+	if err := tx.Validate(); err != nil {
+		return nil, err
+	}
+	return tx, nil
+}
+
+// TokenTransfer returns a transaction transferring amount of an ERC-20 token
+// to an address.
+//
+// Usage:
+//
+//	tx, err := abi.TokenTransfer(tokenContract, recipient, amount)
+//	txn, err := clientele.Transaction.CreateEthereum(walletID, password, tx.WithGas(100000), false)
+func TokenTransfer(token, to string, amount upvest.Amount) (*upvest.EthereumTx, error) {
+	return ContractCall(token, ERC20TransferSignature, to, amount)
+}
+
+// NFTTransfer returns a transaction safely transferring an ERC-721 token of
+// a contract from one address to another.
+func NFTTransfer(contract, from, to string, tokenID *big.Int) (*upvest.EthereumTx, error) {
+	return ContractCall(contract, ERC721SafeTransferFromSignature, from, to, tokenID)
+}
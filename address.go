@@ -0,0 +1,253 @@
+package upvest
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"sync"
+)
+
+// AddressError is returned for an address which is malformed for a
+// protocol. It matches ErrValidation with errors.Is.
+type AddressError struct {
+	Protocol string
+	Address  string
+	Err      error
+}
+
+func (e *AddressError) Error() string {
+	return fmt.Sprintf("invalid %s address %q: %v", e.Protocol, e.Address, e.Err)
+}
+
+// Unwrap returns the reason the address is invalid
+func (e *AddressError) Unwrap() error {
+	return e.Err
+}
+
+// Is reports whether target is ErrValidation
+func (e *AddressError) Is(target error) bool {
+	return target == ErrValidation
+}
+
+// AddressValidator checks the format of an address of a protocol
+type AddressValidator func(address string) error
+
+var (
+	addressValidatorsMu sync.RWMutex
+	addressValidators   = map[string]AddressValidator{
+		"ethereum":         ValidateEthereumAddress,
+		"ethereum_ropsten": ValidateEthereumAddress,
+		"erc20":            ValidateEthereumAddress,
+		"erc20_ropsten":    ValidateEthereumAddress,
+		"bitcoin":          bitcoinAddressValidator("bc", 0x00, 0x05),
+		"bitcoin_testnet":  bitcoinAddressValidator("tb", 0x6f, 0xc4),
+		"arweave":          validateArweaveAddress,
+		"arweave_testnet":  validateArweaveAddress,
+	}
+)
+
+// RegisterAddressValidator sets the validator of the addresses of a
+// protocol, as named by Wallet.Protocol and Asset.Protocol, replacing any
+// built-in one. A nil validator disables validation for the protocol.
+func RegisterAddressValidator(protocol string, v AddressValidator) {
+	addressValidatorsMu.Lock()
+	defer addressValidatorsMu.Unlock()
+	if v == nil {
+		delete(addressValidators, protocol)
+		return
+	}
+	addressValidators[protocol] = v
+}
+
+// ValidateAddress checks the format of an address of a protocol, returning
+// an *AddressError if it is malformed. Addresses of protocols without a
+// validator are accepted.
+func ValidateAddress(protocol, address string) error {
+	addressValidatorsMu.RLock()
+	v, ok := addressValidators[protocol]
+	addressValidatorsMu.RUnlock()
+	if !ok {
+		return nil
+	}
+	if err := v(address); err != nil {
+		return &AddressError{Protocol: protocol, Address: address, Err: err}
+	}
+	return nil
+}
+
+// validateArweaveAddress checks that an address is the base64url encoding
+// of 32 bytes.
+func validateArweaveAddress(address string) error {
+	b, err := base64.RawURLEncoding.DecodeString(address)
+	if err != nil {
+		return errors.New("not base64url encoded")
+	}
+	if len(b) != 32 {
+		return fmt.Errorf("expected 32 bytes, got %d", len(b))
+	}
+	return nil
+}
+
+// bitcoinAddressValidator returns a validator of the base58check addresses
+// with one of versions and the segwit addresses with a human-readable part.
+func bitcoinAddressValidator(hrp string, versions ...byte) AddressValidator {
+	return func(address string) error {
+		if strings.HasPrefix(strings.ToLower(address), hrp+"1") {
+			return validateSegwitAddress(hrp, address)
+		}
+		payload, err := base58CheckDecode(address)
+		if err != nil {
+			return err
+		}
+		if len(payload) != 21 || bytes.IndexByte(versions, payload[0]) < 0 {
+			return errors.New("unknown address version")
+		}
+		return nil
+	}
+}
+
+const base58Alphabet = "123456789ABCDEFGHJKLMNPQRSTUVWXYZabcdefghijkmnopqrstuvwxyz"
+
+// base58CheckDecode decodes a base58 string and verifies its checksum, the
+// first 4 bytes of the double SHA-256 of the payload.
+func base58CheckDecode(s string) ([]byte, error) {
+	n := new(big.Int)
+	radix := big.NewInt(58)
+	for _, c := range s {
+		i := strings.IndexRune(base58Alphabet, c)
+		if i < 0 {
+			return nil, fmt.Errorf("invalid base58 character %q", c)
+		}
+		n.Mul(n, radix)
+		n.Add(n, big.NewInt(int64(i)))
+	}
+	zeros := len(s) - len(strings.TrimLeft(s, "1"))
+	b := append(make([]byte, zeros), n.Bytes()...)
+	if len(b) < 5 {
+		return nil, errors.New("too short")
+	}
+	payload, checksum := b[:len(b)-4], b[len(b)-4:]
+	first := sha256.Sum256(payload)
+	second := sha256.Sum256(first[:])
+	if !bytes.Equal(second[:4], checksum) {
+		return nil, errors.New("checksum mismatch")
+	}
+	return payload, nil
+}
+
+const bech32Charset = "qpzry9x8gf2tvdw0s3jn54khce6mua7l"
+
+// Checksum constants of bech32 (BIP-173) and bech32m (BIP-350)
+const (
+	bech32Const  = 1
+	bech32mConst = 0x2bc830a3
+)
+
+// bech32Polymod computes the bech32 checksum of values.
+func bech32Polymod(values []byte) uint32 {
+	generator := [5]uint32{0x3b6a57b2, 0x26508e6d, 0x1ea119fa, 0x3d4233dd, 0x2a1462b3}
+	chk := uint32(1)
+	for _, v := range values {
+		top := chk >> 25
+		chk = (chk&0x1ffffff)<<5 ^ uint32(v)
+		for i := 0; i < 5; i++ {
+			if (top>>uint(i))&1 == 1 {
+				chk ^= generator[i]
+			}
+		}
+	}
+	return chk
+}
+
+// validateSegwitAddress checks a segwit address: its bech32 checksum, which
+// is bech32m from witness version 1 on, and the witness program length.
+func validateSegwitAddress(hrp, address string) error {
+	if address != strings.ToLower(address) && address != strings.ToUpper(address) {
+		return errors.New("mixed case")
+	}
+	address = strings.ToLower(address)
+	if len(address) > 90 {
+		return errors.New("too long")
+	}
+	data := address[len(hrp)+1:]
+	if len(data) < 7 {
+		return errors.New("too short")
+	}
+	values := make([]byte, 0, 2*len(hrp)+1+len(data))
+	for _, c := range hrp {
+		values = append(values, byte(c)>>5)
+	}
+	values = append(values, 0)
+	for _, c := range hrp {
+		values = append(values, byte(c)&31)
+	}
+	words := make([]byte, len(data))
+	for i, c := range data {
+		v := strings.IndexRune(bech32Charset, c)
+		if v < 0 {
+			return fmt.Errorf("invalid bech32 character %q", c)
+		}
+		words[i] = byte(v)
+	}
+	version := words[0]
+	want := uint32(bech32Const)
+	if version > 0 {
+		want = bech32mConst
+	}
+	if bech32Polymod(append(values, words...)) != want {
+		return errors.New("checksum mismatch")
+	}
+	if version > 16 {
+		return fmt.Errorf("unknown witness version %d", version)
+	}
+
+	// regroup the 5 bit words of the program into bytes
+	var program []byte
+	acc, bits := 0, uint(0)
+	for _, w := range words[1 : len(words)-6] {
+		acc = acc<<5 | int(w)
+		bits += 5
+		if bits >= 8 {
+			bits -= 8
+			program = append(program, byte(acc>>bits))
+		}
+	}
+	if bits >= 5 || acc&(1<<bits-1) != 0 {
+		return errors.New("invalid padding")
+	}
+	if len(program) < 2 || len(program) > 40 || version == 0 && len(program) != 20 && len(program) != 32 {
+		return fmt.Errorf("invalid witness program length %d", len(program))
+	}
+	return nil
+}
+
+// walletProtocol returns the protocol of a wallet, fetching it once per wallet.
+func (s *TransactionService) walletProtocol(ctx context.Context, walletID string) (string, error) {
+	if protocol, ok := s.client.walletProtocols.Load(walletID); ok {
+		return protocol.(string), nil
+	}
+	wallet, err := (&WalletService{s.service}).GetContext(ctx, walletID)
+	if err != nil {
+		return "", err
+	}
+	s.client.walletProtocols.Store(walletID, wallet.Protocol)
+	return wallet.Protocol, nil
+}
+
+// validateRecipient checks a recipient address against the protocol of the
+// sending wallet, unless the client skips address validation.
+func (s *TransactionService) validateRecipient(ctx context.Context, walletID, recipient string) error {
+	if s.client.SkipAddressValidation {
+		return nil
+	}
+	protocol, err := s.walletProtocol(ctx, walletID)
+	if err != nil {
+		return err
+	}
+	return ValidateAddress(protocol, recipient)
+}
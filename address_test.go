@@ -0,0 +1,64 @@
+package upvest
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestValidateAddress(t *testing.T) {
+	tests := []struct {
+		protocol, address string
+		valid             bool
+	}{
+		{"ethereum", "0xf9b44Ba370CAfc6a7AF77D0BDB0d50106823D91b", true},
+		{"ethereum_ropsten", "0xf9b44ba370cafc6a7af77d0bdb0d50106823d91b", true},
+		{"ethereum", "0xf9b44Ba370CAfc6a7AF77D0BDB0d50106823D91B", false},
+		{"erc20", "f9b44ba370cafc6a7af77d0bdb0d50106823d91b", false},
+		{"bitcoin", "1A1zP1eP5QGefi2DMPTfTL5SLmv7DivfNa", true},
+		{"bitcoin", "3J98t1WpEZ73CNmQviecrnyiWrnqRhWNLy", true},
+		{"bitcoin", "1A1zP1eP5QGefi2DMPTfTL5SLmv7DivfNb", false},
+		{"bitcoin", "1A1zP1eP5QGefi2DMPTfTL5SLmv7Divf0a", false},
+		{"bitcoin_testnet", "1A1zP1eP5QGefi2DMPTfTL5SLmv7DivfNa", false},
+		{"bitcoin_testnet", "mipcBbFg9gMiCh81Kj8tqqdgoZub1ZJRfn", true},
+		{"bitcoin", "bc1qw508d6qejxtdg4y5r3zarvary0c5xw7kv8f3t4", true},
+		{"bitcoin", "BC1QW508D6QEJXTDG4Y5R3ZARVARY0C5XW7KV8F3T4", true},
+		{"bitcoin", "bc1qw508d6qejxtdg4y5r3zarvary0c5xw7kv8f3t5", false},
+		{"bitcoin", "bc1Qw508d6qejxtdg4y5r3zarvary0c5xw7kv8f3t4", false},
+		{"bitcoin", "bc1p0xlxvlhemja6c4dqv22uapctqupfhlxm9h8z3k2e72q4k9hcz7vqzk5jj0", true},
+		{"bitcoin_testnet", "tb1qw508d6qejxtdg4y5r3zarvary0c5xw7kxpjzsx", true},
+		{"bitcoin_testnet", "bc1qw508d6qejxtdg4y5r3zarvary0c5xw7kv8f3t4", false},
+		{"arweave", "bNbA3TEQVL60xlgCcqdz4ZPHFZ711cZ3hmkpGttDt_U", true},
+		{"arweave", "bNbA3TEQVL60xlgCcqdz4ZPHFZ711cZ3hmkpGttDt_", false},
+		{"arweave_testnet", "bNbA3TEQVL60xlgCcqdz4ZPHFZ711cZ3hmkpGttDt+U", false},
+		{"unknown", "anything", true},
+	}
+	for _, tt := range tests {
+		err := ValidateAddress(tt.protocol, tt.address)
+		if tt.valid && err != nil {
+			t.Errorf("ValidateAddress(%s, %s) returned error: %v", tt.protocol, tt.address, err)
+		}
+		if !tt.valid {
+			var addrErr *AddressError
+			if !errors.As(err, &addrErr) || !errors.Is(err, ErrValidation) {
+				t.Errorf("ValidateAddress(%s, %s) = %v, want an *AddressError", tt.protocol, tt.address, err)
+			}
+		}
+	}
+}
+
+func TestRegisterAddressValidator(t *testing.T) {
+	RegisterAddressValidator("dummy", func(address string) error {
+		if address != "ok" {
+			return errors.New("not ok")
+		}
+		return nil
+	})
+	defer RegisterAddressValidator("dummy", nil)
+
+	if err := ValidateAddress("dummy", "ok"); err != nil {
+		t.Errorf("ValidateAddress returned error: %v", err)
+	}
+	if err := ValidateAddress("dummy", "ko"); err == nil || err.Error() != `invalid dummy address "ko": not ok` {
+		t.Errorf("Unexpected error %v", err)
+	}
+}
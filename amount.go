@@ -0,0 +1,279 @@
+package upvest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"reflect"
+	"regexp"
+	"strings"
+)
+
+// Amount is a quantity of an asset. It is kept in the minor units of the
+// asset, e.g. wei for Ether, together with the asset's exponent, the number
+// of decimal places of its major unit, so that it neither overflows nor
+// loses precision. The zero value is an amount of 0 with exponent 0.
+//
+// Amounts are immutable; arithmetic returns new amounts.
+//
+// Usage:
+//
+//	quantity, err := upvest.ParseAmount("0.5", 18) // 0.5 ETH
+//	fmt.Println(quantity.MinorString())            // 500000000000000000
+type Amount struct {
+	minor    *big.Int
+	exponent int
+}
+
+// decimalPattern matches the decimal strings ParseAmount accepts.
+var decimalPattern = regexp.MustCompile(`^[+-]?([0-9]+\.?[0-9]*|\.[0-9]+)$`)
+
+// NewAmount returns an amount of minor units of an asset with exponent
+func NewAmount(minor *big.Int, exponent int) Amount {
+	return Amount{minor: new(big.Int).Set(minor), exponent: exponent}
+}
+
+// AmountFromMinor returns an amount of minor units of an asset with exponent
+func AmountFromMinor(minor int64, exponent int) Amount {
+	return Amount{minor: big.NewInt(minor), exponent: exponent}
+}
+
+// ParseAmount parses a decimal string in major units, e.g. "1.25", into an
+// amount of an asset with exponent. It fails if s has more decimal places
+// than the exponent allows.
+func ParseAmount(s string, exponent int) (Amount, error) {
+	if exponent < 0 {
+		return Amount{}, fmt.Errorf("invalid exponent %d", exponent)
+	}
+	digits := strings.TrimSpace(s)
+	if !decimalPattern.MatchString(digits) {
+		return Amount{}, fmt.Errorf("invalid amount %q", s)
+	}
+	if i := strings.IndexByte(digits, '.'); i >= 0 {
+		decimals := strings.TrimRight(digits[i+1:], "0")
+		if len(decimals) > exponent {
+			return Amount{}, fmt.Errorf("amount %q has more than %d decimal places", s, exponent)
+		}
+		digits = digits[:i] + decimals + strings.Repeat("0", exponent-len(decimals))
+	} else {
+		digits += strings.Repeat("0", exponent)
+	}
+	minor, ok := new(big.Int).SetString(digits, 10)
+	if !ok {
+		return Amount{}, fmt.Errorf("invalid amount %q", s)
+	}
+	return Amount{minor: minor, exponent: exponent}, nil
+}
+
+// ParseMinorAmount parses an integer string of minor units, e.g. "1250000",
+// into an amount of an asset with exponent.
+func ParseMinorAmount(s string, exponent int) (Amount, error) {
+	minor, ok := new(big.Int).SetString(strings.TrimSpace(s), 10)
+	if !ok {
+		return Amount{}, fmt.Errorf("invalid amount %q", s)
+	}
+	return Amount{minor: minor, exponent: exponent}, nil
+}
+
+// int returns the minor units of a, treating a nil value as 0.
+func (a Amount) int() *big.Int {
+	if a.minor == nil {
+		return new(big.Int)
+	}
+	return a.minor
+}
+
+// Minor returns the amount in minor units
+func (a Amount) Minor() *big.Int {
+	return new(big.Int).Set(a.int())
+}
+
+// Exponent returns the number of decimal places of the asset's major unit
+func (a Amount) Exponent() int {
+	return a.exponent
+}
+
+// WithExponent returns the same number of minor units of an asset with
+// another exponent.
+func (a Amount) WithExponent(exponent int) Amount {
+	return Amount{minor: a.Minor(), exponent: exponent}
+}
+
+// rescale returns the minor units of a in an asset with a larger exponent.
+func (a Amount) rescale(exponent int) *big.Int {
+	if exponent == a.exponent {
+		return a.int()
+	}
+	scale := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(exponent-a.exponent)), nil)
+	return scale.Mul(scale, a.int())
+}
+
+// align returns the minor units of a and b in the larger of their exponents.
+func align(a, b Amount) (x, y *big.Int, exponent int) {
+	exponent = a.exponent
+	if b.exponent > exponent {
+		exponent = b.exponent
+	}
+	return a.rescale(exponent), b.rescale(exponent), exponent
+}
+
+// Add returns a+b in the larger of their exponents
+func (a Amount) Add(b Amount) Amount {
+	x, y, exponent := align(a, b)
+	return Amount{minor: new(big.Int).Add(x, y), exponent: exponent}
+}
+
+// Sub returns a-b in the larger of their exponents
+func (a Amount) Sub(b Amount) Amount {
+	x, y, exponent := align(a, b)
+	return Amount{minor: new(big.Int).Sub(x, y), exponent: exponent}
+}
+
+// Cmp compares the values of a and b, returning -1, 0 or +1
+func (a Amount) Cmp(b Amount) int {
+	x, y, _ := align(a, b)
+	return x.Cmp(y)
+}
+
+// Sign returns -1, 0 or +1 depending on the sign of a
+func (a Amount) Sign() int {
+	return a.int().Sign()
+}
+
+// IsZero reports whether a is 0
+func (a Amount) IsZero() bool {
+	return a.Sign() == 0
+}
+
+// String formats the amount in major units, without trailing zeros, e.g. "1.25"
+func (a Amount) String() string {
+	digits := new(big.Int).Abs(a.int()).String()
+	sign := ""
+	if a.Sign() < 0 {
+		sign = "-"
+	}
+	if a.exponent <= 0 {
+		return sign + digits
+	}
+	if len(digits) <= a.exponent {
+		digits = strings.Repeat("0", a.exponent-len(digits)+1) + digits
+	}
+	whole, decimals := digits[:len(digits)-a.exponent], strings.TrimRight(digits[len(digits)-a.exponent:], "0")
+	if decimals == "" {
+		return sign + whole
+	}
+	return sign + whole + "." + decimals
+}
+
+// MinorString formats the amount in minor units, e.g. "1250000"
+func (a Amount) MinorString() string {
+	return a.int().String()
+}
+
+// MarshalJSON encodes the amount as a JSON number of minor units, the form
+// the Upvest API expects. It is meant for the wire only: the exponent is not
+// encoded, so an amount decoded from the JSON has to get it from elsewhere.
+func (a Amount) MarshalJSON() ([]byte, error) {
+	return []byte(a.MinorString()), nil
+}
+
+// UnmarshalJSON decodes a JSON number or string of minor units. The exponent
+// is left unchanged. A null decodes to the zero amount, as the API reports
+// fees which are not known yet.
+func (a *Amount) UnmarshalJSON(data []byte) error {
+	if string(bytes.TrimSpace(data)) == "null" {
+		*a = Amount{exponent: a.exponent}
+		return nil
+	}
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		s = string(data)
+	}
+	minor, err := ParseMinorAmount(s, a.exponent)
+	if err != nil {
+		return err
+	}
+	*a = minor
+	return nil
+}
+
+// amountType is the type decodeAmount converts to.
+var amountType = reflect.TypeOf(Amount{})
+
+// amountExponents maps the structs with amount fields to the field holding
+// the exponent of their amounts. The fee of a transaction is paid in the
+// protocol's native asset rather than the transaction's asset, so its
+// exponent is not known.
+var amountExponents = map[reflect.Type]struct {
+	exponent string
+	amounts  []string
+}{
+	reflect.TypeOf(Balance{}):     {"exponent", []string{"amount"}},
+	reflect.TypeOf(Transaction{}): {"exponent", []string{"quantity"}},
+}
+
+// decodeAmount is a mapstructure decode hook which decodes amounts of minor
+// units given as JSON numbers or strings. Amounts of the structs listed in
+// amountExponents get the exponent of their struct.
+func decodeAmount(from, to reflect.Type, data interface{}) (interface{}, error) {
+	if fields, ok := amountExponents[to]; ok {
+		m, ok := data.(map[string]interface{})
+		if !ok {
+			return data, nil
+		}
+		exponent := 0
+		if v, ok := m[fields.exponent]; ok && v != nil {
+			if err := mapstruct(v, &exponent); err != nil {
+				return nil, fmt.Errorf("invalid exponent %v: %w", v, err)
+			}
+		}
+		copied := make(map[string]interface{}, len(m))
+		for k, v := range m {
+			copied[k] = v
+		}
+		for _, k := range fields.amounts {
+			if v, ok := m[k]; ok && v != nil {
+				a, err := minorAmount(v, exponent)
+				if err != nil {
+					return nil, err
+				}
+				copied[k] = a
+			}
+		}
+		return copied, nil
+	}
+
+	if to != amountType {
+		return data, nil
+	}
+	if data == nil {
+		return Amount{}, nil
+	}
+	return minorAmount(data, 0)
+}
+
+// minorAmount converts a decoded JSON value of minor units into an amount.
+func minorAmount(v interface{}, exponent int) (interface{}, error) {
+	switch v := v.(type) {
+	case Amount:
+		return v, nil
+	case json.Number:
+		return ParseMinorAmount(v.String(), exponent)
+	case string:
+		if v == "" {
+			return Amount{exponent: exponent}, nil
+		}
+		return ParseMinorAmount(v, exponent)
+	case float64:
+		if v != float64(int64(v)) {
+			return nil, fmt.Errorf("invalid amount %v", v)
+		}
+		return AmountFromMinor(int64(v), exponent), nil
+	case int:
+		return AmountFromMinor(int64(v), exponent), nil
+	case int64:
+		return AmountFromMinor(v, exponent), nil
+	}
+	return nil, fmt.Errorf("invalid amount %v", v)
+}
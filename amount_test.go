@@ -0,0 +1,132 @@
+package upvest
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestParseAmount(t *testing.T) {
+	cases := []struct {
+		in       string
+		exponent int
+		minor    string
+		display  string
+	}{
+		{"1.25", 2, "125", "1.25"},
+		{"1.5", 18, "1500000000000000000", "1.5"},
+		{"42", 18, "42000000000000000000", "42"},
+		{"0.000000000000000001", 18, "1", "0.000000000000000001"},
+		{"-0.5", 1, "-5", "-0.5"},
+		{"1.2500", 2, "125", "1.25"},
+		{"7", 0, "7", "7"},
+	}
+	for _, c := range cases {
+		a, err := ParseAmount(c.in, c.exponent)
+		if err != nil {
+			t.Errorf("ParseAmount(%q) returned error: %v", c.in, err)
+			continue
+		}
+		if a.MinorString() != c.minor || a.String() != c.display || a.Exponent() != c.exponent {
+			t.Errorf("ParseAmount(%q) = %s (%s minor), expected %s (%s minor)", c.in, a, a.MinorString(), c.display, c.minor)
+		}
+	}
+
+	for _, in := range []string{"", "-", ".", "abc", "1.234", "1.2.3", "1e5"} {
+		if _, err := ParseAmount(in, 2); err == nil {
+			t.Errorf("Expected ParseAmount(%q) to fail", in)
+		}
+	}
+}
+
+func TestAmountArithmetic(t *testing.T) {
+	eth, _ := ParseAmount("10", 18)
+	wei, _ := ParseMinorAmount("1", 18)
+	sum := eth.Add(wei)
+	if sum.String() != "10.000000000000000001" {
+		t.Errorf("Expected sum beyond int64 to keep precision, got %s", sum)
+	}
+	if sum.Sub(eth).Cmp(wei) != 0 || sum.Cmp(eth) != 1 || eth.Cmp(sum) != -1 {
+		t.Errorf("Unexpected comparison of %s and %s", sum, eth)
+	}
+
+	cents := AmountFromMinor(150, 2)
+	units := AmountFromMinor(1, 0)
+	if got := cents.Sub(units); got.String() != "0.5" || got.Exponent() != 2 {
+		t.Errorf("Expected amounts of different exponents to be aligned, got %s", got)
+	}
+	if !(Amount{}).IsZero() || (Amount{}).String() != "0" || cents.Sign() != 1 {
+		t.Error("Unexpected zero value")
+	}
+}
+
+func TestAmountJSON(t *testing.T) {
+	a, _ := ParseAmount("12.5", 18)
+	buf, err := json.Marshal(&TransactionParams{Quantity: a})
+	if err != nil {
+		t.Fatalf("Marshal returned error: %v", err)
+	}
+	var fields map[string]json.RawMessage
+	json.Unmarshal(buf, &fields)
+	if string(fields["quantity"]) != "12500000000000000000" || string(fields["fee"]) != "0" {
+		t.Errorf("Expected amounts in minor units, got %s", buf)
+	}
+
+	var b Amount
+	for _, in := range []string{`12500000000000000000`, `"12500000000000000000"`} {
+		if err := json.Unmarshal([]byte(in), &b); err != nil || b.MinorString() != "12500000000000000000" {
+			t.Errorf("Unmarshal(%s) = %s, %v", in, b.MinorString(), err)
+		}
+	}
+	var txn TransactionParams
+	if err := json.Unmarshal([]byte(`{"quantity": "1", "fee": null}`), &txn); err != nil || !txn.Fee.IsZero() {
+		t.Errorf("Expected a null fee to decode as zero, got %s, %v", txn.Fee.MinorString(), err)
+	}
+}
+
+func TestDecodeAmounts(t *testing.T) {
+	wallet := &Wallet{}
+	err := mapstruct(map[string]interface{}{
+		"balances": []interface{}{
+			map[string]interface{}{"amount": json.Number("12500000000000000000"), "exponent": json.Number("18")},
+		},
+	}, wallet)
+	if err != nil {
+		t.Fatalf("mapstruct returned error: %v", err)
+	}
+	if b := wallet.Balances[0].Amount; b.String() != "12.5" || b.Exponent() != 18 {
+		t.Errorf("Expected balance of 12.5 with exponent 18, got %s with %d", b, b.Exponent())
+	}
+
+	txn := &Transaction{}
+	err = mapstruct(map[string]interface{}{"quantity": "1000", "fee": "21000", "exponent": "3"}, txn)
+	if err != nil {
+		t.Fatalf("mapstruct returned error: %v", err)
+	}
+	if txn.Quantity.String() != "1" || txn.Fee.MinorString() != "21000" || txn.Exponent != 3 {
+		t.Errorf("Unexpected transaction amounts %s, %s", txn.Quantity, txn.Fee)
+	}
+}
+
+func TestDecodeUntypedNumbers(t *testing.T) {
+	asset := &Asset{}
+	err := mapstruct(map[string]interface{}{
+		"exponent": json.Number("18"),
+		"metadata": map[string]interface{}{"decimals": json.Number("18"), "limits": []interface{}{json.Number("1.5")}},
+	}, asset)
+	if err != nil {
+		t.Fatalf("mapstruct returned error: %v", err)
+	}
+	if asset.Exponent != 18 || asset.MetaData["decimals"] != float64(18) {
+		t.Errorf("Unexpected asset %+v", asset)
+	}
+	if limits := asset.MetaData["limits"].([]interface{}); limits[0] != 1.5 {
+		t.Errorf("Expected nested numbers as float64, got %T", limits[0])
+	}
+
+	// pages keep the exact numbers for the items decoded by their iterator
+	page := &listPage{}
+	page.fill(Response{"next": "", "results": []interface{}{map[string]interface{}{"quantity": json.Number("12500000000000000001")}}})
+	if q := page.Results[0].(map[string]interface{})["quantity"]; q != json.Number("12500000000000000001") {
+		t.Errorf("Expected the exact quantity, got %v", q)
+	}
+}
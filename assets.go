@@ -1,12 +1,9 @@
 package upvest
 
 import (
+	"context"
 	"fmt"
 	"net/http"
-	"net/url"
-	"strconv"
-
-	"github.com/pkg/errors"
 )
 
 // Asset is the resource representing your Upvest Tenant asset.
@@ -15,7 +12,7 @@ type Asset struct {
 	ID       string                 `json:"id"`
 	Name     string                 `json:"name"`
 	Symbol   string                 `json:"symbol"`
-	Exponent int64                  `json:"exponent"`
+	Exponent int                    `json:"exponent"`
 	Protocol string                 `json:"protocol"`
 	MetaData map[string]interface{} `json:"metadata"`
 }
@@ -35,45 +32,58 @@ type AssetList struct {
 // Get returns the details of a asset.
 // For more details see https://doc.upvest.co/reference#common_assets_read
 func (s *AssetService) Get(assetID string) (*Asset, error) {
+	return s.GetContext(context.Background(), assetID)
+}
+
+// GetContext is like Get but takes a context.
+func (s *AssetService) GetContext(ctx context.Context, assetID string) (*Asset, error) {
 	u := fmt.Sprintf("/assets/%s", assetID)
 	asset := &Asset{}
 	p := &Params{}
 	p.SetAuthProvider(s.auth)
-	err := s.client.Call(http.MethodGet, u, nil, asset, p)
+	err := s.client.CallContext(ctx, http.MethodGet, u, nil, asset, p)
 	return asset, err
 }
 
 // List returns list of all assets.
 // For more details see https://doc.upvest.co/reference#asset
 func (s *AssetService) List() (*AssetList, error) {
-	path := "/assets/"
-	u, _ := url.Parse(path)
+	return s.ListContext(context.Background())
+}
 
-	p := &Params{}
-	p.SetAuthProvider(s.auth)
+// ListContext is like List but takes a context.
+func (s *AssetService) ListContext(ctx context.Context) (*AssetList, error) {
+	return s.list(s.Iter(ctx, nil))
+}
 
-	var results []Asset
-	assets := &AssetList{}
+// AssetIter is an iterator over assets.
+type AssetIter struct {
+	*Iter
+}
 
-	for {
-		err := s.client.Call(http.MethodGet, u.String(), nil, assets, p)
-		if err != nil {
-			return nil, errors.Wrap(err, "Could not retrieve list of assets")
-		}
-		results = append(results, assets.Values...)
+// Value returns the asset at the current position
+func (it *AssetIter) Value() *Asset {
+	return it.Current().(*Asset)
+}
 
-		// append page_size param to the returned params
-		u1, err := url.Parse(assets.Meta.Next)
-		if err != nil {
-			return nil, errors.Wrap(err, "Can not parse url")
-		}
-		q := u1.Query()
-		q.Set("page_size", strconv.Itoa(MaxPageSize))
-		u.RawQuery = q.Encode()
-		if assets.Meta.Next == "" {
-			break
-		}
-	}
+// Iter returns an iterator over assets, fetching pages as they are needed.
+func (s *AssetService) Iter(ctx context.Context, opts *ListOptions) *AssetIter {
+	path := "/assets/"
+	return &AssetIter{s.newIter(ctx, path, opts, func(v interface{}) (interface{}, error) {
+		asset := &Asset{}
+		err := mapstruct(v, asset)
+		return asset, err
+	})}
+}
 
+// list collects the assets of the iterator.
+func (s *AssetService) list(it *AssetIter) (*AssetList, error) {
+	var results []Asset
+	for it.Next() {
+		results = append(results, *it.Value())
+	}
+	if err := it.Err(); err != nil {
+		return nil, fmt.Errorf("Could not retrieve list of assets: %w", err)
+	}
 	return &AssetList{Values: results}, nil
 }
@@ -1,25 +1,23 @@
 package upvest
 
 import (
-	"bytes"
+	"context"
 	"crypto/hmac"
 	"crypto/sha512"
 	"encoding/hex"
 	"fmt"
 	"io/ioutil"
-	"net/http"
 	"net/url"
-
-	"github.com/pkg/errors"
 )
 
 const (
 	// URLEncodeHeader is the content-type header for OuAth2
 	URLEncodeHeader = "application/x-www-form-urlencoded"
 	// clientele
-	oauthPath = "/clientele/oauth2/token"
-	grantType = "password"
-	scope     = "read write echo transaction"
+	oauthPath        = "/clientele/oauth2/token"
+	grantType        = "password"
+	refreshGrantType = "refresh_token"
+	scope            = "read write echo transaction"
 )
 
 // Headers represent the HTTP headers sent to Upvest API
@@ -31,6 +29,15 @@ type AuthProvider interface {
 	GetHeaders(method, path string, body interface{}, c *Client) (Headers, error)
 }
 
+// ContextAuthProvider is implemented by auth providers which need to make
+// requests of their own (e.g. the OAuth2 token exchange). The client prefers
+// GetHeadersContext over GetHeaders so that those requests honour the
+// caller's context.
+type ContextAuthProvider interface {
+	AuthProvider
+	GetHeadersContext(ctx context.Context, method, path string, body interface{}, c *Client) (Headers, error)
+}
+
 // OAuthResponse represents succesful OAuth response
 type OAuthResponse struct {
 	AccessToken  string `json:"access_token"`
@@ -46,6 +53,11 @@ type OAuth struct {
 	clientSecret string
 	username     string
 	password     string
+
+	// tokens caches the access token between requests.
+	tokens *tokenManager
+	// store optionally persists tokens beyond the lifetime of the client.
+	store TokenStore
 }
 
 // KeyAuth (The API Key Authentication) is used to authenticate requests as a tenant.
@@ -94,19 +106,87 @@ func (auth KeyAuth) GetHeaders(method, path string, body interface{}, c *Client)
 
 // GetHeaders returns authorization headers for requests as a clientele
 func (oauth OAuth) GetHeaders(method, path string, body interface{}, c *Client) (Headers, error) {
-	resp, err := oauth.preFlight(c)
+	return oauth.GetHeadersContext(context.Background(), method, path, body, c)
+}
+
+// GetHeadersContext is like GetHeaders but performs the OAuth2 preflight
+// request with the given context. The access token is cached and refreshed
+// once it expires, so that most requests need no preflight at all.
+func (oauth OAuth) GetHeadersContext(ctx context.Context, method, path string, body interface{}, c *Client) (Headers, error) {
+	tok, err := oauth.token(ctx, c)
 	if err != nil {
-		return nil, errors.Wrap(err, "OAuth2 preflight request failed")
+		return nil, fmt.Errorf("OAuth2 preflight request failed: %w", err)
 	}
 	// Retrieve and return OAuth token
 	headers := Headers{
-		"Authorization": fmt.Sprintf("Bearer %s", resp.AccessToken),
+		"Authorization": fmt.Sprintf("Bearer %s", tok.AccessToken),
 		"Content-Type":  "application/json",
 	}
 	return headers, nil
 }
 
-func (oauth OAuth) preFlight(c *Client) (*OAuthResponse, error) {
+// token returns a valid access token, requesting one if necessary.
+func (oauth OAuth) token(ctx context.Context, c *Client) (*Token, error) {
+	fetch := func(ctx context.Context, stale *Token) (*Token, error) {
+		if oauth.store == nil {
+			return oauth.fetchToken(ctx, c, stale)
+		}
+		key := oauth.tokenKey()
+		stored, err := oauth.store.Get(key)
+		if err != nil {
+			c.logEntry(LogLevelError, "could not load OAuth2 token from store", Fields{"error": err})
+		} else if stored.Valid() {
+			return stored, nil
+		} else if stored != nil {
+			// another process may have refreshed the token since we last saw it
+			stale = stored
+		}
+
+		tok, err := oauth.fetchToken(ctx, c, stale)
+		if err != nil {
+			return nil, err
+		}
+		if err := oauth.store.Put(key, tok); err != nil {
+			c.logEntry(LogLevelError, "could not save OAuth2 token to store", Fields{"error": err})
+		}
+		return tok, nil
+	}
+	if oauth.tokens == nil {
+		return fetch(ctx, nil)
+	}
+	return oauth.tokens.Token(ctx, fetch)
+}
+
+// tokenInvalidator is implemented by auth providers caching tokens which the
+// API may reject before they expire.
+type tokenInvalidator interface {
+	invalidateToken(c *Client, accessToken string)
+}
+
+// invalidateToken drops an access token the API rejected from the cache and
+// the token store, so that the next request obtains a new one.
+func (oauth OAuth) invalidateToken(c *Client, accessToken string) {
+	if oauth.tokens != nil {
+		oauth.tokens.invalidate(accessToken)
+	}
+	if oauth.store == nil {
+		return
+	}
+	key := oauth.tokenKey()
+	stored, err := oauth.store.Get(key)
+	if err != nil || stored == nil || stored.AccessToken != accessToken {
+		return
+	}
+	if err := oauth.store.Delete(key); err != nil {
+		c.logEntry(LogLevelError, "could not delete OAuth2 token from store", Fields{"error": err})
+	}
+}
+
+func (oauth OAuth) tokenKey() TokenKey {
+	return TokenKey{ClientID: oauth.clientID, Username: oauth.username}
+}
+
+func (oauth OAuth) preFlight(ctx context.Context, c *Client) (*OAuthResponse, error) {
 	data := url.Values{}
 	data.Add("grant_type", grantType)
 	data.Add("scope", scope)
@@ -114,16 +194,5 @@ func (oauth OAuth) preFlight(c *Client) (*OAuthResponse, error) {
 	data.Add("client_secret", oauth.clientSecret)
 	data.Add("username", oauth.username)
 	data.Add("password", oauth.password)
-
-	payload := bytes.NewBufferString(data.Encode())
-
-	p := &Params{}
-	// TODO: refactor this to pass content type to Call/CallRaw
-	p.AddHeader("Content-Type", URLEncodeHeader)
-	p.AddHeader("Cache-Control", "no-cache")
-
-	resp := &OAuthResponse{}
-	// 	err = c.CallRaw(http.MethodPost, oauthPath, buf, resp, contentType)
-	err := c.Call(http.MethodPost, oauthPath, payload, resp, p)
-	return resp, err
+	return requestToken(ctx, c, data)
 }
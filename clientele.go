@@ -8,8 +8,17 @@ type ClienteleAPI struct {
 }
 
 // NewClientele creates a new clientele for interacting with your Upvest clients/users
+// OAuth tokens are cached for the lifetime of the returned API and, if the
+// client has a TokenStore, persisted there.
 func (c *Client) NewClientele(clientID, clientSecret, username, password string) *ClienteleAPI {
-	auth := OAuth{clientID: clientID, clientSecret: clientSecret, username: username, password: password}
+	auth := OAuth{
+		clientID:     clientID,
+		clientSecret: clientSecret,
+		username:     username,
+		password:     password,
+		tokens:       &tokenManager{},
+		store:        c.TokenStore,
+	}
 	svc := service{c, auth} // reuse a single client struct instead of allocating one for each service
 	clientele := &ClienteleAPI{
 		Wallet:      &WalletService{svc},
@@ -42,8 +42,8 @@ func TestTransactionCRUD(t *testing.T) {
 	tp := &TransactionParams{
 		Password:  staticUserPW,
 		AssetID:   ethRopstenAssetID,
-		Quantity:  10000000000000000,
-		Fee:       41180000000000,
+		Quantity:  AmountFromMinor(10000000000000000, 18),
+		Fee:       AmountFromMinor(41180000000000, 0),
 		Recipient: "0xf9b44Ba370CAfc6a7AF77D0BDB0d50106823D91b",
 	}
 
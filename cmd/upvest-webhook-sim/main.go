@@ -0,0 +1,91 @@
+// Command upvest-webhook-sim sends signed webhook deliveries to a local URL,
+// so that webhook handlers can be developed without waiting for Upvest to
+// fire the events.
+//
+// Simulate the events of an event filter scope, with data fields overridden:
+//
+//	upvest-webhook-sim -url http://localhost:8080/webhook -secret abc \
+//		-scope ethereum_ropsten.transaction.confirmed.3 -data '{"quantity":"42"}'
+//
+// Replay captured deliveries, one JSON event per line:
+//
+//	upvest-webhook-sim -url http://localhost:8080/webhook -secret abc -replay events.jsonl
+//
+// The secret defaults to the UPVEST_WEBHOOK_SECRET environment variable.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+
+	"github.com/upvestco/upvest-go"
+	"github.com/upvestco/upvest-go/upvesttest"
+)
+
+func main() {
+	if err := run(); err != nil {
+		fmt.Fprintf(os.Stderr, "upvest-webhook-sim: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// run parses the flags and delivers the events, returning the first error.
+func run() error {
+	url := flag.String("url", "http://localhost:8080/webhook", "URL to deliver events to")
+	secret := flag.String("secret", os.Getenv("UPVEST_WEBHOOK_SECRET"), "HMAC secret key of the webhook")
+	scope := flag.String("scope", "upvest.echo.post", "event filter scope of the events to simulate")
+	data := flag.String("data", "", "JSON object of event data fields to set")
+	replay := flag.String("replay", "", "JSONL file of captured events to replay instead")
+	flag.Parse()
+
+	if *secret == "" {
+		return errors.New("no secret given, use -secret or UPVEST_WEBHOOK_SECRET")
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	go func() {
+		<-interrupt
+		cancel()
+	}()
+
+	sim := upvesttest.NewWebhookSimulator(*url, *secret)
+	if *replay != "" {
+		f, err := os.Open(*replay)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		n, err := sim.Replay(ctx, f)
+		fmt.Printf("replayed %d events\n", n)
+		return err
+	}
+
+	filter, err := upvest.EventFilterScope(*scope).Parse()
+	if err != nil {
+		return err
+	}
+	var fields map[string]interface{}
+	if *data != "" {
+		if err := json.Unmarshal([]byte(*data), &fields); err != nil {
+			return fmt.Errorf("invalid -data: %w", err)
+		}
+	}
+	events, err := upvesttest.Events(filter, fields)
+	if err != nil {
+		return err
+	}
+	for _, e := range events {
+		if err := sim.Send(ctx, e); err != nil {
+			return fmt.Errorf("%s event %s: %w", e.Type(), e.ID, err)
+		}
+		fmt.Printf("delivered %s event %s\n", e.Type(), e.ID)
+	}
+	return nil
+}
@@ -0,0 +1,130 @@
+package upvest
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// DedupStore remembers the IDs of webhook events which have been received,
+// so that the receiver can skip events Upvest delivers more than once.
+// Implementations must be safe for concurrent use.
+type DedupStore interface {
+	// Claim marks the event ID as received. It returns false if the ID was
+	// already claimed, in which case the event must not be handled again.
+	Claim(id string) (bool, error)
+	// Release forgets the event ID, so that a redelivery is handled again.
+	// The receiver releases events whose handlers failed.
+	Release(id string) error
+}
+
+// MemoryDedupStore is a DedupStore keeping the most recently received event
+// IDs in memory, forgetting the least recently received ones beyond its size.
+type MemoryDedupStore struct {
+	mu    sync.Mutex
+	size  int
+	order *list.List
+	ids   map[string]*list.Element
+}
+
+// NewMemoryDedupStore creates an in-memory dedup store remembering up to size
+// event IDs.
+func NewMemoryDedupStore(size int) *MemoryDedupStore {
+	return &MemoryDedupStore{size: size, order: list.New(), ids: make(map[string]*list.Element)}
+}
+
+// Claim marks the event ID as received
+func (s *MemoryDedupStore) Claim(id string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if el, ok := s.ids[id]; ok {
+		s.order.MoveToFront(el)
+		return false, nil
+	}
+	s.ids[id] = s.order.PushFront(id)
+	for s.size > 0 && s.order.Len() > s.size {
+		oldest := s.order.Back()
+		s.order.Remove(oldest)
+		delete(s.ids, oldest.Value.(string))
+	}
+	return true, nil
+}
+
+// Release forgets the event ID
+func (s *MemoryDedupStore) Release(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if el, ok := s.ids[id]; ok {
+		s.order.Remove(el)
+		delete(s.ids, id)
+	}
+	return nil
+}
+
+// FileDedupStore is a DedupStore keeping a marker file per event ID. Markers
+// are created exclusively, so the same directory may be shared by several
+// processes receiving the same webhook. Use Prune to remove old markers.
+type FileDedupStore struct {
+	dir string
+}
+
+// NewFileDedupStore creates a dedup store in dir, which is created if needed
+func NewFileDedupStore(dir string) (*FileDedupStore, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, errors.Wrap(err, "could not create dedup directory")
+	}
+	return &FileDedupStore{dir: dir}, nil
+}
+
+// filename returns the name of the marker file for an event ID.
+func (s *FileDedupStore) filename(id string) string {
+	sum := sha256.Sum256([]byte(id))
+	return filepath.Join(s.dir, hex.EncodeToString(sum[:])+".seen")
+}
+
+// Claim marks the event ID as received
+func (s *FileDedupStore) Claim(id string) (bool, error) {
+	f, err := os.OpenFile(s.filename(id), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if os.IsExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, f.Close()
+}
+
+// Release forgets the event ID
+func (s *FileDedupStore) Release(id string) error {
+	err := os.Remove(s.filename(id))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// Prune forgets the event IDs claimed longer than age ago. Upvest stops
+// redelivering an event after a while, so older markers are not needed.
+func (s *FileDedupStore) Prune(age time.Duration) error {
+	files, err := ioutil.ReadDir(s.dir)
+	if err != nil {
+		return err
+	}
+	cutoff := time.Now().Add(-age)
+	for _, fi := range files {
+		if filepath.Ext(fi.Name()) != ".seen" || fi.ModTime().After(cutoff) {
+			continue
+		}
+		if err := os.Remove(filepath.Join(s.dir, fi.Name())); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,72 @@
+package upvest
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+func testDedupStore(t *testing.T, store DedupStore) {
+	if first, err := store.Claim("e1"); err != nil || !first {
+		t.Fatalf("Expected first claim to succeed, got %v, %v", first, err)
+	}
+	if first, err := store.Claim("e1"); err != nil || first {
+		t.Errorf("Expected second claim to fail, got %v, %v", first, err)
+	}
+	if first, err := store.Claim("e2"); err != nil || !first {
+		t.Errorf("Expected claim of other event to succeed, got %v, %v", first, err)
+	}
+	if err := store.Release("e1"); err != nil {
+		t.Fatalf("Release returned error: %v", err)
+	}
+	if first, err := store.Claim("e1"); err != nil || !first {
+		t.Errorf("Expected claim of released event to succeed, got %v, %v", first, err)
+	}
+	if err := store.Release("missing"); err != nil {
+		t.Errorf("Release of unknown event returned error: %v", err)
+	}
+}
+
+func TestMemoryDedupStore(t *testing.T) {
+	testDedupStore(t, NewMemoryDedupStore(10))
+
+	store := NewMemoryDedupStore(2)
+	store.Claim("e1")
+	store.Claim("e2")
+	store.Claim("e1")
+	store.Claim("e3")
+	if first, _ := store.Claim("e2"); !first {
+		t.Error("Expected least recently received event to be forgotten")
+	}
+	if first, _ := store.Claim("e3"); first {
+		t.Error("Expected recently received event to be remembered")
+	}
+}
+
+func TestFileDedupStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "upvest-dedup")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	store, err := NewFileDedupStore(dir)
+	if err != nil {
+		t.Fatalf("NewFileDedupStore returned error: %v", err)
+	}
+	testDedupStore(t, store)
+
+	if err := store.Prune(time.Hour); err != nil {
+		t.Fatalf("Prune returned error: %v", err)
+	}
+	if first, _ := store.Claim("e1"); first {
+		t.Error("Expected recent event to survive Prune")
+	}
+	if err := store.Prune(-time.Hour); err != nil {
+		t.Fatalf("Prune returned error: %v", err)
+	}
+	if first, _ := store.Claim("e1"); !first {
+		t.Error("Expected Prune to forget old events")
+	}
+}
@@ -2,9 +2,13 @@ package upvest
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io/ioutil"
 	"net/http"
 	"net/url"
+	"sort"
+	"strings"
 )
 
 // ErrorType is represents the allowed values for the error's type.
@@ -12,21 +16,50 @@ type ErrorType string
 
 // List of values that ErrorType can take.
 const (
-	ErrInvalidRequest ErrorType = "invalid_request_error"
-	ErrAuthorization            = "authorization_error"
-	ErrAuthentication           = "authentication_error"
-	ErrDuplicateUser            = "duplicate_user"
-	ErrServer                   = "server_error"
+	ErrInvalidRequest      ErrorType = "invalid_request_error"
+	ErrAuthorization                 = "authorization_error"
+	ErrAuthentication                = "authentication_error"
+	ErrResourceNotFound              = "not_found_error"
+	ErrDuplicateUser                 = "duplicate_user"
+	ErrUnprocessableEntity           = "validation_error"
+	ErrTooManyRequests               = "rate_limit_error"
+	ErrServer                        = "server_error"
 )
 
 var errorTypes = map[int]ErrorType{
 	http.StatusBadRequest:          ErrInvalidRequest,
 	http.StatusUnauthorized:        ErrAuthorization,
 	http.StatusForbidden:           ErrAuthentication,
+	http.StatusNotFound:            ErrResourceNotFound,
 	http.StatusConflict:            ErrDuplicateUser,
+	http.StatusUnprocessableEntity: ErrUnprocessableEntity,
+	http.StatusTooManyRequests:     ErrTooManyRequests,
 	http.StatusInternalServerError: ErrServer,
 }
 
+// Sentinel errors an *Error matches with errors.Is, depending on its status code.
+var (
+	ErrValidation   = errors.New("upvest: validation failed")     // 400, 422
+	ErrUnauthorized = errors.New("upvest: unauthorized")          // 401
+	ErrForbidden    = errors.New("upvest: forbidden")             // 403
+	ErrNotFound     = errors.New("upvest: not found")             // 404
+	ErrConflict     = errors.New("upvest: conflict")              // 409
+	ErrRateLimited  = errors.New("upvest: rate limited")          // 429
+	ErrServerError  = errors.New("upvest: internal server error") // 5xx
+)
+
+// retryableStatusCodes are the status codes of errors which are likely to
+// go away when the request is repeated.
+var retryableStatusCodes = []int{
+	http.StatusTooManyRequests,
+	http.StatusBadGateway,
+	http.StatusServiceUnavailable,
+	http.StatusGatewayTimeout,
+}
+
+// requestIDHeaders are the response headers the request ID is looked up in.
+var requestIDHeaders = []string{"X-Request-Id", "X-Correlation-Id", "X-Amzn-Trace-Id"}
+
 // Error represents an error response from the Upvest API server
 type Error struct {
 	Type       ErrorType              `json:"type,omitempty"`
@@ -35,6 +68,10 @@ type Error struct {
 	Details    map[string]interface{} `json:"details,omitempty"`
 	URL        *url.URL               `json:"url,omitempty"`
 	Header     http.Header            `json:"header,omitempty"`
+	// FieldErrors holds the validation errors of individual request fields.
+	FieldErrors map[string][]string `json:"field_errors,omitempty"`
+	// RequestID identifies the request in the Upvest logs, if the server provided one.
+	RequestID string `json:"request_id,omitempty"`
 }
 
 // httpError supports the error interface
@@ -43,6 +80,66 @@ func (aerr *Error) Error() string {
 	return string(ret)
 }
 
+// Is lets errors.Is match the error against the sentinel errors of its
+// status code, e.g. errors.Is(err, ErrNotFound).
+func (aerr *Error) Is(target error) bool {
+	code := aerr.StatusCode
+	switch target {
+	case ErrValidation:
+		return code == http.StatusBadRequest || code == http.StatusUnprocessableEntity
+	case ErrUnauthorized:
+		return code == http.StatusUnauthorized
+	case ErrForbidden:
+		return code == http.StatusForbidden
+	case ErrNotFound:
+		return code == http.StatusNotFound
+	case ErrConflict:
+		return code == http.StatusConflict
+	case ErrRateLimited:
+		return code == http.StatusTooManyRequests
+	case ErrServerError:
+		return code >= http.StatusInternalServerError
+	}
+	return false
+}
+
+// IsRetryable reports whether the request may succeed when repeated, e.g.
+// because the server was rate limiting or temporarily unavailable.
+func (aerr *Error) IsRetryable() bool {
+	for _, code := range retryableStatusCodes {
+		if aerr.StatusCode == code {
+			return true
+		}
+	}
+	return false
+}
+
+// asError finds the *Error in the chain of err, looking through both
+// standard and github.com/pkg/errors wrapping.
+func asError(err error) (*Error, bool) {
+	for err != nil {
+		var aerr *Error
+		if errors.As(err, &aerr) {
+			return aerr, true
+		}
+		causer, ok := err.(interface{ Cause() error })
+		if !ok {
+			break
+		}
+		err = causer.Cause()
+	}
+	return nil, false
+}
+
+// IsRetryable reports whether the request which failed with err may succeed
+// when repeated, be it because of a transient API error or network problem.
+func IsRetryable(err error) bool {
+	if aerr, ok := asError(err); ok {
+		return aerr.IsRetryable()
+	}
+	return IsTemporaryNetError(err)
+}
+
 // NewError parses http response and returns Upvest error type
 func NewError(resp *http.Response) *Error {
 	p, _ := ioutil.ReadAll(resp.Body)
@@ -54,14 +151,103 @@ func NewError(resp *http.Response) *Error {
 		errorType = err
 	}
 
-	// uperror := upvestErrorResp["error"].(map[string]interface{})
-
-	return &Error{
+	aerr := &Error{
 		Type:       errorType,
 		StatusCode: resp.StatusCode,
 		Header:     resp.Header,
 		Details:    upvestErrorResp,
-		URL:        resp.Request.URL,
-		//Message:    uperror["Message"].(string),
 	}
+	if resp.Request != nil {
+		aerr.URL = resp.Request.URL
+	}
+	aerr.parseBody(upvestErrorResp)
+	if aerr.Message == "" {
+		aerr.Message = http.StatusText(resp.StatusCode)
+	}
+	for _, h := range requestIDHeaders {
+		if id := resp.Header.Get(h); id != "" && aerr.RequestID == "" {
+			aerr.RequestID = id
+		}
+	}
+	return aerr
+}
+
+// parseBody extracts the message, request ID and field errors from the
+// shapes of error bodies returned by the API:
+//
+//	{"error": {"message": "...", "details": {...}}}
+//	{"error": "invalid_grant", "error_description": "..."}
+//	{"message": "..."} or {"detail": "..."}
+//	{"field": ["message", ...], "non_field_errors": [...]}
+func (aerr *Error) parseBody(body map[string]interface{}) {
+	if body == nil {
+		return
+	}
+	if nested, ok := body["error"].(map[string]interface{}); ok {
+		aerr.parseBody(nested)
+		if details, ok := nested["details"].(map[string]interface{}); ok {
+			aerr.addFieldErrors(details, true)
+		}
+		return
+	}
+
+	for _, key := range []string{"message", "error_description", "detail", "error"} {
+		if msg, ok := body[key].(string); ok && msg != "" {
+			aerr.Message = msg
+			break
+		}
+	}
+	if id, ok := body["request_id"].(string); ok {
+		aerr.RequestID = id
+	}
+	aerr.addFieldErrors(body, false)
+}
+
+// addFieldErrors collects the values of fields holding a list of messages,
+// which is how validation errors are reported. Single messages are only
+// collected if allowStrings is set.
+func (aerr *Error) addFieldErrors(fields map[string]interface{}, allowStrings bool) {
+	for field, v := range fields {
+		switch field {
+		case "message", "error", "error_description", "detail", "request_id", "code", "type", "details":
+			continue
+		}
+		var msgs []string
+		switch v := v.(type) {
+		case string:
+			if allowStrings {
+				msgs = []string{v}
+			}
+		case []interface{}:
+			for _, m := range v {
+				if s, ok := m.(string); ok {
+					msgs = append(msgs, s)
+				}
+			}
+		}
+		if len(msgs) == 0 {
+			continue
+		}
+		if aerr.FieldErrors == nil {
+			aerr.FieldErrors = make(map[string][]string)
+		}
+		aerr.FieldErrors[field] = append(aerr.FieldErrors[field], msgs...)
+	}
+	if aerr.Message == "" && len(aerr.FieldErrors) > 0 {
+		aerr.Message = aerr.fieldErrorSummary()
+	}
+}
+
+// fieldErrorSummary joins the field errors into a single message.
+func (aerr *Error) fieldErrorSummary() string {
+	fields := make([]string, 0, len(aerr.FieldErrors))
+	for f := range aerr.FieldErrors {
+		fields = append(fields, f)
+	}
+	sort.Strings(fields)
+	parts := make([]string, len(fields))
+	for i, f := range fields {
+		parts[i] = fmt.Sprintf("%s: %s", f, strings.Join(aerr.FieldErrors[f], ", "))
+	}
+	return strings.Join(parts, "; ")
 }
@@ -0,0 +1,107 @@
+package upvest
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func newErrorResponse(status int, body string, header http.Header) *http.Response {
+	if header == nil {
+		header = http.Header{}
+	}
+	req, _ := http.NewRequest(http.MethodGet, "https://api.playground.upvest.co/1.0/kms/wallets/", nil)
+	return &http.Response{
+		StatusCode: status,
+		Header:     header,
+		Body:       ioutil.NopCloser(strings.NewReader(body)),
+		Request:    req,
+	}
+}
+
+func TestNewErrorParsesBody(t *testing.T) {
+	cases := []struct {
+		body    string
+		message string
+		fields  map[string]string
+	}{
+		{`{"error": {"code": 400, "message": "Wallet password is wrong", "details": {"password": "invalid"}}}`,
+			"Wallet password is wrong", map[string]string{"password": "invalid"}},
+		{`{"error": "invalid_grant", "error_description": "Invalid credentials given."}`,
+			"Invalid credentials given.", nil},
+		{`{"detail": "Not found."}`, "Not found.", nil},
+		{`{"username": ["A user with that username already exists."]}`,
+			"username: A user with that username already exists.",
+			map[string]string{"username": "A user with that username already exists."}},
+		{`not json`, "Bad Request", nil},
+	}
+
+	for _, tc := range cases {
+		aerr := NewError(newErrorResponse(http.StatusBadRequest, tc.body, nil))
+		if aerr.Message != tc.message {
+			t.Errorf("Expected message %q for %s, got %q", tc.message, tc.body, aerr.Message)
+		}
+		for field, msg := range tc.fields {
+			if len(aerr.FieldErrors[field]) != 1 || aerr.FieldErrors[field][0] != msg {
+				t.Errorf("Expected field error %q for %s, got %v", msg, field, aerr.FieldErrors[field])
+			}
+		}
+	}
+}
+
+func TestNewErrorRequestID(t *testing.T) {
+	aerr := NewError(newErrorResponse(http.StatusInternalServerError, `{}`, http.Header{"X-Request-Id": []string{"req-1"}}))
+	if aerr.RequestID != "req-1" {
+		t.Errorf("Expected request ID req-1, got %q", aerr.RequestID)
+	}
+}
+
+func TestErrorIs(t *testing.T) {
+	cases := map[int]error{
+		http.StatusBadRequest:          ErrValidation,
+		http.StatusUnauthorized:        ErrUnauthorized,
+		http.StatusForbidden:           ErrForbidden,
+		http.StatusNotFound:            ErrNotFound,
+		http.StatusConflict:            ErrConflict,
+		http.StatusUnprocessableEntity: ErrValidation,
+		http.StatusTooManyRequests:     ErrRateLimited,
+		http.StatusBadGateway:          ErrServerError,
+	}
+	for status, sentinel := range cases {
+		aerr := NewError(newErrorResponse(status, `{}`, nil))
+		if !errors.Is(aerr, sentinel) {
+			t.Errorf("Expected status %d to match %v", status, sentinel)
+		}
+		if status != http.StatusNotFound && errors.Is(aerr, ErrNotFound) {
+			t.Errorf("Expected status %d not to match %v", status, ErrNotFound)
+		}
+	}
+
+	if !NewError(newErrorResponse(http.StatusServiceUnavailable, `{}`, nil)).IsRetryable() {
+		t.Errorf("Expected 503 to be retryable")
+	}
+	if NewError(newErrorResponse(http.StatusNotFound, `{}`, nil)).IsRetryable() {
+		t.Errorf("Expected 404 not to be retryable")
+	}
+}
+
+// Tests that API errors can be matched through the wrapping of list calls
+func TestErrorIsWrapped(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer ts.Close()
+
+	s := &TransactionService{service{NewClient(ts.URL, nil), nil}}
+	_, err := s.List("w1")
+	if !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected list error to match ErrNotFound, got %v", err)
+	}
+	var aerr *Error
+	if !errors.As(err, &aerr) || aerr.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected list error to unwrap to *Error, got %v", err)
+	}
+}
@@ -0,0 +1,335 @@
+package upvest
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/decred/dcrd/dcrec/secp256k1/v3"
+	"github.com/upvestco/upvest-go/internal/ethenc"
+)
+
+// PersonalMessageHash returns the EIP-191 digest of a personal message, as
+// signed by personal_sign.
+func PersonalMessageHash(message []byte) []byte {
+	prefix := fmt.Sprintf("\x19Ethereum Signed Message:\n%d", len(message))
+	return Keccak256([]byte(prefix), message)
+}
+
+// SignPersonalMessage signs an EIP-191 personal message with a wallet and
+// returns the 65 byte r||s||v signature, see Signature.Bytes.
+func (s *WalletService) SignPersonalMessage(walletID, password string, message []byte) ([]byte, error) {
+	return s.SignPersonalMessageContext(context.Background(), walletID, password, message)
+}
+
+// SignPersonalMessageContext is like SignPersonalMessage but takes a context.
+func (s *WalletService) SignPersonalMessageContext(ctx context.Context, walletID, password string, message []byte) ([]byte, error) {
+	return s.signDigest(ctx, walletID, password, PersonalMessageHash(message))
+}
+
+// SignTypedData signs EIP-712 typed data with a wallet and returns the 65
+// byte r||s||v signature, see Signature.Bytes.
+func (s *WalletService) SignTypedData(walletID, password string, data *TypedData) ([]byte, error) {
+	return s.SignTypedDataContext(context.Background(), walletID, password, data)
+}
+
+// SignTypedDataContext is like SignTypedData but takes a context.
+func (s *WalletService) SignTypedDataContext(ctx context.Context, walletID, password string, data *TypedData) ([]byte, error) {
+	hash, err := data.Hash()
+	if err != nil {
+		return nil, err
+	}
+	return s.signDigest(ctx, walletID, password, hash)
+}
+
+// signDigest signs a Keccak-256 digest and checks that the signature
+// recovers to the wallet's key.
+func (s *WalletService) signDigest(ctx context.Context, walletID, password string, hash []byte) ([]byte, error) {
+	sig, err := s.SignContext(ctx, walletID, &SignatureParams{
+		Password:    password,
+		ToSign:      hex.EncodeToString(hash),
+		InputFormat: "hex",
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := sig.verifyRecoverable(hash); err != nil {
+		return nil, err
+	}
+	return sig.Bytes()
+}
+
+// Bytes returns the 65 byte r||s||v form of the signature used by Ethereum,
+// with v being 27 or 28. The s component is normalized to the lower half of
+// the curve order, as required by EIP-2.
+func (sig *Signature) Bytes() ([]byte, error) {
+	r, s, err := sig.Components()
+	if err != nil {
+		return nil, err
+	}
+	v, err := sig.RecoveryID()
+	if err != nil {
+		return nil, err
+	}
+	n := secp256k1.S256().Params().N
+	if s.Cmp(new(big.Int).Rsh(n, 1)) > 0 {
+		s = new(big.Int).Sub(n, s)
+		v ^= 1
+	}
+	if r.BitLen() > 256 || s.BitLen() > 256 {
+		return nil, ErrSignatureMismatch
+	}
+	out := make([]byte, 65)
+	rb, sb := r.Bytes(), s.Bytes()
+	copy(out[32-len(rb):32], rb)
+	copy(out[64-len(sb):64], sb)
+	out[64] = byte(27 + v)
+	return out, nil
+}
+
+// TypedDataField is a member of an EIP-712 struct type
+type TypedDataField struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+// TypedData is EIP-712 typed data, in the JSON form of eth_signTypedData_v4.
+// If Types has no EIP712Domain type, it is derived from the fields set in
+// Domain.
+type TypedData struct {
+	Types       map[string][]TypedDataField `json:"types"`
+	PrimaryType string                      `json:"primaryType"`
+	Domain      map[string]interface{}      `json:"domain"`
+	Message     map[string]interface{}      `json:"message"`
+}
+
+// UnmarshalJSON decodes typed data keeping its numbers as json.Number, so
+// that integers beyond the precision of float64 are hashed exactly.
+func (td *TypedData) UnmarshalJSON(data []byte) error {
+	type typedData TypedData
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	return dec.Decode((*typedData)(td))
+}
+
+// eip712DomainFields are the fields an EIP712Domain may have, in order.
+var eip712DomainFields = []TypedDataField{
+	{"name", "string"},
+	{"version", "string"},
+	{"chainId", "uint256"},
+	{"verifyingContract", "address"},
+	{"salt", "bytes32"},
+}
+
+// Hash returns the EIP-712 digest of the typed data
+func (td *TypedData) Hash() ([]byte, error) {
+	domain, err := td.HashStruct("EIP712Domain", td.Domain)
+	if err != nil {
+		return nil, fmt.Errorf("domain: %w", err)
+	}
+	message, err := td.HashStruct(td.PrimaryType, td.Message)
+	if err != nil {
+		return nil, fmt.Errorf("message: %w", err)
+	}
+	return Keccak256([]byte{0x19, 0x01}, domain, message), nil
+}
+
+// types returns the types of the typed data, deriving EIP712Domain if needed.
+func (td *TypedData) types() map[string][]TypedDataField {
+	if _, ok := td.Types["EIP712Domain"]; ok {
+		return td.Types
+	}
+	types := make(map[string][]TypedDataField, len(td.Types)+1)
+	for k, v := range td.Types {
+		types[k] = v
+	}
+	var domain []TypedDataField
+	for _, f := range eip712DomainFields {
+		if _, ok := td.Domain[f.Name]; ok {
+			domain = append(domain, f)
+		}
+	}
+	types["EIP712Domain"] = domain
+	return types
+}
+
+// HashStruct returns the EIP-712 hashStruct of a value of a struct type
+func (td *TypedData) HashStruct(typ string, value map[string]interface{}) ([]byte, error) {
+	return hashStruct(td.types(), typ, value)
+}
+
+// hashStruct returns the hash of the type encoding and the encoded data.
+func hashStruct(types map[string][]TypedDataField, typ string, value map[string]interface{}) ([]byte, error) {
+	encoding, err := encodeType(types, typ)
+	if err != nil {
+		return nil, err
+	}
+	data, err := encodeData(types, typ, value)
+	if err != nil {
+		return nil, err
+	}
+	return Keccak256(Keccak256([]byte(encoding)), data), nil
+}
+
+// arraySuffix matches the array suffix of a type, e.g. "[]" or "[3]".
+var arraySuffix = regexp.MustCompile(`\[(\d*)\]$`)
+
+// baseType strips array suffixes from a type.
+func baseType(typ string) string {
+	for arraySuffix.MatchString(typ) {
+		typ = arraySuffix.ReplaceAllString(typ, "")
+	}
+	return typ
+}
+
+// encodeType returns the EIP-712 encoding of a struct type: the type itself
+// followed by the struct types it references, sorted by name.
+func encodeType(types map[string][]TypedDataField, typ string) (string, error) {
+	deps := map[string]bool{}
+	var collect func(string) error
+	collect = func(name string) error {
+		if deps[name] {
+			return nil
+		}
+		fields, ok := types[name]
+		if !ok {
+			return fmt.Errorf("unknown type %q", name)
+		}
+		deps[name] = true
+		for _, f := range fields {
+			if base := baseType(f.Type); types[base] != nil {
+				if err := collect(base); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+	if err := collect(typ); err != nil {
+		return "", err
+	}
+	delete(deps, typ)
+	names := []string{typ}
+	var sorted []string
+	for name := range deps {
+		sorted = append(sorted, name)
+	}
+	sort.Strings(sorted)
+	names = append(names, sorted...)
+
+	var b strings.Builder
+	for _, name := range names {
+		b.WriteString(name + "(")
+		for i, f := range types[name] {
+			if i > 0 {
+				b.WriteString(",")
+			}
+			b.WriteString(f.Type + " " + f.Name)
+		}
+		b.WriteString(")")
+	}
+	return b.String(), nil
+}
+
+// encodeData returns the EIP-712 encoding of the fields of a struct value.
+func encodeData(types map[string][]TypedDataField, typ string, value map[string]interface{}) ([]byte, error) {
+	var out []byte
+	for _, f := range types[typ] {
+		v, ok := value[f.Name]
+		if !ok {
+			return nil, fmt.Errorf("%s.%s is missing", typ, f.Name)
+		}
+		enc, err := encodeValue(types, f.Type, v)
+		if err != nil {
+			return nil, fmt.Errorf("%s.%s: %w", typ, f.Name, err)
+		}
+		out = append(out, enc...)
+	}
+	return out, nil
+}
+
+// encodeValue returns the 32 byte EIP-712 encoding of a value of a type.
+func encodeValue(types map[string][]TypedDataField, typ string, v interface{}) ([]byte, error) {
+	if m := arraySuffix.FindStringSubmatchIndex(typ); m != nil {
+		elem := typ[:m[0]]
+		items := reflect.ValueOf(v)
+		if items.Kind() != reflect.Slice && items.Kind() != reflect.Array {
+			return nil, fmt.Errorf("%v is not an array", v)
+		}
+		if size := typ[m[2]:m[3]]; size != "" {
+			if n, _ := strconv.Atoi(size); n != items.Len() {
+				return nil, fmt.Errorf("expected %d items, got %d", n, items.Len())
+			}
+		}
+		var out []byte
+		for i := 0; i < items.Len(); i++ {
+			enc, err := encodeValue(types, elem, items.Index(i).Interface())
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, enc...)
+		}
+		return Keccak256(out), nil
+	}
+
+	if _, ok := types[typ]; ok {
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("%v is not a %s", v, typ)
+		}
+		return hashStruct(types, typ, m)
+	}
+
+	switch {
+	case typ == "string":
+		s, ok := v.(string)
+		if !ok {
+			return nil, fmt.Errorf("%v is not a string", v)
+		}
+		return Keccak256([]byte(s)), nil
+	case typ == "bytes":
+		b, err := ethenc.Bytes(v)
+		if err != nil {
+			return nil, err
+		}
+		return Keccak256(b), nil
+	case typ == "bool":
+		b, ok := v.(bool)
+		if !ok {
+			return nil, fmt.Errorf("%v is not a bool", v)
+		}
+		if b {
+			return ethenc.Word(big.NewInt(1)), nil
+		}
+		return ethenc.Word(new(big.Int)), nil
+	case typ == "address":
+		b, err := ethenc.Bytes(v)
+		if err != nil || len(b) != 20 {
+			return nil, fmt.Errorf("%v is not an address", v)
+		}
+		return append(make([]byte, 12), b...), nil
+	case strings.HasPrefix(typ, "bytes"):
+		n, err := strconv.Atoi(typ[len("bytes"):])
+		if err != nil || n < 1 || n > 32 {
+			return nil, fmt.Errorf("unknown type %q", typ)
+		}
+		b, err := ethenc.Bytes(v)
+		if err != nil || len(b) > n {
+			return nil, fmt.Errorf("%v is not a %s", v, typ)
+		}
+		out := make([]byte, 32)
+		copy(out, b)
+		return out, nil
+	case strings.HasPrefix(typ, "uint"), strings.HasPrefix(typ, "int"):
+		return ethenc.EncodeInt(typ, v)
+	}
+	return nil, fmt.Errorf("unknown type %q", typ)
+}
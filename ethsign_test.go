@@ -0,0 +1,152 @@
+package upvest
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"math/big"
+	"testing"
+
+	"github.com/decred/dcrd/dcrec/secp256k1/v3"
+	"github.com/upvestco/upvest-go/internal/ethenc"
+)
+
+func TestPersonalMessageHash(t *testing.T) {
+	got := hex.EncodeToString(PersonalMessageHash([]byte("hello world")))
+	if got != "d9eba16ed0ecae432b71fe008c98cc872bb4cc214d3220a36f365326cf807d68" {
+		t.Errorf("Unexpected hash %s", got)
+	}
+}
+
+// mailTypedData is the example of EIP-712
+const mailTypedData = `{
+	"types": {
+		"EIP712Domain": [
+			{"name": "name", "type": "string"},
+			{"name": "version", "type": "string"},
+			{"name": "chainId", "type": "uint256"},
+			{"name": "verifyingContract", "type": "address"}
+		],
+		"Person": [
+			{"name": "name", "type": "string"},
+			{"name": "wallet", "type": "address"}
+		],
+		"Mail": [
+			{"name": "from", "type": "Person"},
+			{"name": "to", "type": "Person"},
+			{"name": "contents", "type": "string"}
+		]
+	},
+	"primaryType": "Mail",
+	"domain": {
+		"name": "Ether Mail",
+		"version": "1",
+		"chainId": 1,
+		"verifyingContract": "0xCcCCccccCCCCcCCCCCCcCcCccCcCCCcCcccccccC"
+	},
+	"message": {
+		"from": {"name": "Cow", "wallet": "0xCD2a3d9F938E13CD947Ec05AbC7FE734Df8DD826"},
+		"to": {"name": "Bob", "wallet": "0xbBbBBBBbbBBBbbbBbbBbbbbBBbBbbbbBbBbbBBbB"},
+		"contents": "Hello, Bob!"
+	}
+}`
+
+func TestTypedDataHash(t *testing.T) {
+	td := &TypedData{}
+	if err := json.Unmarshal([]byte(mailTypedData), td); err != nil {
+		t.Fatal(err)
+	}
+	encoding, err := encodeType(td.types(), "Mail")
+	if err != nil || encoding != "Mail(Person from,Person to,string contents)Person(string name,address wallet)" {
+		t.Errorf("Unexpected type encoding %q, %v", encoding, err)
+	}
+	domain, err := td.HashStruct("EIP712Domain", td.Domain)
+	if err != nil || hex.EncodeToString(domain) != "f2cee375fa42b42143804025fc449deafd50cc031ca257e0b194a650a912090f" {
+		t.Errorf("Unexpected domain separator %x, %v", domain, err)
+	}
+	hash, err := td.Hash()
+	if err != nil || hex.EncodeToString(hash) != "be609aee343fb3c4b28e1df9e632fca64fcfaede20f02e86244efddf30957bd2" {
+		t.Errorf("Unexpected digest %x, %v", hash, err)
+	}
+
+	// the domain type is derived if it is not given
+	delete(td.Types, "EIP712Domain")
+	if derived, err := td.Hash(); err != nil || hex.EncodeToString(derived) != hex.EncodeToString(hash) {
+		t.Errorf("Unexpected digest with derived domain type %x, %v", derived, err)
+	}
+
+	delete(td.Message, "contents")
+	if _, err := td.Hash(); err == nil {
+		t.Error("Expected an error for a missing field")
+	}
+}
+
+func TestEncodeValue(t *testing.T) {
+	types := map[string][]TypedDataField{}
+	cases := []struct {
+		typ   string
+		value interface{}
+		want  string
+	}{
+		{"uint256", "0x10", "0000000000000000000000000000000000000000000000000000000000000010"},
+		{"uint8", json.Number("16"), "0000000000000000000000000000000000000000000000000000000000000010"},
+		{"int256", -1, "ffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff"},
+		{"bool", true, "0000000000000000000000000000000000000000000000000000000000000001"},
+		{"bytes4", "0xdeadbeef", "deadbeef00000000000000000000000000000000000000000000000000000000"},
+		{"uint256[]", []interface{}{1, 2}, hex.EncodeToString(Keccak256(ethenc.Word(big.NewInt(1)), ethenc.Word(big.NewInt(2))))},
+	}
+	for _, c := range cases {
+		got, err := encodeValue(types, c.typ, c.value)
+		if err != nil || hex.EncodeToString(got) != c.want {
+			t.Errorf("encodeValue(%s, %v) = %x, %v, want %s", c.typ, c.value, got, err, c.want)
+		}
+	}
+	for _, c := range []struct {
+		typ   string
+		value interface{}
+	}{{"uint256", -1}, {"address", "0x1234"}, {"bytes2", "0xdeadbeef"}, {"uint256[2]", []interface{}{1}}, {"foo", 1},
+		{"uint8", 300}, {"int8", -200}, {"uintfoo", 1}, {"uint256", 1.0}, {"uint256", "0X10"}} {
+		if _, err := encodeValue(types, c.typ, c.value); err == nil {
+			t.Errorf("Expected an error encoding %v as %s", c.value, c.typ)
+		}
+	}
+}
+
+func TestSignatureBytes(t *testing.T) {
+	hash := PersonalMessageHash([]byte("hello"))
+	sig := testSign(1, hash)
+	// make s high, as the KMS may return it
+	n := secp256k1.S256().Params().N
+	s, _ := new(big.Int).SetString(sig.S, 10)
+	sig.S = new(big.Int).Sub(n, s).String()
+	sig.Recover = map[string]string{"0": "1", "1": "0"}[sig.Recover]
+	if err := sig.verifyRecoverable(hash); err != nil {
+		t.Fatalf("High s signature does not verify: %v", err)
+	}
+	b, err := sig.Bytes()
+	if err != nil {
+		t.Fatalf("Bytes returned error: %v", err)
+	}
+	if len(b) != 65 || (b[64] != 27 && b[64] != 28) {
+		t.Fatalf("Unexpected signature %x", b)
+	}
+	s = new(big.Int).SetBytes(b[32:64])
+	if s.Cmp(new(big.Int).Rsh(n, 1)) > 0 {
+		t.Errorf("Expected s in the lower half of the curve order, got %s", s)
+	}
+
+	// the normalized signature recovers the same key
+	normalized := &Signature{
+		BigNumberFormat: "hex",
+		Curve:           "secp256k1",
+		R:               hex.EncodeToString(b[:32]),
+		S:               hex.EncodeToString(b[32:64]),
+		Recover:         big.NewInt(int64(b[64])).String(),
+	}
+	pub, err := normalized.RecoverKey(hash)
+	if err != nil {
+		t.Fatalf("RecoverKey returned error: %v", err)
+	}
+	if EthereumAddress(pub) != "0x7E5F4552091A69125d5DfCb7b8C2659029395Bdf" {
+		t.Errorf("Unexpected recovered address %s", EthereumAddress(pub))
+	}
+}
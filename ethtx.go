@@ -0,0 +1,274 @@
+package upvest
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// EthereumTxType is the fee model of an Ethereum transaction
+type EthereumTxType int
+
+// Fee models of Ethereum transactions
+const (
+	// EthereumLegacyTx pays a fixed gas price
+	EthereumLegacyTx EthereumTxType = iota
+	// EthereumDynamicFeeTx pays a base fee plus a priority fee, see EIP-1559
+	EthereumDynamicFeeTx
+)
+
+// Big number formats of transaction payloads, see CreateRaw
+const (
+	InputFormatHex     = "hex"
+	InputFormatDecimal = "decimal"
+)
+
+// Gas costs used to validate the gas limit of a transaction
+const (
+	txGas               = 21000
+	txGasContractCreate = 53000
+	txDataZeroGas       = 4
+	txDataNonZeroGas    = 16
+)
+
+// EthereumTx is an Ethereum transaction for CreateComplex and CreateRaw.
+// Amounts are in wei. Nonce, gas and fees are optional; the KMS fills in
+// those which are not set.
+//
+// Usage:
+//
+//	tx := upvest.NewEthereumTx("0xf9b44Ba370CAfc6a7AF77D0BDB0d50106823D91b").
+//		WithValue(value).
+//		WithGas(60000).
+//		WithDynamicFee(maxFee, priorityFee).
+//		WithData(calldata)
+//	txn, err := clientele.Transaction.CreateEthereum(walletID, password, tx, false)
+type EthereumTx struct {
+	Type    EthereumTxType
+	ChainID *big.Int
+	Nonce   *uint64
+	// To is empty for contract creations
+	To    string
+	Value Amount
+	Data  []byte
+	// Gas is the gas limit; 0 means unset.
+	Gas uint64
+	// GasPrice is the gas price of legacy transactions; 0 means unset.
+	GasPrice Amount
+	// MaxFeePerGas and MaxPriorityFeePerGas are the fees of dynamic fee transactions
+	MaxFeePerGas         Amount
+	MaxPriorityFeePerGas Amount
+}
+
+// NewEthereumTx returns a legacy transaction to an address. An empty address
+// creates a contract.
+func NewEthereumTx(to string) *EthereumTx {
+	return &EthereumTx{To: to}
+}
+
+// WithValue sets the wei transferred by the transaction
+func (tx *EthereumTx) WithValue(value Amount) *EthereumTx {
+	tx.Value = value
+	return tx
+}
+
+// WithData sets the input data of the transaction, e.g. a contract call
+func (tx *EthereumTx) WithData(data []byte) *EthereumTx {
+	tx.Data = data
+	return tx
+}
+
+// WithNonce sets the nonce of the transaction
+func (tx *EthereumTx) WithNonce(nonce uint64) *EthereumTx {
+	tx.Nonce = &nonce
+	return tx
+}
+
+// WithGas sets the gas limit of the transaction
+func (tx *EthereumTx) WithGas(gas uint64) *EthereumTx {
+	tx.Gas = gas
+	return tx
+}
+
+// WithChainID sets the chain ID of the transaction, see EIP-155
+func (tx *EthereumTx) WithChainID(id int64) *EthereumTx {
+	tx.ChainID = big.NewInt(id)
+	return tx
+}
+
+// WithGasPrice makes the transaction a legacy transaction paying price per gas
+func (tx *EthereumTx) WithGasPrice(price Amount) *EthereumTx {
+	tx.Type = EthereumLegacyTx
+	tx.GasPrice = price
+	tx.MaxFeePerGas, tx.MaxPriorityFeePerGas = Amount{}, Amount{}
+	return tx
+}
+
+// WithDynamicFee makes the transaction an EIP-1559 transaction paying at
+// most maxFee per gas, of which up to priorityFee goes to the miner.
+func (tx *EthereumTx) WithDynamicFee(maxFee, priorityFee Amount) *EthereumTx {
+	tx.Type = EthereumDynamicFeeTx
+	tx.GasPrice = Amount{}
+	tx.MaxFeePerGas, tx.MaxPriorityFeePerGas = maxFee, priorityFee
+	return tx
+}
+
+// IntrinsicGas returns the gas the transaction costs before executing any
+// code: the base cost plus the cost of its data.
+func (tx *EthereumTx) IntrinsicGas() uint64 {
+	gas := uint64(txGas)
+	if tx.To == "" {
+		gas = txGasContractCreate
+	}
+	for _, b := range tx.Data {
+		if b == 0 {
+			gas += txDataZeroGas
+		} else {
+			gas += txDataNonZeroGas
+		}
+	}
+	return gas
+}
+
+// Validate reports whether the transaction is well-formed
+func (tx *EthereumTx) Validate() error {
+	if tx.To == "" {
+		if len(tx.Data) == 0 {
+			return errors.New("contract creation needs data")
+		}
+	} else if err := ValidateEthereumAddress(tx.To); err != nil {
+		return err
+	}
+	if tx.Value.Sign() < 0 {
+		return errors.New("value is negative")
+	}
+	if tx.ChainID != nil && tx.ChainID.Sign() <= 0 {
+		return errors.New("chain ID must be positive")
+	}
+	if tx.Gas != 0 && tx.Gas < tx.IntrinsicGas() {
+		return fmt.Errorf("gas limit %d is below the intrinsic gas %d", tx.Gas, tx.IntrinsicGas())
+	}
+	switch tx.Type {
+	case EthereumLegacyTx:
+		if !tx.MaxFeePerGas.IsZero() || !tx.MaxPriorityFeePerGas.IsZero() {
+			return errors.New("legacy transactions have a gas price, not dynamic fees")
+		}
+		if tx.GasPrice.Sign() < 0 {
+			return errors.New("gas price is negative")
+		}
+	case EthereumDynamicFeeTx:
+		if !tx.GasPrice.IsZero() {
+			return errors.New("dynamic fee transactions have no gas price")
+		}
+		if tx.MaxFeePerGas.Sign() < 0 || tx.MaxPriorityFeePerGas.Sign() < 0 {
+			return errors.New("fees are negative")
+		}
+		if tx.MaxPriorityFeePerGas.Minor().Cmp(tx.MaxFeePerGas.Minor()) > 0 {
+			return errors.New("max priority fee exceeds max fee")
+		}
+	default:
+		return fmt.Errorf("unknown transaction type %d", tx.Type)
+	}
+	return nil
+}
+
+// ValidateEthereumAddress checks the format of an address and its EIP-55
+// checksum, if it is mixed case.
+func ValidateEthereumAddress(address string) error {
+	if !strings.HasPrefix(address, "0x") || len(address) != 42 {
+		return fmt.Errorf("invalid address %q", address)
+	}
+	b, err := hex.DecodeString(address[2:])
+	if err != nil {
+		return fmt.Errorf("invalid address %q", address)
+	}
+	digits := address[2:]
+	if digits != strings.ToLower(digits) && digits != strings.ToUpper(digits) && checksumAddress(b) != address {
+		return fmt.Errorf("invalid checksum of address %q", address)
+	}
+	return nil
+}
+
+// Params validates the transaction and returns it as the tx or raw_tx
+// payload of CreateComplex or CreateRaw, with numbers in format,
+// InputFormatHex or InputFormatDecimal. Data is always hex encoded.
+func (tx *EthereumTx) Params(format string) (DataParams, error) {
+	if err := tx.Validate(); err != nil {
+		return nil, err
+	}
+	var number func(*big.Int) string
+	switch format {
+	case InputFormatHex, "":
+		number = func(n *big.Int) string { return "0x" + n.Text(16) }
+	case InputFormatDecimal:
+		number = func(n *big.Int) string { return n.String() }
+	default:
+		return nil, fmt.Errorf("unsupported input format %q", format)
+	}
+
+	params := DataParams{"value": number(tx.Value.Minor())}
+	if tx.To != "" {
+		params["to"] = tx.To
+	}
+	if len(tx.Data) > 0 {
+		params["data"] = "0x" + hex.EncodeToString(tx.Data)
+	}
+	if tx.ChainID != nil {
+		params["chainId"] = number(tx.ChainID)
+	}
+	if tx.Nonce != nil {
+		params["nonce"] = number(new(big.Int).SetUint64(*tx.Nonce))
+	}
+	if tx.Gas != 0 {
+		params["gas"] = number(new(big.Int).SetUint64(tx.Gas))
+	}
+	switch {
+	case tx.Type == EthereumDynamicFeeTx:
+		params["type"] = number(big.NewInt(2))
+		if !tx.MaxFeePerGas.IsZero() {
+			params["maxFeePerGas"] = number(tx.MaxFeePerGas.Minor())
+		}
+		if !tx.MaxPriorityFeePerGas.IsZero() {
+			params["maxPriorityFeePerGas"] = number(tx.MaxPriorityFeePerGas.Minor())
+		}
+	case !tx.GasPrice.IsZero():
+		params["gasPrice"] = number(tx.GasPrice.Minor())
+	}
+	return params, nil
+}
+
+// CreateEthereum creates a complex transaction from an Ethereum transaction,
+// rejecting it if it is malformed.
+func (s *TransactionService) CreateEthereum(walletID, password string, tx *EthereumTx, fund bool, opts ...SubmitOption) (*Transaction, error) {
+	return s.CreateEthereumContext(context.Background(), walletID, password, tx, fund, opts...)
+}
+
+// CreateEthereumContext is like CreateEthereum but takes a context.
+func (s *TransactionService) CreateEthereumContext(ctx context.Context, walletID, password string, tx *EthereumTx, fund bool, opts ...SubmitOption) (*Transaction, error) {
+	params, err := tx.Params(InputFormatHex)
+	if err != nil {
+		return nil, fmt.Errorf("invalid transaction: %w", err)
+	}
+	return s.CreateComplexContext(ctx, walletID, password, params, fund, opts...)
+}
+
+// CreateEthereumRaw creates a raw transaction from an Ethereum transaction,
+// with numbers in inputFormat, rejecting it if it is malformed.
+func (s *TransactionService) CreateEthereumRaw(walletID, password string, tx *EthereumTx, fund bool, inputFormat string, opts ...SubmitOption) (*Transaction, error) {
+	return s.CreateEthereumRawContext(context.Background(), walletID, password, tx, fund, inputFormat, opts...)
+}
+
+// CreateEthereumRawContext is like CreateEthereumRaw but takes a context.
+func (s *TransactionService) CreateEthereumRawContext(ctx context.Context, walletID, password string, tx *EthereumTx, fund bool, inputFormat string, opts ...SubmitOption) (*Transaction, error) {
+	if inputFormat == "" {
+		inputFormat = InputFormatHex
+	}
+	params, err := tx.Params(inputFormat)
+	if err != nil {
+		return nil, fmt.Errorf("invalid transaction: %w", err)
+	}
+	return s.CreateRawContext(ctx, walletID, password, params, fund, inputFormat, opts...)
+}
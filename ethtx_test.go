@@ -0,0 +1,106 @@
+package upvest
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestEthereumTxParams(t *testing.T) {
+	tx := NewEthereumTx("0xf9b44Ba370CAfc6a7AF77D0BDB0d50106823D91b").
+		WithValue(AmountFromMinor(1000, 18)).
+		WithNonce(7).
+		WithGas(30000).
+		WithChainID(3).
+		WithDynamicFee(AmountFromMinor(2000000000, 18), AmountFromMinor(1000000000, 18)).
+		WithData([]byte{0xde, 0xad})
+
+	got, err := tx.Params(InputFormatHex)
+	if err != nil {
+		t.Fatalf("Params returned error: %v", err)
+	}
+	want := DataParams{
+		"to":                   "0xf9b44Ba370CAfc6a7AF77D0BDB0d50106823D91b",
+		"value":                "0x3e8",
+		"data":                 "0xdead",
+		"chainId":              "0x3",
+		"nonce":                "0x7",
+		"gas":                  "0x7530",
+		"type":                 "0x2",
+		"maxFeePerGas":         "0x77359400",
+		"maxPriorityFeePerGas": "0x3b9aca00",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Params(hex) = %v, want %v", got, want)
+	}
+
+	legacy := NewEthereumTx("0xf9b44ba370cafc6a7af77d0bdb0d50106823d91b").WithValue(AmountFromMinor(1000, 18)).WithGasPrice(AmountFromMinor(5, 18))
+	got, err = legacy.Params(InputFormatDecimal)
+	if err != nil {
+		t.Fatalf("Params returned error: %v", err)
+	}
+	want = DataParams{"to": "0xf9b44ba370cafc6a7af77d0bdb0d50106823d91b", "value": "1000", "gasPrice": "5"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Params(decimal) = %v, want %v", got, want)
+	}
+	// unset fees are left to the KMS
+	dynamic := NewEthereumTx("0xf9b44ba370cafc6a7af77d0bdb0d50106823d91b").WithDynamicFee(Amount{}, Amount{})
+	got, err = dynamic.Params(InputFormatDecimal)
+	if err != nil {
+		t.Fatalf("Params returned error: %v", err)
+	}
+	want = DataParams{"to": "0xf9b44ba370cafc6a7af77d0bdb0d50106823d91b", "value": "0", "type": "2"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Params(dynamic) = %v, want %v", got, want)
+	}
+	if _, err := legacy.Params("base64"); err == nil {
+		t.Error("Expected an error for an unsupported format")
+	}
+}
+
+func TestEthereumTxValidate(t *testing.T) {
+	to := "0xf9b44Ba370CAfc6a7AF77D0BDB0d50106823D91b"
+	cases := map[string]*EthereumTx{
+		"bad address":       NewEthereumTx("0x1234"),
+		"bad checksum":      NewEthereumTx("0xF9b44Ba370CAfc6a7AF77D0BDB0d50106823D91b"),
+		"empty creation":    NewEthereumTx(""),
+		"negative value":    NewEthereumTx(to).WithValue(AmountFromMinor(-1, 18)),
+		"gas below 21000":   NewEthereumTx(to).WithGas(20000),
+		"gas below data":    NewEthereumTx(to).WithGas(21000).WithData([]byte{1}),
+		"priority over max": NewEthereumTx(to).WithDynamicFee(AmountFromMinor(1, 18), AmountFromMinor(2, 18)),
+		"mixed fees":        &EthereumTx{To: to, GasPrice: AmountFromMinor(1, 18), Type: EthereumDynamicFeeTx},
+		"bad chain":         NewEthereumTx(to).WithChainID(0),
+	}
+	for name, tx := range cases {
+		if err := tx.Validate(); err == nil {
+			t.Errorf("%s: expected a validation error", name)
+		}
+	}
+	if err := NewEthereumTx("").WithData([]byte{0x60, 0x80}).WithGas(53032).Validate(); err != nil {
+		t.Errorf("Unexpected error validating a contract creation: %v", err)
+	}
+}
+
+func TestComplexMatcher(t *testing.T) {
+	to := "0xf9b44Ba370CAfc6a7AF77D0BDB0d50106823D91b"
+	txn := &Transaction{Recipient: to, Quantity: AmountFromMinor(1000, 18)}
+
+	match := complexMatcher(DataParams{"to": to, "value": "0x3e8"})
+	if match == nil || !match(txn) {
+		t.Error("Expected a transfer of the same value to match")
+	}
+	if match(&Transaction{Recipient: to, Quantity: AmountFromMinor(0, 18)}) {
+		t.Error("Expected a transfer of another value not to match")
+	}
+
+	for _, tx := range []DataParams{
+		{"value": "0x3e8"},
+		{"to": to, "value": "0x0", "data": "0xa9059cbb"},
+		{"to": to, "value": "0x3e8", "nonce": "0x7"},
+		{"to": to, "value": "much"},
+		{"to": to},
+	} {
+		if complexMatcher(tx) != nil {
+			t.Errorf("Expected no matcher for %v", tx)
+		}
+	}
+}
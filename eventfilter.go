@@ -0,0 +1,203 @@
+package upvest
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// PlatformUpvest is the platform of events which do not belong to a protocol,
+// such as wallet, user and echo events.
+const PlatformUpvest = "upvest"
+
+// platformNouns are the event nouns of the upvest platform, protocolNouns
+// those of blockchain protocols.
+var (
+	platformNouns = []string{EventNounWallet, EventNounUser, EventNounEcho}
+	protocolNouns = []string{EventNounTransaction, EventNounBlock}
+)
+
+// NewEventFilter returns a filter for the events of a noun and verb. Either
+// may be EventWildcard. Filters of transaction and block events must be
+// restricted to a protocol with ForProtocol.
+//
+// Usage:
+//
+//	scope, err := upvest.NewEventFilter(upvest.EventNounTransaction, upvest.EventVerbConfirmed).
+//		ForProtocol("ethereum_ropsten").
+//		ForWallet("0x...").
+//		WithMaxConfirmations(12).
+//		Build()
+func NewEventFilter(noun, verb string) *EventFilter {
+	return &EventFilter{EventNoun: noun, EventVerb: verb}
+}
+
+// ForProtocol restricts the filter to events of a protocol
+func (f *EventFilter) ForProtocol(name string) *EventFilter {
+	f.ProtocolName = name
+	return f
+}
+
+// ForWallet restricts the filter to events of the wallet with an address
+func (f *EventFilter) ForWallet(address string) *EventFilter {
+	f.WalletAddress = address
+	return f
+}
+
+// WithMaxConfirmations makes Upvest send an event for every confirmation of
+// a transaction or block, up to n.
+func (f *EventFilter) WithMaxConfirmations(n int) *EventFilter {
+	f.MaxConfirmations = n
+	return f
+}
+
+// LimitedToApplication restricts the filter to events caused by the
+// application's own users.
+func (f *EventFilter) LimitedToApplication() *EventFilter {
+	f.LimitToApplication = true
+	return f
+}
+
+// Validate reports whether the filter describes a scope Upvest accepts
+func (f *EventFilter) Validate() error {
+	noun, verb := f.EventNoun, f.EventVerb
+	switch {
+	case noun == "" || verb == "":
+		return fmt.Errorf("event filter needs a noun and a verb")
+	case noun != EventWildcard && !contains(platformNouns, noun) && !contains(protocolNouns, noun):
+		return fmt.Errorf("unknown event noun %q", noun)
+	case strings.ContainsAny(verb, ". "):
+		return fmt.Errorf("invalid event verb %q", verb)
+	case contains(protocolNouns, noun) && f.ProtocolName == "":
+		return fmt.Errorf("%s events need a protocol", noun)
+	case contains(platformNouns, noun) && f.ProtocolName != "":
+		return fmt.Errorf("%s events do not belong to a protocol", noun)
+	case strings.ContainsAny(f.ProtocolName, ". "):
+		return fmt.Errorf("invalid protocol name %q", f.ProtocolName)
+	case f.MaxConfirmations < 0:
+		return fmt.Errorf("max confirmations must not be negative")
+	case f.MaxConfirmations > 0 && !contains(protocolNouns, noun):
+		return fmt.Errorf("confirmations only apply to transaction and block events")
+	case f.WalletAddress != "" && noun != EventNounTransaction && noun != EventNounWallet:
+		return fmt.Errorf("only transaction and wallet events can be restricted to a wallet")
+	case strings.ContainsAny(f.WalletAddress, ". "):
+		return fmt.Errorf("invalid wallet address %q", f.WalletAddress)
+	}
+	return nil
+}
+
+// Build validates the filter and returns it in the form sent to Upvest,
+// "platform.noun.verb", followed by the max confirmations and the wallet
+// address if set.
+func (f *EventFilter) Build() (EventFilterScope, error) {
+	if err := f.Validate(); err != nil {
+		return "", err
+	}
+	platform := f.ProtocolName
+	if platform == "" {
+		platform = PlatformUpvest
+	}
+	parts := []string{platform, f.EventNoun, f.EventVerb}
+	if f.MaxConfirmations > 0 || f.WalletAddress != "" {
+		confirmations := EventWildcard
+		if f.MaxConfirmations > 0 {
+			confirmations = strconv.Itoa(f.MaxConfirmations)
+		}
+		parts = append(parts, confirmations)
+	}
+	if f.WalletAddress != "" {
+		parts = append(parts, f.WalletAddress)
+	}
+	return EventFilterScope(strings.Join(parts, ".")), nil
+}
+
+// Parse parses and validates the scope into a filter
+func (s EventFilterScope) Parse() (*EventFilter, error) {
+	parts := strings.Split(string(s), ".")
+	if len(parts) < 3 || len(parts) > 5 {
+		return nil, fmt.Errorf("invalid event filter scope %q", s)
+	}
+	f := &EventFilter{EventNoun: parts[1], EventVerb: parts[2]}
+	if parts[0] != PlatformUpvest {
+		f.ProtocolName = parts[0]
+	}
+	if len(parts) > 3 && parts[3] != EventWildcard {
+		n, err := strconv.Atoi(parts[3])
+		if err != nil {
+			return nil, fmt.Errorf("invalid confirmations in event filter scope %q", s)
+		}
+		f.MaxConfirmations = n
+	}
+	if len(parts) > 4 {
+		f.WalletAddress = parts[4]
+	}
+	if err := f.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid event filter scope %q: %w", s, err)
+	}
+	f.Scope = s
+	return f, nil
+}
+
+// eventFilterType is the type decodeEventFilter converts to.
+var eventFilterType = reflect.TypeOf(EventFilter{})
+
+// decodeEventFilter is a mapstructure decode hook which turns the shapes
+// event filters are returned in into EventFilter values: scope strings,
+// single entry maps from scope to filter, and plain filter objects.
+func decodeEventFilter(from, to reflect.Type, data interface{}) (interface{}, error) {
+	if to != eventFilterType {
+		return data, nil
+	}
+	switch v := data.(type) {
+	case string:
+		f, err := EventFilterScope(v).Parse()
+		if err != nil {
+			// keep filters the client does not know about
+			return EventFilter{Scope: EventFilterScope(v)}, nil
+		}
+		return *f, nil
+	case map[string]interface{}:
+		if len(v) == 1 {
+			for scope, inner := range v {
+				if m, ok := inner.(map[string]interface{}); ok {
+					return filterFields(scope, m), nil
+				}
+			}
+		}
+		return filterFields("", v), nil
+	}
+	return data, nil
+}
+
+// filterFields merges the fields of a filter object with those parsed from
+// its scope, and fixes the misspelled protocol name key.
+func filterFields(scope string, m map[string]interface{}) map[string]interface{} {
+	fields := make(map[string]interface{})
+	if scope != "" {
+		fields["scope"] = scope
+		if f, err := EventFilterScope(scope).Parse(); err == nil {
+			fields["event_noun"] = f.EventNoun
+			fields["event_verb"] = f.EventVerb
+			fields["protocol_name"] = f.ProtocolName
+			fields["max_confirmations"] = f.MaxConfirmations
+			fields["wallet_address"] = f.WalletAddress
+		}
+	}
+	for k, v := range m {
+		if k == "procol_name" {
+			k = "protocol_name"
+		}
+		fields[k] = v
+	}
+	return fields
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
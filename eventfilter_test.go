@@ -0,0 +1,98 @@
+package upvest
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestEventFilterBuild(t *testing.T) {
+	cases := []struct {
+		filter *EventFilter
+		scope  EventFilterScope
+	}{
+		{NewEventFilter(EventNounWallet, EventVerbCreated), "upvest.wallet.created"},
+		{NewEventFilter(EventNounEcho, EventVerbPost), "upvest.echo.post"},
+		{NewEventFilter(EventNounBlock, EventWildcard).ForProtocol("ropsten"), "ropsten.block.*"},
+		{NewEventFilter(EventNounTransaction, EventVerbConfirmed).ForProtocol("ethereum").WithMaxConfirmations(12), "ethereum.transaction.confirmed.12"},
+		{NewEventFilter(EventNounTransaction, EventWildcard).ForProtocol("ethereum").ForWallet("0xabc"), "ethereum.transaction.*.*.0xabc"},
+	}
+	for _, c := range cases {
+		scope, err := c.filter.Build()
+		if err != nil {
+			t.Errorf("Build of %q returned error: %v", c.scope, err)
+			continue
+		}
+		if scope != c.scope {
+			t.Errorf("Expected scope %q, got %q", c.scope, scope)
+		}
+		f, err := scope.Parse()
+		if err != nil {
+			t.Errorf("Parse of %q returned error: %v", scope, err)
+			continue
+		}
+		if f.EventNoun != c.filter.EventNoun || f.EventVerb != c.filter.EventVerb || f.ProtocolName != c.filter.ProtocolName ||
+			f.MaxConfirmations != c.filter.MaxConfirmations || f.WalletAddress != c.filter.WalletAddress {
+			t.Errorf("Parse of %q returned %+v, expected %+v", scope, f, c.filter)
+		}
+	}
+}
+
+func TestEventFilterValidate(t *testing.T) {
+	invalid := []*EventFilter{
+		NewEventFilter("", EventVerbCreated),
+		NewEventFilter("invoice", EventVerbCreated),
+		NewEventFilter(EventNounTransaction, EventVerbConfirmed),
+		NewEventFilter(EventNounWallet, EventVerbCreated).ForProtocol("ethereum"),
+		NewEventFilter(EventNounUser, EventVerbCreated).WithMaxConfirmations(3),
+		NewEventFilter(EventNounBlock, EventWildcard).ForProtocol("ethereum").ForWallet("0xabc"),
+		NewEventFilter(EventNounTransaction, EventVerbConfirmed).ForProtocol("ethereum").WithMaxConfirmations(-1),
+	}
+	for _, f := range invalid {
+		if _, err := f.Build(); err == nil {
+			t.Errorf("Expected Build of %+v to fail", f)
+		}
+	}
+
+	for _, s := range []EventFilterScope{"upvest.wallet", "upvest.wallet.created.x", "ethereum.transaction.confirmed.1.0xabc.extra"} {
+		if _, err := s.Parse(); err == nil {
+			t.Errorf("Expected Parse of %q to fail", s)
+		}
+	}
+
+	_, err := tenancyTestClient.Webhook.Create(&WebhookParams{EventFilters: []EventFilterScope{"upvest.invoice.paid"}})
+	if !errors.Is(err, ErrValidation) {
+		t.Errorf("Expected Create with an invalid scope to fail with ErrValidation, got %v", err)
+	}
+}
+
+func TestDecodeWebhookEventFilters(t *testing.T) {
+	data := map[string]interface{}{
+		"id": "w1",
+		"event_filters": []interface{}{
+			"upvest.wallet.created",
+			map[string]interface{}{
+				"ethereum.transaction.confirmed.12": map[string]interface{}{"limit_to_application": true},
+			},
+			map[string]interface{}{"event_noun": "user", "event_verb": "created", "procol_name": ""},
+			map[string]interface{}{"event_noun": "block", "event_verb": "*", "procol_name": "ropsten"},
+		},
+	}
+	wh := &Webhook{}
+	if err := mapstruct(data, wh); err != nil {
+		t.Fatalf("mapstruct returned error: %v", err)
+	}
+	expected := []EventFilter{
+		{EventNoun: EventNounWallet, EventVerb: EventVerbCreated, Scope: "upvest.wallet.created"},
+		{EventNoun: EventNounTransaction, EventVerb: EventVerbConfirmed, ProtocolName: "ethereum", MaxConfirmations: 12, LimitToApplication: true, Scope: "ethereum.transaction.confirmed.12"},
+		{EventNoun: EventNounUser, EventVerb: EventVerbCreated},
+		{EventNoun: EventNounBlock, EventVerb: EventWildcard, ProtocolName: "ropsten"},
+	}
+	if len(wh.EventFilters) != len(expected) {
+		t.Fatalf("Expected %d event filters, got %+v", len(expected), wh.EventFilters)
+	}
+	for i, f := range wh.EventFilters {
+		if f != expected[i] {
+			t.Errorf("Expected event filter %+v, got %+v", expected[i], f)
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package upvest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
+// Event nouns, the kinds of resources events are about
+const (
+	EventNounWallet      = "wallet"
+	EventNounTransaction = "transaction"
+	EventNounUser        = "user"
+	EventNounEcho        = "echo"
+	EventNounBlock       = "block"
+)
+
+// Event verbs, what happened to the resource
+const (
+	EventVerbCreated   = "created"
+	EventVerbDeleted   = "deleted"
+	EventVerbPending   = "pending"
+	EventVerbConfirmed = "confirmed"
+	EventVerbFailed    = "failed"
+	EventVerbPost      = "post"
+)
+
+// EventWildcard in an event filter scope matches any noun or verb
+const EventWildcard = "*"
+
+// WalletEvent is an event about a wallet, e.g. its creation
+type WalletEvent struct {
+	*Event
+	Wallet Wallet
+}
+
+// TransactionEvent is an event about a transaction being pending, confirmed
+// or failed.
+type TransactionEvent struct {
+	*Event
+	Transaction Transaction
+	// Confirmations is the number of blocks mined on top of the
+	// transaction's block when the event was sent.
+	Confirmations int
+}
+
+// UserEvent is an event about a user of the tenancy
+type UserEvent struct {
+	*Event
+	User User
+}
+
+// EchoEvent is sent to test a webhook
+type EchoEvent struct {
+	*Event
+	Echo string
+}
+
+// DecodeEvent decodes the data of e into the type for its noun: a
+// *WalletEvent, *TransactionEvent, *UserEvent or *EchoEvent. Events of other
+// nouns are returned unchanged.
+func DecodeEvent(e *Event) (interface{}, error) {
+	var data map[string]interface{}
+	if len(e.Data) > 0 {
+		dec := json.NewDecoder(bytes.NewReader(e.Data))
+		dec.UseNumber()
+		if err := dec.Decode(&data); err != nil {
+			return nil, fmt.Errorf("could not decode data of %s event %s: %w", e.Type(), e.ID, err)
+		}
+	}
+
+	var (
+		typed interface{}
+		err   error
+	)
+	switch e.EventNoun {
+	case EventNounWallet:
+		we := &WalletEvent{Event: e}
+		err = mapstruct(data, &we.Wallet)
+		typed = we
+	case EventNounTransaction:
+		te := &TransactionEvent{Event: e}
+		if err = mapstruct(data, &te.Transaction); err == nil {
+			err = mapstruct(data["confirmations"], &te.Confirmations)
+		}
+		typed = te
+	case EventNounUser:
+		ue := &UserEvent{Event: e}
+		err = mapstruct(data, &ue.User)
+		typed = ue
+	case EventNounEcho:
+		ee := &EchoEvent{Event: e}
+		err = mapstruct(data["echo"], &ee.Echo)
+		typed = ee
+	default:
+		return e, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not decode data of %s event %s: %w", e.Type(), e.ID, err)
+	}
+	return typed, nil
+}
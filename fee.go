@@ -0,0 +1,312 @@
+package upvest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ErrFeeAboveCeiling is returned when an estimated fee exceeds the ceiling
+// given to WithEstimatedFee.
+var ErrFeeAboveCeiling = errors.New("estimated fee exceeds ceiling")
+
+// ErrFeeEstimationUnsupported is returned when WithEstimatedFee is passed to
+// a method which can not fill in an estimated fee.
+var ErrFeeEstimationUnsupported = errors.New("fee estimation is only supported by Create")
+
+// FeeSpeed selects one of the suggested fees of a FeeEstimate
+type FeeSpeed string
+
+// Speeds of the suggested fees
+const (
+	FeeSlow     FeeSpeed = "slow"
+	FeeStandard FeeSpeed = "standard"
+	FeeFast     FeeSpeed = "fast"
+)
+
+// FeeEstimate holds suggested fees of a transaction, in the minor units of
+// the protocol's native asset. Like Transaction.Fee, their exponent is 0.
+type FeeEstimate struct {
+	Slow     Amount
+	Standard Amount
+	Fast     Amount
+}
+
+// For returns the suggested fee for speed
+func (e *FeeEstimate) For(speed FeeSpeed) (Amount, error) {
+	switch speed {
+	case FeeSlow:
+		return e.Slow, nil
+	case FeeStandard, "":
+		return e.Standard, nil
+	case FeeFast:
+		return e.Fast, nil
+	}
+	return Amount{}, fmt.Errorf("unknown fee speed %q", speed)
+}
+
+// FeeEstimator suggests fees for transactions of an asset on a protocol and
+// network, such as "ethereum" and "ropsten".
+type FeeEstimator interface {
+	EstimateFee(ctx context.Context, protocol, network, assetID string) (*FeeEstimate, error)
+}
+
+// Defaults of HistoricalFeeEstimator
+const (
+	DefaultFeeBlocks          = 5
+	DefaultFeeSamplesPerBlock = 4
+	DefaultFeeCacheTTL        = 15 * time.Second
+	DefaultGasLimit           = 21000
+)
+
+// feeFetchConcurrency limits the requests a HistoricalFeeEstimator makes at a time.
+const feeFetchConcurrency = 8
+
+// HistoricalFeeEstimator is a FeeEstimator deriving fees of Ethereum
+// transactions from the gas prices paid in recent blocks: the 25th, 50th and
+// 75th percentile make the slow, standard and fast fees. A fee is the gas
+// price times the gas limit of the asset's transfers. The sampled gas prices
+// are cached per protocol and network, so that submissions in quick
+// succession do not sample the chain again.
+//
+// Usage:
+//
+//	estimator := &upvest.HistoricalFeeEstimator{Historical: tenancy.Historical}
+//	estimate, err := estimator.EstimateFee(ctx, "ethereum", "ropsten", assetID)
+type HistoricalFeeEstimator struct {
+	Historical *HistoricalDataService
+
+	// Blocks is the number of recent blocks to sample. A zero value means
+	// DefaultFeeBlocks.
+	Blocks int
+	// SamplesPerBlock is the number of transactions sampled from each
+	// block. A zero value means DefaultFeeSamplesPerBlock.
+	SamplesPerBlock int
+	// GasLimits maps asset IDs to the gas limit of their transfers, e.g. of
+	// ERC20 tokens. Other assets use DefaultGasLimit.
+	GasLimits map[string]int64
+	// CacheTTL is how long sampled gas prices are reused. A zero value means
+	// DefaultFeeCacheTTL, a negative one disables the cache.
+	CacheTTL time.Duration
+
+	mu    sync.Mutex
+	cache map[string]sampledPrices
+}
+
+// sampledPrices are the sorted gas prices sampled from a chain
+type sampledPrices struct {
+	prices  []*big.Int
+	sampled time.Time
+}
+
+// EstimateFee suggests fees from recent blocks of the chain. ERC20 tokens
+// are transferred on the Ethereum chain.
+func (fe *HistoricalFeeEstimator) EstimateFee(ctx context.Context, protocol, network, assetID string) (*FeeEstimate, error) {
+	switch protocol {
+	case "ethereum":
+	case "erc20":
+		protocol = "ethereum"
+	default:
+		return nil, fmt.Errorf("fee estimation is not supported for protocol %s", protocol)
+	}
+	prices, err := fe.gasPrices(ctx, protocol, network)
+	if err != nil {
+		return nil, err
+	}
+
+	gasLimit, ok := fe.GasLimits[assetID]
+	if !ok {
+		gasLimit = DefaultGasLimit
+	}
+	fee := func(percentile int) Amount {
+		price := prices[(len(prices)-1)*percentile/100]
+		return NewAmount(new(big.Int).Mul(price, big.NewInt(gasLimit)), 0)
+	}
+	return &FeeEstimate{Slow: fee(25), Standard: fee(50), Fast: fee(75)}, nil
+}
+
+// gasPrices returns the sorted gas prices of recent transactions of a chain,
+// from the cache if they were sampled recently.
+func (fe *HistoricalFeeEstimator) gasPrices(ctx context.Context, protocol, network string) ([]*big.Int, error) {
+	ttl := fe.CacheTTL
+	if ttl == 0 {
+		ttl = DefaultFeeCacheTTL
+	}
+	key := protocol + "_" + network
+	fe.mu.Lock()
+	cached, ok := fe.cache[key]
+	fe.mu.Unlock()
+	if ok && time.Since(cached.sampled) < ttl {
+		return cached.prices, nil
+	}
+
+	prices, err := fe.samplePrices(ctx, protocol, network)
+	if err != nil {
+		return nil, err
+	}
+	if ttl > 0 {
+		fe.mu.Lock()
+		if fe.cache == nil {
+			fe.cache = make(map[string]sampledPrices)
+		}
+		fe.cache[key] = sampledPrices{prices: prices, sampled: time.Now()}
+		fe.mu.Unlock()
+	}
+	return prices, nil
+}
+
+// samplePrices fetches the gas prices of the first transactions of recent
+// blocks, several at a time.
+func (fe *HistoricalFeeEstimator) samplePrices(ctx context.Context, protocol, network string) ([]*big.Int, error) {
+	blocks := fe.Blocks
+	if blocks <= 0 {
+		blocks = DefaultFeeBlocks
+	}
+	samples := fe.SamplesPerBlock
+	if samples <= 0 {
+		samples = DefaultFeeSamplesPerBlock
+	}
+
+	status, err := fe.Historical.GetStatusContext(ctx, protocol, network)
+	if err != nil {
+		return nil, fmt.Errorf("could not retrieve chain status: %w", err)
+	}
+	latest, err := strconv.ParseInt(status.Latest, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid latest block %q: %w", status.Latest, err)
+	}
+
+	var numbers []int64
+	for n := latest; n > latest-int64(blocks) && n >= 0; n-- {
+		numbers = append(numbers, n)
+	}
+	hashes := make([][]string, len(numbers))
+	err = fetchConcurrently(ctx, len(numbers), func(ctx context.Context, i int) error {
+		block, err := fe.Historical.GetBlockContext(ctx, protocol, network, strconv.FormatInt(numbers[i], 10))
+		if err != nil {
+			return fmt.Errorf("could not retrieve block %d: %w", numbers[i], err)
+		}
+		if len(block.Transactions) > samples {
+			block.Transactions = block.Transactions[:samples]
+		}
+		hashes[i] = block.Transactions
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var sampled []string
+	for _, h := range hashes {
+		sampled = append(sampled, h...)
+	}
+	found := make([]*big.Int, len(sampled))
+	err = fetchConcurrently(ctx, len(sampled), func(ctx context.Context, i int) error {
+		txn, err := fe.Historical.GetTxByHashContext(ctx, protocol, network, sampled[i])
+		if err != nil {
+			return fmt.Errorf("could not retrieve transaction %s: %w", sampled[i], err)
+		}
+		if price, ok := new(big.Int).SetString(txn.GasPrice, 0); ok {
+			found[i] = price
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var prices []*big.Int
+	for _, price := range found {
+		if price != nil {
+			prices = append(prices, price)
+		}
+	}
+	if len(prices) == 0 {
+		return nil, fmt.Errorf("no transactions in the last %d blocks to estimate fees from", blocks)
+	}
+	sort.Slice(prices, func(i, j int) bool { return prices[i].Cmp(prices[j]) < 0 })
+	return prices, nil
+}
+
+// fetchConcurrently calls fetch for 0 to n-1, feeFetchConcurrency at a time.
+// It returns the first error, cancelling the context of the other calls.
+func fetchConcurrently(ctx context.Context, n int, fetch func(ctx context.Context, i int) error) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var (
+		wg       sync.WaitGroup
+		once     sync.Once
+		firstErr error
+	)
+	sem := make(chan struct{}, feeFetchConcurrency)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int) {
+			defer func() { <-sem; wg.Done() }()
+			if err := fetch(ctx, i); err != nil {
+				once.Do(func() {
+					firstErr = err
+					cancel()
+				})
+			}
+		}(i)
+	}
+	wg.Wait()
+	return firstErr
+}
+
+// WithEstimatedFee fills the fee of a transaction created with Create with
+// the fee suggested by estimator for speed. Other ways of creating
+// transactions reject it with ErrFeeEstimationUnsupported. The submission fails with
+// ErrFeeAboveCeiling if the fee exceeds ceiling in minor units, unless
+// ceiling is zero. The fee is left out of the idempotency fingerprint, so
+// that resubmissions under the same key may be estimated differently.
+func WithEstimatedFee(estimator FeeEstimator, speed FeeSpeed, ceiling Amount) SubmitOption {
+	return func(o *submitOptions) {
+		o.feeEstimator = estimator
+		o.feeSpeed = speed
+		o.feeCeiling = ceiling
+	}
+}
+
+// estimateFee returns a copy of tp with the fee suggested by the estimator of o.
+func (s *TransactionService) estimateFee(ctx context.Context, walletID string, tp *TransactionParams, o *submitOptions) (*TransactionParams, error) {
+	walletProtocol, err := s.walletProtocol(ctx, walletID)
+	if err != nil {
+		return nil, err
+	}
+	protocol, network := splitProtocol(walletProtocol)
+	estimate, err := o.feeEstimator.EstimateFee(ctx, protocol, network, tp.AssetID)
+	if err != nil {
+		return nil, fmt.Errorf("could not estimate fee: %w", err)
+	}
+	fee, err := estimate.For(o.feeSpeed)
+	if err != nil {
+		return nil, err
+	}
+	if !o.feeCeiling.IsZero() && fee.Minor().Cmp(o.feeCeiling.Minor()) > 0 {
+		return nil, fmt.Errorf("%w: %s > %s", ErrFeeAboveCeiling, fee.MinorString(), o.feeCeiling.MinorString())
+	}
+	estimated := *tp
+	estimated.Fee = fee
+	return &estimated, nil
+}
+
+// rejectEstimatedFee returns ErrFeeEstimationUnsupported if opts ask for an
+// estimated fee.
+func rejectEstimatedFee(opts []SubmitOption) error {
+	o := &submitOptions{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	if o.feeEstimator != nil {
+		return ErrFeeEstimationUnsupported
+	}
+	return nil
+}
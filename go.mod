@@ -1,10 +1,12 @@
 module github.com/upvestco/upvest-go
 
-go 1.12
+go 1.13
 
 require (
+	github.com/decred/dcrd/dcrec/secp256k1/v3 v3.0.0
 	github.com/google/go-querystring v1.0.0
 	github.com/google/uuid v1.1.1
 	github.com/mitchellh/mapstructure v1.1.2
 	github.com/pkg/errors v0.8.1
+	golang.org/x/crypto v0.0.0-20201221181555-eec23a3978ad
 )
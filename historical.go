@@ -1,6 +1,7 @@
 package upvest
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 
@@ -48,11 +49,12 @@ type HDTransaction struct {
 
 // HDBalance reprents balance of an asset or contract
 // if native asset balance,contract is set to address of the contract
+// The balance is in minor units; its exponent is 0 as the asset is not known.
 type HDBalance struct {
 	ID               string `json:"id"`
 	Address          string `json:"address"`
 	Contract         string `json:"contract"`
-	Balance          string `json:"balance"`
+	Balance          Amount `json:"balance"`
 	TransactionHash  string `json:"transactionHash"`
 	TransactionIndex string `json:"transactionindex"`
 	BlockHash        string `json:"blockHash"`
@@ -90,11 +92,16 @@ type HistoricalDataService struct {
 
 // GetTxByHash transaction (single) by txhash
 func (s *HistoricalDataService) GetTxByHash(protocol, network, txhash string) (*HDTransaction, error) {
+	return s.GetTxByHashContext(context.Background(), protocol, network, txhash)
+}
+
+// GetTxByHashContext is like GetTxByHash but takes a context.
+func (s *HistoricalDataService) GetTxByHashContext(ctx context.Context, protocol, network, txhash string) (*HDTransaction, error) {
 	u := fmt.Sprintf("/data/%s/%s/transaction/%s", protocol, network, txhash)
 	p := NewParams(s.auth)
 	txn := &HDTransaction{}
 	r := &hdresult{}
-	err := s.client.Call(http.MethodGet, u, nil, r, p)
+	err := s.client.CallContext(ctx, http.MethodGet, u, nil, r, p)
 	if err == nil {
 		err = mapstruct(r.Result, txn)
 	}
@@ -103,6 +110,11 @@ func (s *HistoricalDataService) GetTxByHash(protocol, network, txhash string) (*
 
 // GetTransactions returns transactions that have been sent to and received by an address
 func (s *HistoricalDataService) GetTransactions(protocol, network, address string, opts *TxFilters) (*HDTransactionList, error) {
+	return s.GetTransactionsContext(context.Background(), protocol, network, address, opts)
+}
+
+// GetTransactionsContext is like GetTransactions but takes a context.
+func (s *HistoricalDataService) GetTransactionsContext(ctx context.Context, protocol, network, address string, opts *TxFilters) (*HDTransactionList, error) {
 	u := fmt.Sprintf("/data/%s/%s/transactions/%s", protocol, network, address)
 	if opts != nil {
 		var err error
@@ -114,9 +126,9 @@ func (s *HistoricalDataService) GetTransactions(protocol, network, address strin
 	p := NewParams(s.auth)
 	txns := &HDTransactionList{}
 	r := &hdresult{}
-	err := s.client.Call(http.MethodGet, u, nil, r, p)
+	err := s.client.CallContext(ctx, http.MethodGet, u, nil, r, p)
 	if err != nil {
-		return nil, errors.Wrap(err, "error retrieving transactions")
+		return nil, fmt.Errorf("error retrieving transactions: %w", err)
 	}
 	err = mapstruct(r.Result, txns)
 	return txns, err
@@ -124,11 +136,16 @@ func (s *HistoricalDataService) GetTransactions(protocol, network, address strin
 
 // GetBlock returns block details by blockNumber
 func (s *HistoricalDataService) GetBlock(protocol, network, blockNumber string) (*HDBlock, error) {
+	return s.GetBlockContext(context.Background(), protocol, network, blockNumber)
+}
+
+// GetBlockContext is like GetBlock but takes a context.
+func (s *HistoricalDataService) GetBlockContext(ctx context.Context, protocol, network, blockNumber string) (*HDBlock, error) {
 	u := fmt.Sprintf("/data/%s/%s/block/%s", protocol, network, blockNumber)
 	p := NewParams(s.auth)
 	block := &HDBlock{}
 	r := &hdresult{}
-	err := s.client.Call(http.MethodGet, u, nil, r, p)
+	err := s.client.CallContext(ctx, http.MethodGet, u, nil, r, p)
 	if err == nil {
 		err = mapstruct(r.Result, block)
 	}
@@ -137,11 +154,16 @@ func (s *HistoricalDataService) GetBlock(protocol, network, blockNumber string)
 
 // GetAssetBalance returns native asset balance by address
 func (s *HistoricalDataService) GetAssetBalance(protocol, network, address string) (*HDBalance, error) {
+	return s.GetAssetBalanceContext(context.Background(), protocol, network, address)
+}
+
+// GetAssetBalanceContext is like GetAssetBalance but takes a context.
+func (s *HistoricalDataService) GetAssetBalanceContext(ctx context.Context, protocol, network, address string) (*HDBalance, error) {
 	u := fmt.Sprintf("/data/%s/%s/balance/%s", protocol, network, address)
 	p := NewParams(s.auth)
 	hdbalance := &HDBalance{}
 	r := &hdresult{}
-	err := s.client.Call(http.MethodGet, u, nil, r, p)
+	err := s.client.CallContext(ctx, http.MethodGet, u, nil, r, p)
 	if err == nil {
 		err = mapstruct(r.Result, hdbalance)
 
@@ -151,11 +173,16 @@ func (s *HistoricalDataService) GetAssetBalance(protocol, network, address strin
 
 // GetContractBalance returns contract balance by address
 func (s *HistoricalDataService) GetContractBalance(protocol, network, address, contractAddr string) (*HDBalance, error) {
+	return s.GetContractBalanceContext(context.Background(), protocol, network, address, contractAddr)
+}
+
+// GetContractBalanceContext is like GetContractBalance but takes a context.
+func (s *HistoricalDataService) GetContractBalanceContext(ctx context.Context, protocol, network, address, contractAddr string) (*HDBalance, error) {
 	u := fmt.Sprintf("/data/%s/%s/balance/%s/%s", protocol, network, address, contractAddr)
 	p := NewParams(s.auth)
 	hdbalance := &HDBalance{}
 	r := &hdresult{}
-	err := s.client.Call(http.MethodGet, u, nil, r, p)
+	err := s.client.CallContext(ctx, http.MethodGet, u, nil, r, p)
 	if err == nil {
 		err = mapstruct(r.Result, hdbalance)
 	}
@@ -164,11 +191,16 @@ func (s *HistoricalDataService) GetContractBalance(protocol, network, address, c
 
 // GetStatus return Historical Data API status
 func (s *HistoricalDataService) GetStatus(protocol, network string) (*HDStatus, error) {
+	return s.GetStatusContext(context.Background(), protocol, network)
+}
+
+// GetStatusContext is like GetStatus but takes a context.
+func (s *HistoricalDataService) GetStatusContext(ctx context.Context, protocol, network string) (*HDStatus, error) {
 	u := fmt.Sprintf("/data/%s/%s/status", protocol, network)
 	p := NewParams(s.auth)
 	hdstatus := &HDStatus{}
 	r := &hdresult{}
-	err := s.client.Call(http.MethodGet, u, nil, r, p)
+	err := s.client.CallContext(ctx, http.MethodGet, u, nil, r, p)
 	if err == nil {
 		err = mapstruct(r.Result, hdstatus)
 	}
@@ -0,0 +1,147 @@
+package upvest
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// IdempotencyKeyHeader is the HTTP header carrying the idempotency key of a
+// transaction submission.
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+// ErrIdempotencyKeyReused is returned when an idempotency key is presented
+// again with a different transaction.
+var ErrIdempotencyKeyReused = errors.New("idempotency key was already used for a different transaction")
+
+// IdempotencyRecord tracks the submission of a transaction under an
+// idempotency key.
+type IdempotencyRecord struct {
+	Key      string `json:"key"`
+	WalletID string `json:"wallet_id"`
+	// Fingerprint identifies the submitted transaction, so that a key can not
+	// accidentally be reused for another one.
+	Fingerprint string `json:"fingerprint"`
+	// TransactionID is set once the submission is known to have succeeded.
+	TransactionID string `json:"transaction_id,omitempty"`
+	// PriorTransactionIDs are the wallet's transactions before the first
+	// attempt, which are never mistaken for the submitted one. It is nil if
+	// the submission can not be recognised among the wallet's transactions.
+	PriorTransactionIDs []string  `json:"prior_transaction_ids"`
+	Attempts            int       `json:"attempts"`
+	CreatedAt           time.Time `json:"created_at"`
+}
+
+// IdempotencyStore persists idempotency records between attempts.
+// Get returns a nil record and a nil error if no record exists for key.
+// Implementations must be safe for concurrent use.
+type IdempotencyStore interface {
+	Get(key string) (*IdempotencyRecord, error)
+	Put(rec *IdempotencyRecord) error
+}
+
+// MemoryIdempotencyStore is an IdempotencyStore keeping records in memory.
+type MemoryIdempotencyStore struct {
+	mu      sync.RWMutex
+	records map[string]IdempotencyRecord
+}
+
+// NewMemoryIdempotencyStore creates an empty in-memory idempotency store
+func NewMemoryIdempotencyStore() *MemoryIdempotencyStore {
+	return &MemoryIdempotencyStore{records: make(map[string]IdempotencyRecord)}
+}
+
+// Get returns the record stored for key
+func (s *MemoryIdempotencyStore) Get(key string) (*IdempotencyRecord, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	rec, ok := s.records[key]
+	if !ok {
+		return nil, nil
+	}
+	return &rec, nil
+}
+
+// Put stores the record, replacing any previous one with the same key
+func (s *MemoryIdempotencyStore) Put(rec *IdempotencyRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.records[rec.Key] = *rec
+	return nil
+}
+
+// FileIdempotencyStore is an IdempotencyStore keeping each record as a JSON
+// file in a directory, so that submissions survive a restart.
+type FileIdempotencyStore struct {
+	dir string
+}
+
+// NewFileIdempotencyStore creates an idempotency store in dir, which is
+// created if needed.
+func NewFileIdempotencyStore(dir string) (*FileIdempotencyStore, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, errors.Wrap(err, "could not create idempotency directory")
+	}
+	return &FileIdempotencyStore{dir: dir}, nil
+}
+
+func (s *FileIdempotencyStore) filename(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:]) + ".json"
+}
+
+// Get returns the record stored for key
+func (s *FileIdempotencyStore) Get(key string) (*IdempotencyRecord, error) {
+	data, err := ioutil.ReadFile(filepath.Join(s.dir, s.filename(key)))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	rec := &IdempotencyRecord{}
+	if err := json.Unmarshal(data, rec); err != nil {
+		return nil, errors.Wrap(err, "could not decode idempotency record")
+	}
+	return rec, nil
+}
+
+// Put stores the record, replacing any previous one with the same key
+func (s *FileIdempotencyStore) Put(rec *IdempotencyRecord) error {
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(s.dir, s.filename(rec.Key), data)
+}
+
+// fingerprint hashes a request body, leaving out the password, so that
+// submissions of the same transaction can be recognised.
+func fingerprint(path string, body interface{}) (string, error) {
+	buf, err := json.Marshal(body)
+	if err != nil {
+		return "", err
+	}
+	var fields map[string]interface{}
+	dec := json.NewDecoder(bytes.NewReader(buf))
+	dec.UseNumber()
+	if err := dec.Decode(&fields); err != nil {
+		return "", err
+	}
+	delete(fields, "password")
+	// maps are marshalled with sorted keys, which makes this stable
+	buf, err = json.Marshal(fields)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(append([]byte(path), buf...))
+	return hex.EncodeToString(sum[:]), nil
+}
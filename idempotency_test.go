@@ -0,0 +1,215 @@
+package upvest
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// txnServer fakes the transaction endpoints of a single wallet. The first
+// submission is created but answered with a 503, like a request timing out
+// after the transaction landed, unless lose is set, in which case it is not
+// created at all.
+type txnServer struct {
+	*httptest.Server
+	lose  bool
+	posts int
+	lists int
+	keys  []string
+	txns  []map[string]interface{}
+}
+
+func newTxnServer() *txnServer {
+	ts := &txnServer{}
+	ts.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		const base = "/1.0/kms/wallets/w1/transactions/"
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/1.0/kms/wallets/w1":
+			json.NewEncoder(w).Encode(map[string]interface{}{"id": "w1", "protocol": "ethereum_ropsten"})
+		case r.Method == http.MethodPost && r.URL.Path == base:
+			ts.posts++
+			ts.keys = append(ts.keys, r.Header.Get(IdempotencyKeyHeader))
+			var tp map[string]interface{}
+			json.NewDecoder(r.Body).Decode(&tp)
+			if ts.posts == 1 && ts.lose {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			txn := map[string]interface{}{
+				"id":        "t" + strconv.Itoa(len(ts.txns)+1),
+				"wallet_id": "w1",
+				"asset_id":  tp["asset_id"],
+				"recipient": tp["recipient"],
+				"quantity":  "100",
+				"fee":       "10",
+				"status":    "PENDING",
+			}
+			ts.txns = append(ts.txns, txn)
+			if ts.posts == 1 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			json.NewEncoder(w).Encode(txn)
+		case r.Method == http.MethodGet && r.URL.Path == base:
+			ts.lists++
+			json.NewEncoder(w).Encode(map[string]interface{}{"results": ts.txns})
+		case r.Method == http.MethodGet && strings.HasPrefix(r.URL.Path, base):
+			for _, txn := range ts.txns {
+				if txn["id"] == strings.TrimPrefix(r.URL.Path, base) {
+					json.NewEncoder(w).Encode(txn)
+					return
+				}
+			}
+			w.WriteHeader(http.StatusNotFound)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	return ts
+}
+
+func newIdempotencyTestService(url string) *TransactionService {
+	c := NewClient(url, nil)
+	c.Retry.InitialBackoff = time.Millisecond
+	c.IdempotencyStore = NewMemoryIdempotencyStore()
+	return &TransactionService{service{c, nil}}
+}
+
+var idempotencyTestParams = &TransactionParams{
+	Password:  "secret",
+	AssetID:   "a1",
+	Quantity:  AmountFromMinor(100, 0),
+	Fee:       AmountFromMinor(10, 0),
+	Recipient: "0xf9b44Ba370CAfc6a7AF77D0BDB0d50106823D91b",
+}
+
+func TestCreateTransactionRetryFindsLanded(t *testing.T) {
+	ts := newTxnServer()
+	defer ts.Close()
+	s := newIdempotencyTestService(ts.URL)
+
+	txn, err := s.Create("w1", idempotencyTestParams)
+	if err != nil {
+		t.Fatalf("CREATE Transaction returned error: %v", err)
+	}
+	if txn.ID != "t1" {
+		t.Errorf("Expected landed transaction t1, got %+v", txn)
+	}
+	if ts.posts != 1 {
+		t.Errorf("Expected transaction to be submitted once, got %d", ts.posts)
+	}
+	if ts.keys[0] == "" {
+		t.Errorf("Expected idempotency key header to be set")
+	}
+}
+
+func TestCreateTransactionRetryIgnoresEarlier(t *testing.T) {
+	ts := newTxnServer()
+	defer ts.Close()
+	ts.txns = append(ts.txns, map[string]interface{}{
+		"id":        "t0",
+		"wallet_id": "w1",
+		"asset_id":  "a1",
+		"recipient": idempotencyTestParams.Recipient,
+		"quantity":  "100",
+		"fee":       "10",
+		"status":    "PENDING",
+	})
+	ts.lose = true
+	s := newIdempotencyTestService(ts.URL)
+
+	// the identical earlier payment must not be taken for this one
+	txn, err := s.Create("w1", idempotencyTestParams)
+	if err != nil {
+		t.Fatalf("CREATE Transaction returned error: %v", err)
+	}
+	if txn.ID == "t0" {
+		t.Errorf("Expected a new transaction, got the earlier %s", txn.ID)
+	}
+	if ts.posts != 2 || len(ts.txns) != 2 {
+		t.Errorf("Expected the transaction to be resubmitted, got %d posts and %d transactions", ts.posts, len(ts.txns))
+	}
+}
+
+func TestCreateTransactionWithoutResubmission(t *testing.T) {
+	ts := newTxnServer()
+	defer ts.Close()
+	c := NewClient(ts.URL, nil)
+	c.Retry = nil
+	s := &TransactionService{service{c, nil}}
+
+	// the submission can neither be retried nor resumed, so the wallet's
+	// transactions are not listed
+	if _, err := s.Create("w1", idempotencyTestParams); err == nil {
+		t.Error("Expected the failed submission to return an error")
+	}
+	if ts.lists != 0 || ts.posts != 1 {
+		t.Errorf("Expected a single post without listing, got %d posts and %d lists", ts.posts, ts.lists)
+	}
+}
+
+// fixedFee estimates the same fee for every speed
+type fixedFee int64
+
+func (f fixedFee) EstimateFee(ctx context.Context, protocol, network, assetID string) (*FeeEstimate, error) {
+	fee := AmountFromMinor(int64(f), 0)
+	return &FeeEstimate{Slow: fee, Standard: fee, Fast: fee}, nil
+}
+
+func TestCreateTransactionResumeWithNewEstimate(t *testing.T) {
+	ts := newTxnServer()
+	defer ts.Close()
+	s := newIdempotencyTestService(ts.URL)
+	retry := s.client.Retry
+	s.client.Retry = nil
+
+	tp := *idempotencyTestParams
+	tp.Fee = Amount{}
+	// the transaction lands with the estimated fee of 10, but the response is lost
+	if _, err := s.Create("w1", &tp, WithIdempotencyKey("k1"), WithEstimatedFee(fixedFee(10), FeeStandard, Amount{})); err == nil {
+		t.Fatal("Expected the first submission to fail")
+	}
+
+	// resuming with another estimate must recognise the landed transaction
+	s.client.Retry = retry
+	txn, err := s.Create("w1", &tp, WithIdempotencyKey("k1"), WithEstimatedFee(fixedFee(20), FeeStandard, Amount{}))
+	if err != nil {
+		t.Fatalf("CREATE Transaction returned error: %v", err)
+	}
+	if txn.ID != "t1" || ts.posts != 1 {
+		t.Errorf("Expected the landed transaction t1 without resubmission, got %s after %d posts", txn.ID, ts.posts)
+	}
+}
+
+func TestCreateTransactionKnownKey(t *testing.T) {
+	ts := newTxnServer()
+	defer ts.Close()
+	s := newIdempotencyTestService(ts.URL)
+
+	if _, err := s.Create("w1", idempotencyTestParams, WithIdempotencyKey("k1")); err != nil {
+		t.Fatalf("CREATE Transaction returned error: %v", err)
+	}
+	if ts.keys[0] != "k1" {
+		t.Errorf("Expected idempotency key k1, got %s", ts.keys[0])
+	}
+
+	// resubmitting under the same key must not post again
+	txn, err := s.Create("w1", idempotencyTestParams, WithIdempotencyKey("k1"))
+	if err != nil {
+		t.Fatalf("CREATE Transaction returned error: %v", err)
+	}
+	if txn.ID != "t1" || ts.posts != 1 {
+		t.Errorf("Expected transaction t1 without resubmission, got %s after %d posts", txn.ID, ts.posts)
+	}
+
+	other := *idempotencyTestParams
+	other.Quantity = AmountFromMinor(200, 0)
+	if _, err := s.Create("w1", &other, WithIdempotencyKey("k1")); err != ErrIdempotencyKeyReused {
+		t.Errorf("Expected ErrIdempotencyKeyReused, got %v", err)
+	}
+}
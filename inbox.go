@@ -0,0 +1,445 @@
+package upvest
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// DefaultInboxWorkers is the number of events an inbox handles concurrently
+	DefaultInboxWorkers = 4
+	// DefaultInboxPollInterval is how often an inbox looks for events due for a retry
+	DefaultInboxPollInterval = time.Second
+)
+
+// DefaultInboxRetryPolicy returns the retry policy used by new inboxes: five
+// attempts with exponential backoff starting at a second, after which the
+// event is dead lettered.
+func DefaultInboxRetryPolicy() *RetryPolicy {
+	return &RetryPolicy{
+		MaxAttempts:    5,
+		InitialBackoff: time.Second,
+		MaxBackoff:     5 * time.Minute,
+		Multiplier:     2,
+		Jitter:         0.5,
+	}
+}
+
+// InboxMessage is a webhook event kept by an inbox until it has been handled
+type InboxMessage struct {
+	ID          string          `json:"id"`
+	Body        json.RawMessage `json:"body"`
+	Received    time.Time       `json:"received"`
+	Attempts    int             `json:"attempts"`
+	NextAttempt time.Time       `json:"next_attempt"`
+	LastError   string          `json:"last_error,omitempty"`
+}
+
+// InboxStore persists the messages of an inbox.
+// Implementations must be safe for concurrent use.
+type InboxStore interface {
+	// Put stores a message, replacing any pending message with the same ID.
+	Put(m *InboxMessage) error
+	// PutIfAbsent stores a message unless a message with the same ID is
+	// pending, reporting whether it was stored.
+	PutIfAbsent(m *InboxMessage) (bool, error)
+	// Pending returns the messages which have not been handled yet.
+	Pending() ([]*InboxMessage, error)
+	// Delete removes a pending message once it has been handled.
+	Delete(id string) error
+	// DeadLetter moves a message which could not be handled from the
+	// pending to the dead lettered messages.
+	DeadLetter(m *InboxMessage) error
+	// DeadLetters returns the dead lettered messages.
+	DeadLetters() ([]*InboxMessage, error)
+}
+
+// Inbox persists webhook events before the receiver acknowledges them and
+// hands them to a pool of workers. An event stays in the inbox until its
+// handler succeeded, so every event is handled at least once, even if the
+// process stops in between. Events whose handler keeps failing are dead
+// lettered after Retry.MaxAttempts attempts.
+//
+// Usage:
+//
+//	inbox := upvest.NewInbox(store, router.Dispatch)
+//	receiver.Inbox = inbox
+//	go inbox.Run(ctx)
+type Inbox struct {
+	// Workers is the number of events handled concurrently. A zero value
+	// means DefaultInboxWorkers.
+	Workers int
+	// Retry configures when failed events are retried and after how many
+	// attempts they are dead lettered. A nil value means
+	// DefaultInboxRetryPolicy.
+	Retry *RetryPolicy
+	// PollInterval is how often the store is checked for events due for a
+	// retry. A zero value means DefaultInboxPollInterval.
+	PollInterval time.Duration
+
+	store    InboxStore
+	handler  EventHandlerFunc
+	notify   chan struct{}
+	mu       sync.Mutex
+	inFlight map[string]bool
+}
+
+// NewInbox returns an inbox keeping events in store and handling them with handler
+func NewInbox(store InboxStore, handler EventHandlerFunc) *Inbox {
+	return &Inbox{
+		Retry:    DefaultInboxRetryPolicy(),
+		store:    store,
+		handler:  handler,
+		notify:   make(chan struct{}, 1),
+		inFlight: make(map[string]bool),
+	}
+}
+
+// Add persists a raw event and wakes the workers. Once Add returned, the
+// event is handled even if the process stops before. A redelivery of an event
+// which is still pending leaves it as it is, so that its attempts keep
+// counting towards dead lettering.
+func (in *Inbox) Add(id string, body []byte) error {
+	if id == "" {
+		sum := sha256.Sum256(body)
+		id = hex.EncodeToString(sum[:])
+	}
+	now := time.Now()
+	m := &InboxMessage{ID: id, Body: json.RawMessage(body), Received: now, NextAttempt: now}
+	if _, err := in.store.PutIfAbsent(m); err != nil {
+		return errors.Wrap(err, "could not persist webhook event")
+	}
+	select {
+	case in.notify <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// Run handles the events in the inbox, including those left over by a
+// previous run, until ctx is done or the store fails.
+func (in *Inbox) Run(ctx context.Context) error {
+	workers := in.Workers
+	if workers <= 0 {
+		workers = DefaultInboxWorkers
+	}
+	poll := in.PollInterval
+	if poll <= 0 {
+		poll = DefaultInboxPollInterval
+	}
+
+	work := make(chan *InboxMessage)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for m := range work {
+				in.process(ctx, m)
+			}
+		}()
+	}
+	defer func() {
+		close(work)
+		wg.Wait()
+	}()
+
+	ticker := time.NewTicker(poll)
+	defer ticker.Stop()
+	for {
+		if err := in.dispatch(ctx, work); err != nil {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-in.notify:
+		case <-ticker.C:
+		}
+	}
+}
+
+// dispatch sends the pending messages which are due and not already being
+// handled to the workers, oldest first.
+func (in *Inbox) dispatch(ctx context.Context, work chan<- *InboxMessage) error {
+	pending, err := in.store.Pending()
+	if err != nil {
+		return errors.Wrap(err, "could not read inbox")
+	}
+	sort.Slice(pending, func(i, j int) bool {
+		return pending[i].Received.Before(pending[j].Received)
+	})
+
+	now := time.Now()
+	for _, m := range pending {
+		if m.NextAttempt.After(now) {
+			continue
+		}
+		in.mu.Lock()
+		busy := in.inFlight[m.ID]
+		in.inFlight[m.ID] = true
+		in.mu.Unlock()
+		if busy {
+			continue
+		}
+		select {
+		case work <- m:
+		case <-ctx.Done():
+			in.done(m.ID)
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+// process handles a message and records the outcome in the store. An
+// attempt interrupted by ctx is not counted.
+func (in *Inbox) process(ctx context.Context, m *InboxMessage) {
+	defer in.done(m.ID)
+
+	err := in.handle(ctx, m)
+	if err == nil {
+		in.store.Delete(m.ID)
+		return
+	}
+	if ctx.Err() != nil {
+		return
+	}
+
+	retry := in.Retry
+	if retry == nil {
+		retry = DefaultInboxRetryPolicy()
+	}
+	m.Attempts++
+	m.LastError = err.Error()
+	if m.Attempts >= retry.MaxAttempts {
+		in.store.DeadLetter(m)
+		return
+	}
+	m.NextAttempt = time.Now().Add(retry.backoff(m.Attempts, nil))
+	in.store.Put(m)
+}
+
+// handle decodes a message and passes the event to the handler.
+func (in *Inbox) handle(ctx context.Context, m *InboxMessage) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("event handler panicked: %v", r)
+		}
+	}()
+	e := &Event{}
+	if err := json.Unmarshal(m.Body, e); err != nil {
+		return fmt.Errorf("could not decode webhook event: %w", err)
+	}
+	return in.handler(ctx, e)
+}
+
+// done marks a message as no longer being handled.
+func (in *Inbox) done(id string) {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	delete(in.inFlight, id)
+}
+
+// MemoryInboxStore is an InboxStore keeping messages in memory. Events are
+// lost when the process stops, so it is mostly useful in tests.
+type MemoryInboxStore struct {
+	mu      sync.Mutex
+	pending map[string]InboxMessage
+	dead    map[string]InboxMessage
+}
+
+// NewMemoryInboxStore creates an empty in-memory inbox store
+func NewMemoryInboxStore() *MemoryInboxStore {
+	return &MemoryInboxStore{pending: make(map[string]InboxMessage), dead: make(map[string]InboxMessage)}
+}
+
+// Put stores a message, replacing any pending message with the same ID
+func (s *MemoryInboxStore) Put(m *InboxMessage) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pending[m.ID] = *m
+	return nil
+}
+
+// PutIfAbsent stores a message unless a message with the same ID is pending
+func (s *MemoryInboxStore) PutIfAbsent(m *InboxMessage) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.pending[m.ID]; ok {
+		return false, nil
+	}
+	s.pending[m.ID] = *m
+	return true, nil
+}
+
+// Pending returns the messages which have not been handled yet
+func (s *MemoryInboxStore) Pending() ([]*InboxMessage, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return messages(s.pending), nil
+}
+
+// Delete removes a pending message
+func (s *MemoryInboxStore) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.pending, id)
+	return nil
+}
+
+// DeadLetter moves a message to the dead lettered messages
+func (s *MemoryInboxStore) DeadLetter(m *InboxMessage) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.pending, m.ID)
+	s.dead[m.ID] = *m
+	return nil
+}
+
+// DeadLetters returns the dead lettered messages
+func (s *MemoryInboxStore) DeadLetters() ([]*InboxMessage, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return messages(s.dead), nil
+}
+
+func messages(m map[string]InboxMessage) []*InboxMessage {
+	list := make([]*InboxMessage, 0, len(m))
+	for _, msg := range m {
+		msg := msg
+		list = append(list, &msg)
+	}
+	return list
+}
+
+// FileInboxStore is an InboxStore keeping each message in its own file, in a
+// pending and a dead letter directory. Files are replaced atomically.
+type FileInboxStore struct {
+	pending string
+	dead    string
+}
+
+// NewFileInboxStore creates an inbox store in dir, which is created if needed
+func NewFileInboxStore(dir string) (*FileInboxStore, error) {
+	s := &FileInboxStore{pending: filepath.Join(dir, "pending"), dead: filepath.Join(dir, "dead")}
+	for _, d := range []string{s.pending, s.dead} {
+		if err := os.MkdirAll(d, 0700); err != nil {
+			return nil, errors.Wrap(err, "could not create inbox directory")
+		}
+	}
+	return s, nil
+}
+
+// filename returns the name of the file holding the message with an ID.
+func (s *FileInboxStore) filename(id string) string {
+	sum := sha256.Sum256([]byte(id))
+	return hex.EncodeToString(sum[:]) + ".json"
+}
+
+// Put stores a message, replacing any pending message with the same ID
+func (s *FileInboxStore) Put(m *InboxMessage) error {
+	data, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(s.pending, s.filename(m.ID), data)
+}
+
+// PutIfAbsent stores a message unless a message with the same ID is pending.
+// The message is written to a temporary file which is then linked into
+// place, which fails if the file exists.
+func (s *FileInboxStore) PutIfAbsent(m *InboxMessage) (bool, error) {
+	data, err := json.Marshal(m)
+	if err != nil {
+		return false, err
+	}
+	name := s.filename(m.ID)
+	f, err := ioutil.TempFile(s.pending, "."+name+"-")
+	if err != nil {
+		return false, err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return false, err
+	}
+	if err := f.Close(); err != nil {
+		return false, err
+	}
+	err = os.Link(f.Name(), filepath.Join(s.pending, name))
+	if os.IsExist(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// Pending returns the messages which have not been handled yet
+func (s *FileInboxStore) Pending() ([]*InboxMessage, error) {
+	return readMessages(s.pending)
+}
+
+// Delete removes a pending message
+func (s *FileInboxStore) Delete(id string) error {
+	err := os.Remove(filepath.Join(s.pending, s.filename(id)))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// DeadLetter moves a message to the dead letter directory
+func (s *FileInboxStore) DeadLetter(m *InboxMessage) error {
+	data, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(s.dead, s.filename(m.ID), data); err != nil {
+		return err
+	}
+	return s.Delete(m.ID)
+}
+
+// DeadLetters returns the dead lettered messages
+func (s *FileInboxStore) DeadLetters() ([]*InboxMessage, error) {
+	return readMessages(s.dead)
+}
+
+// readMessages decodes the message files in dir, skipping files which are
+// being written.
+func readMessages(dir string) ([]*InboxMessage, error) {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var list []*InboxMessage
+	for _, fi := range files {
+		if filepath.Ext(fi.Name()) != ".json" {
+			continue
+		}
+		data, err := ioutil.ReadFile(filepath.Join(dir, fi.Name()))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		m := &InboxMessage{}
+		if err := json.Unmarshal(data, m); err != nil {
+			return nil, errors.Wrapf(err, "could not decode inbox file %s", fi.Name())
+		}
+		list = append(list, m)
+	}
+	return list, nil
+}
@@ -0,0 +1,187 @@
+package upvest
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"testing"
+	"time"
+)
+
+func testInboxStore(t *testing.T, store InboxStore) {
+	m := &InboxMessage{ID: "e1", Body: []byte(`{"id":"e1"}`), Received: time.Now().Round(time.Second)}
+	if err := store.Put(m); err != nil {
+		t.Fatalf("Put returned error: %v", err)
+	}
+	store.Put(&InboxMessage{ID: "e2", Body: []byte(`{"id":"e2"}`)})
+
+	m.Attempts = 1
+	if err := store.Put(m); err != nil {
+		t.Fatalf("Put returned error: %v", err)
+	}
+	pending, err := store.Pending()
+	if err != nil || len(pending) != 2 {
+		t.Fatalf("Expected 2 pending messages, got %+v, %v", pending, err)
+	}
+	for _, p := range pending {
+		if p.ID == "e1" && (p.Attempts != 1 || string(p.Body) != `{"id":"e1"}` || !p.Received.Equal(m.Received)) {
+			t.Errorf("Unexpected pending message %+v", p)
+		}
+	}
+
+	if err := store.DeadLetter(m); err != nil {
+		t.Fatalf("DeadLetter returned error: %v", err)
+	}
+	if err := store.Delete("e2"); err != nil {
+		t.Fatalf("Delete returned error: %v", err)
+	}
+	if pending, _ := store.Pending(); len(pending) != 0 {
+		t.Errorf("Expected no pending messages, got %+v", pending)
+	}
+	dead, err := store.DeadLetters()
+	if err != nil || len(dead) != 1 || dead[0].ID != "e1" {
+		t.Errorf("Expected dead lettered message, got %+v, %v", dead, err)
+	}
+
+	e3 := &InboxMessage{ID: "e3", Body: []byte(`{"id":"e3"}`), Attempts: 2}
+	if stored, err := store.PutIfAbsent(e3); err != nil || !stored {
+		t.Fatalf("PutIfAbsent = %v, %v, want a stored message", stored, err)
+	}
+	if stored, err := store.PutIfAbsent(&InboxMessage{ID: "e3", Body: []byte(`{"id":"e3"}`)}); err != nil || stored {
+		t.Errorf("PutIfAbsent = %v, %v, want the pending message kept", stored, err)
+	}
+	if pending, _ := store.Pending(); len(pending) != 1 || pending[0].Attempts != 2 {
+		t.Errorf("Expected the pending message with its attempts, got %+v", pending)
+	}
+}
+
+func TestMemoryInboxStore(t *testing.T) {
+	testInboxStore(t, NewMemoryInboxStore())
+}
+
+func TestFileInboxStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "upvest-inbox")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	store, err := NewFileInboxStore(dir)
+	if err != nil {
+		t.Fatalf("NewFileInboxStore returned error: %v", err)
+	}
+	testInboxStore(t, store)
+}
+
+func TestInbox(t *testing.T) {
+	store := NewMemoryInboxStore()
+	var mu sync.Mutex
+	calls := map[string]int{}
+	handled := make(chan string, 10)
+	inbox := NewInbox(store, func(ctx context.Context, e *Event) error {
+		mu.Lock()
+		calls[e.ID]++
+		n := calls[e.ID]
+		mu.Unlock()
+		if e.ID == "flaky" && n < 2 || e.ID == "broken" {
+			return errors.New("handler failed")
+		}
+		handled <- e.ID
+		return nil
+	})
+	inbox.PollInterval = 5 * time.Millisecond
+	inbox.Retry = &RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond}
+
+	// left over from a previous run
+	store.Put(&InboxMessage{ID: "old", Body: []byte(`{"id":"old"}`)})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- inbox.Run(ctx) }()
+
+	for _, id := range []string{"flaky", "broken"} {
+		if err := inbox.Add(id, []byte(`{"id":"`+id+`"}`)); err != nil {
+			t.Fatalf("Add returned error: %v", err)
+		}
+	}
+
+	got := map[string]bool{}
+	for len(got) < 2 {
+		select {
+		case id := <-handled:
+			got[id] = true
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Timed out waiting for events, handled %v", got)
+		}
+	}
+	if !got["old"] || !got["flaky"] {
+		t.Errorf("Expected old and flaky events to be handled, got %v", got)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		dead, _ := store.DeadLetters()
+		if len(dead) == 1 {
+			if dead[0].ID != "broken" || dead[0].Attempts != 3 || dead[0].LastError != "handler failed" {
+				t.Errorf("Unexpected dead letter %+v", dead[0])
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Timed out waiting for dead letter")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if pending, _ := store.Pending(); len(pending) != 0 {
+		t.Errorf("Expected empty inbox, got %+v", pending)
+	}
+
+	cancel()
+	if err := <-done; err != context.Canceled {
+		t.Errorf("Expected Run to return context.Canceled, got %v", err)
+	}
+}
+
+func TestWebhookReceiverInbox(t *testing.T) {
+	store := NewMemoryInboxStore()
+	receiver := NewWebhookReceiver("secret")
+	receiver.Handle(func(ctx context.Context, e *Event) error {
+		t.Error("Expected handlers not to be called by the receiver")
+		return nil
+	})
+	receiver.Inbox = NewInbox(store, func(ctx context.Context, e *Event) error { return nil })
+
+	w := httptest.NewRecorder()
+	receiver.ServeHTTP(w, newDelivery("secret", time.Now(), testEvent))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body)
+	}
+	pending, _ := store.Pending()
+	if len(pending) != 1 || pending[0].ID != "e1" || string(pending[0].Body) != testEvent {
+		t.Errorf("Expected event to be persisted, got %+v", pending)
+	}
+}
+
+func TestInboxAddRedelivery(t *testing.T) {
+	store := NewMemoryInboxStore()
+	inbox := NewInbox(store, func(ctx context.Context, e *Event) error { return nil })
+	if err := inbox.Add("e1", []byte(`{"id":"e1"}`)); err != nil {
+		t.Fatalf("Add returned error: %v", err)
+	}
+	pending, _ := store.Pending()
+	failed := *pending[0]
+	failed.Attempts, failed.LastError = 2, "handler failed"
+	store.Put(&failed)
+
+	if err := inbox.Add("e1", []byte(`{"id":"e1"}`)); err != nil {
+		t.Fatalf("Add returned error: %v", err)
+	}
+	pending, _ = store.Pending()
+	if len(pending) != 1 || pending[0].Attempts != 2 || pending[0].LastError != "handler failed" {
+		t.Errorf("Expected the redelivery to keep the attempts, got %+v", pending)
+	}
+}
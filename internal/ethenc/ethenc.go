@@ -0,0 +1,111 @@
+// Package ethenc converts and encodes the integers and bytes of Ethereum
+// values, shared by the ABI encoder and EIP-712 typed data.
+package ethenc
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// minorUnits is an amount such as upvest.Amount
+type minorUnits interface {
+	Minor() *big.Int
+}
+
+// Int converts a value to an integer: an int, int64, uint64, *big.Int, an
+// amount in minor units, a json.Number or a decimal or 0x prefixed hex string.
+func Int(v interface{}) (*big.Int, error) {
+	switch v := v.(type) {
+	case *big.Int:
+		return v, nil
+	case minorUnits:
+		return v.Minor(), nil
+	case int:
+		return big.NewInt(int64(v)), nil
+	case int64:
+		return big.NewInt(v), nil
+	case uint64:
+		return new(big.Int).SetUint64(v), nil
+	case json.Number:
+		return Int(v.String())
+	case string:
+		n, ok := new(big.Int).SetString(v, 10)
+		if strings.HasPrefix(v, "0x") {
+			n, ok = new(big.Int).SetString(v[2:], 16)
+		}
+		if ok {
+			return n, nil
+		}
+	}
+	return nil, fmt.Errorf("%v is not an integer", v)
+}
+
+// Bytes converts a []byte or a 0x prefixed hex string to bytes.
+func Bytes(v interface{}) ([]byte, error) {
+	switch v := v.(type) {
+	case []byte:
+		return v, nil
+	case string:
+		if strings.HasPrefix(v, "0x") {
+			return hex.DecodeString(v[2:])
+		}
+	}
+	return nil, fmt.Errorf("%v is not bytes", v)
+}
+
+// IntSize returns the number of bits of an integer type, such as uint8 or int.
+func IntSize(typ string) (int, error) {
+	bits := strings.TrimPrefix(typ, "u")
+	if !strings.HasPrefix(bits, "int") {
+		return 0, fmt.Errorf("unknown type %q", typ)
+	}
+	bits = bits[len("int"):]
+	if bits == "" {
+		return 256, nil
+	}
+	n, err := strconv.Atoi(bits)
+	if err != nil || n < 8 || n > 256 || n%8 != 0 {
+		return 0, fmt.Errorf("unknown type %q", typ)
+	}
+	return n, nil
+}
+
+// EncodeInt returns the 32 byte word of a value of a uintN or intN type,
+// checking its range. Negative values are encoded in two's complement.
+func EncodeInt(typ string, v interface{}) ([]byte, error) {
+	bits, err := IntSize(typ)
+	if err != nil {
+		return nil, err
+	}
+	n, err := Int(v)
+	if err != nil {
+		return nil, err
+	}
+	if strings.HasPrefix(typ, "uint") {
+		if n.Sign() < 0 || n.BitLen() > bits {
+			return nil, fmt.Errorf("%s out of range of %s", n, typ)
+		}
+		return Word(n), nil
+	}
+	limit := new(big.Int).Lsh(big.NewInt(1), uint(bits-1))
+	if n.Cmp(limit) >= 0 || n.Cmp(new(big.Int).Neg(limit)) < 0 {
+		return nil, fmt.Errorf("%s out of range of %s", n, typ)
+	}
+	if n.Sign() < 0 {
+		// two's complement
+		n = new(big.Int).Add(n, new(big.Int).Lsh(big.NewInt(1), 256))
+	}
+	return Word(n), nil
+}
+
+// Word returns n as a 32 byte big-endian word.
+func Word(n *big.Int) []byte {
+	out := make([]byte, 32)
+	b := n.Bytes()
+	copy(out[32-len(b):], b)
+	return out
+}
@@ -0,0 +1,149 @@
+package upvest
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/pkg/errors"
+)
+
+// ListOptions is the set of parameters that can be used when iterating over a list
+type ListOptions struct {
+	// PageSize is the number of items requested per page. It defaults to,
+	// and may not exceed, MaxPageSize.
+	PageSize int
+	// Limit is the maximum number of items returned. Zero means no limit.
+	Limit int
+}
+
+// listPage is a single page of a paginated response.
+type listPage struct {
+	Previous string        `json:"previous"`
+	Next     string        `json:"next"`
+	Results  []interface{} `json:"results"`
+}
+
+// fill sets the page from a decoded response, keeping the results as they
+// were decoded.
+func (p *listPage) fill(resp Response) {
+	p.Previous, _ = resp["previous"].(string)
+	p.Next, _ = resp["next"].(string)
+	p.Results, _ = resp["results"].([]interface{})
+}
+
+// Iter iterates over the items of a paginated list, fetching one page at a
+// time as the items are consumed. It is embedded by the typed iterators of
+// each resource, e.g. UserIter, which return the current item with Value.
+//
+//	it := tenant.User.Iter(ctx, nil)
+//	for it.Next() {
+//		user := it.Value()
+//	}
+//	if err := it.Err(); err != nil {
+//		// handle error
+//	}
+type Iter struct {
+	ctx    context.Context
+	client *Client
+	params *Params
+	path   string
+	query  url.Values
+	decode func(interface{}) (interface{}, error)
+
+	pageSize int
+	limit    int
+	count    int
+	lastPage bool
+
+	values []interface{}
+	cur    interface{}
+	err    error
+}
+
+// newIter creates an iterator over the list at path. decode converts the
+// generic representation of an item into its resource type.
+func (s *service) newIter(ctx context.Context, path string, opts *ListOptions, decode func(interface{}) (interface{}, error)) *Iter {
+	it := &Iter{
+		ctx:      ctx,
+		client:   s.client,
+		params:   NewParams(s.auth),
+		path:     path,
+		query:    url.Values{},
+		decode:   decode,
+		pageSize: MaxPageSize,
+	}
+	if opts != nil {
+		if opts.PageSize > 0 && opts.PageSize < MaxPageSize {
+			it.pageSize = opts.PageSize
+		}
+		it.limit = opts.Limit
+	}
+	return it
+}
+
+// Next advances the iterator to the next item, fetching the next page if
+// needed. It returns false once the list or the limit is exhausted, or an
+// error occurred.
+func (it *Iter) Next() bool {
+	if it.err != nil || (it.limit > 0 && it.count >= it.limit) {
+		return false
+	}
+	for len(it.values) == 0 {
+		if it.lastPage {
+			return false
+		}
+		if it.err = it.fetch(); it.err != nil {
+			return false
+		}
+	}
+	it.cur, it.values = it.values[0], it.values[1:]
+	it.count++
+	return true
+}
+
+// Current returns the item at the current position
+func (it *Iter) Current() interface{} {
+	return it.cur
+}
+
+// Err returns the error which stopped the iteration, if any
+func (it *Iter) Err() error {
+	return it.err
+}
+
+// fetch retrieves the next page.
+func (it *Iter) fetch() error {
+	size := it.pageSize
+	if it.limit > 0 && it.limit-it.count < size {
+		size = it.limit - it.count
+	}
+	it.query.Set("page_size", strconv.Itoa(size))
+	u := it.path + "?" + it.query.Encode()
+
+	page := &listPage{}
+	if err := it.client.CallContext(it.ctx, http.MethodGet, u, nil, page, it.params); err != nil {
+		return err
+	}
+
+	for _, raw := range page.Results {
+		v, err := it.decode(raw)
+		if err != nil {
+			return err
+		}
+		it.values = append(it.values, v)
+	}
+
+	if page.Next == "" || len(page.Results) == 0 {
+		it.lastPage = true
+		return nil
+	}
+	// carry over the cursor of the next page
+	next, err := url.Parse(page.Next)
+	if err != nil {
+		return errors.Wrap(err, "Can not parse url")
+	}
+	it.query = next.Query()
+	return nil
+}
@@ -0,0 +1,106 @@
+package upvest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+)
+
+// newPagingServer serves total users, paginated by cursor like the Upvest API
+func newPagingServer(total int) (*httptest.Server, *[]string) {
+	var requests []string
+	var ts *httptest.Server
+	ts = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.URL.RawQuery)
+		q := r.URL.Query()
+		size, _ := strconv.Atoi(q.Get("page_size"))
+		if size == 0 {
+			size = 10
+		}
+		start, _ := strconv.Atoi(q.Get("cursor"))
+		end := start + size
+		if end > total {
+			end = total
+		}
+
+		var results []map[string]interface{}
+		for i := start; i < end; i++ {
+			results = append(results, map[string]interface{}{"username": fmt.Sprintf("user%d", i)})
+		}
+		next := ""
+		if end < total {
+			next = fmt.Sprintf("%s/1.0/tenancy/users/?cursor=%d", ts.URL, end)
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"next": next, "previous": "", "results": results})
+	}))
+	return ts, &requests
+}
+
+func TestIterPages(t *testing.T) {
+	ts, requests := newPagingServer(25)
+	defer ts.Close()
+	s := &UserService{service{NewClient(ts.URL, nil), nil}}
+
+	it := s.Iter(context.Background(), &ListOptions{PageSize: 10})
+	n := 0
+	for it.Next() {
+		if expected := fmt.Sprintf("user%d", n); it.Value().Username != expected {
+			t.Errorf("Expected %s, got %s", expected, it.Value().Username)
+		}
+		n++
+	}
+	if err := it.Err(); err != nil {
+		t.Fatalf("Iter returned error: %v", err)
+	}
+	if n != 25 {
+		t.Errorf("Expected 25 users, got %d", n)
+	}
+	if len(*requests) != 3 {
+		t.Errorf("Expected 3 page requests, got %d", len(*requests))
+	}
+}
+
+func TestIterStopsEarly(t *testing.T) {
+	ts, requests := newPagingServer(25)
+	defer ts.Close()
+	s := &UserService{service{NewClient(ts.URL, nil), nil}}
+
+	it := s.Iter(context.Background(), &ListOptions{PageSize: 10})
+	it.Next()
+	if len(*requests) != 1 {
+		t.Errorf("Expected pages to be fetched lazily, got %d requests", len(*requests))
+	}
+}
+
+func TestListNExact(t *testing.T) {
+	ts, requests := newPagingServer(250)
+	defer ts.Close()
+	s := &UserService{service{NewClient(ts.URL, nil), nil}}
+
+	for _, count := range []int{7, 100, 130} {
+		*requests = nil
+		users, err := s.ListN(count)
+		if err != nil {
+			t.Fatalf("List Users returned error: %v", err)
+		}
+		if len(users.Values) != count {
+			t.Errorf("Expected %d users, got %d", count, len(users.Values))
+		}
+		expected := (count + MaxPageSize - 1) / MaxPageSize
+		if len(*requests) != expected {
+			t.Errorf("Expected %d page requests for %d users, got %d", expected, count, len(*requests))
+		}
+	}
+
+	users, err := s.List()
+	if err != nil {
+		t.Fatalf("List Users returned error: %v", err)
+	}
+	if len(users.Values) != 250 {
+		t.Errorf("Expected 250 users, got %d", len(users.Values))
+	}
+}
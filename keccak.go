@@ -0,0 +1,13 @@
+package upvest
+
+import "golang.org/x/crypto/sha3"
+
+// Keccak256 returns the Keccak-256 hash of the concatenated data, as used by
+// Ethereum. It differs from SHA3-256 in its padding.
+func Keccak256(data ...[]byte) []byte {
+	h := sha3.NewLegacyKeccak256()
+	for _, d := range data {
+		h.Write(d)
+	}
+	return h.Sum(nil)
+}
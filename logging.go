@@ -0,0 +1,178 @@
+package upvest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// LogLevel controls how much the client logs when logging is enabled
+type LogLevel int
+
+// Log levels, from least to most verbose
+const (
+	// LogLevelError logs failed requests only.
+	LogLevelError LogLevel = iota
+	// LogLevelInfo additionally logs every request and its timing.
+	LogLevelInfo
+	// LogLevelDebug additionally logs headers and payloads, with secrets redacted.
+	LogLevelDebug
+)
+
+// String returns the name of the log level
+func (l LogLevel) String() string {
+	switch l {
+	case LogLevelError:
+		return "error"
+	case LogLevelInfo:
+		return "info"
+	case LogLevelDebug:
+		return "debug"
+	}
+	return fmt.Sprintf("level(%d)", int(l))
+}
+
+// redactedValue replaces the values of sensitive fields in logs.
+const redactedValue = "[REDACTED]"
+
+// DefaultRedactKeys are the JSON fields, form fields and headers whose values
+// are never logged. Keys are matched case-insensitively.
+var DefaultRedactKeys = []string{
+	"password",
+	"old_password",
+	"new_password",
+	"recoverykit",
+	"hmac_secret_key",
+	"client_secret",
+	"access_token",
+	"refresh_token",
+	"Authorization",
+	"X-UP-API-Passphrase",
+	"X-UP-API-Signature",
+}
+
+// Fields are the key-value pairs attached to a log entry
+type Fields map[string]interface{}
+
+// StructuredLogger may be implemented by a Logger to receive log entries as
+// fields instead of formatted lines.
+type StructuredLogger interface {
+	LogEntry(level LogLevel, msg string, fields Fields)
+}
+
+// logEntry logs msg with fields at level. Values of fields are expected to be
+// redacted already.
+func (c *Client) logEntry(level LogLevel, msg string, fields Fields) {
+	if !c.LoggingEnabled || level > c.LogLevel {
+		return
+	}
+	if sl, ok := c.Log.(StructuredLogger); ok {
+		sl.LogEntry(level, msg, fields)
+		return
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "level=%s msg=%q", level, msg)
+	keys := make([]string, 0, len(fields))
+	for k := range fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		v := fields[k]
+		switch v.(type) {
+		case string, fmt.Stringer, error:
+			fmt.Fprintf(&b, " %s=%q", k, fmt.Sprint(v))
+		default:
+			enc, err := json.Marshal(v)
+			if err != nil {
+				enc = []byte(fmt.Sprintf("%q", fmt.Sprint(v)))
+			}
+			fmt.Fprintf(&b, " %s=%s", k, enc)
+		}
+	}
+	c.Log.Printf("%s\n", b.String())
+}
+
+// redactKeys returns the set of keys to redact, lower cased.
+func (c *Client) redactKeys() map[string]bool {
+	keys := c.RedactKeys
+	if keys == nil {
+		keys = DefaultRedactKeys
+	}
+	set := make(map[string]bool, len(keys))
+	for _, k := range keys {
+		set[strings.ToLower(k)] = true
+	}
+	return set
+}
+
+// redactHeaders returns a copy of the headers with sensitive values replaced.
+func (c *Client) redactHeaders(h http.Header) http.Header {
+	keys := c.redactKeys()
+	out := make(http.Header, len(h))
+	for k, v := range h {
+		if keys[strings.ToLower(k)] {
+			out[k] = []string{redactedValue}
+		} else {
+			out[k] = v
+		}
+	}
+	return out
+}
+
+// redactBody returns a loggable representation of a request or response
+// body with the values of sensitive fields replaced. Bodies may be JSON
+// encodable values or form encoded buffers.
+func (c *Client) redactBody(body interface{}) interface{} {
+	keys := c.redactKeys()
+	if buf, ok := body.(*bytes.Buffer); ok {
+		form, err := url.ParseQuery(buf.String())
+		if err != nil {
+			return redactedValue
+		}
+		for k := range form {
+			if keys[strings.ToLower(k)] {
+				form[k] = []string{redactedValue}
+			}
+		}
+		return form.Encode()
+	}
+
+	// round trip through JSON to reach the fields of structs
+	enc, err := json.Marshal(body)
+	if err != nil {
+		return redactedValue
+	}
+	var v interface{}
+	if err := json.Unmarshal(enc, &v); err != nil {
+		return redactedValue
+	}
+	return redactValue(v, keys)
+}
+
+func redactValue(v interface{}, keys map[string]bool) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(v))
+		for k, val := range v {
+			if keys[strings.ToLower(k)] {
+				out[k] = redactedValue
+			} else {
+				out[k] = redactValue(val, keys)
+			}
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		for i, val := range v {
+			out[i] = redactValue(val, keys)
+		}
+		return out
+	}
+	return v
+}
@@ -0,0 +1,92 @@
+package upvest
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// bufferLogger collects log lines in memory
+type bufferLogger struct {
+	lines []string
+}
+
+func (l *bufferLogger) Printf(format string, v ...interface{}) {
+	l.lines = append(l.lines, fmt.Sprintf(format, v...))
+}
+
+func (l *bufferLogger) String() string {
+	return strings.Join(l.lines, "")
+}
+
+func newLoggingTestClient(t *testing.T, response string) (*Client, *bufferLogger, func()) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(response))
+	}))
+	c := NewClient(ts.URL, nil)
+	logger := &bufferLogger{}
+	c.LoggingEnabled = true
+	c.Log = logger
+	return c, logger, ts.Close
+}
+
+func TestLoggingRedactsSecrets(t *testing.T) {
+	c, logger, done := newLoggingTestClient(t, `{"username": "alice", "recoverykit": "kit-secret"}`)
+	defer done()
+
+	tenant := c.NewTenant("key", "api-secret", "passphrase-secret")
+	if _, err := tenant.User.Create("alice", "password-secret", nil); err != nil {
+		t.Fatalf("CREATE User returned error: %v", err)
+	}
+
+	out := logger.String()
+	for _, secret := range []string{"password-secret", "passphrase-secret", "kit-secret"} {
+		if strings.Contains(out, secret) {
+			t.Errorf("Expected %s to be redacted, got logs:\n%s", secret, out)
+		}
+	}
+	if !strings.Contains(out, "alice") {
+		t.Errorf("Expected non-sensitive fields to be logged, got logs:\n%s", out)
+	}
+}
+
+func TestLoggingRedactsForm(t *testing.T) {
+	c, logger, done := newLoggingTestClient(t, `{"access_token": "token-secret"}`)
+	defer done()
+
+	auth := OAuth{clientID: "id", clientSecret: "client-secret", username: "alice", password: "password-secret"}
+	if _, err := auth.GetHeaders(http.MethodGet, "/kms/wallets/", nil, c); err != nil {
+		t.Fatalf("GetHeaders returned error: %v", err)
+	}
+
+	out := logger.String()
+	for _, secret := range []string{"client-secret", "password-secret", "token-secret"} {
+		if strings.Contains(out, secret) {
+			t.Errorf("Expected %s to be redacted, got logs:\n%s", secret, out)
+		}
+	}
+}
+
+func TestLoggingCustomRedactKeys(t *testing.T) {
+	c, logger, done := newLoggingTestClient(t, `{"address": "0xabc"}`)
+	defer done()
+	c.RedactKeys = append(DefaultRedactKeys, "address")
+
+	c.Call(http.MethodGet, "/kms/wallets/w1", nil, &Response{}, &Params{})
+	if strings.Contains(logger.String(), "0xabc") {
+		t.Errorf("Expected address to be redacted, got logs:\n%s", logger.String())
+	}
+}
+
+func TestLoggingLevel(t *testing.T) {
+	c, logger, done := newLoggingTestClient(t, `{}`)
+	defer done()
+	c.LogLevel = LogLevelError
+
+	c.Call(http.MethodGet, "/kms/wallets/", nil, &Response{}, &Params{})
+	if len(logger.lines) != 0 {
+		t.Errorf("Expected no logs at error level, got:\n%s", logger.String())
+	}
+}
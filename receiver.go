@@ -0,0 +1,379 @@
+package upvest
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha512"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// WebhookSignatureHeader carries the HMAC signature of a webhook delivery
+	WebhookSignatureHeader = "X-UP-Signature"
+	// WebhookTimestampHeader carries the unix time a webhook delivery was signed at
+	WebhookTimestampHeader = "X-UP-Timestamp"
+	// DefaultWebhookTolerance is how far the timestamp of a delivery may be
+	// from the receiver's clock before it is rejected as a replay.
+	DefaultWebhookTolerance = 5 * time.Minute
+	// MaxWebhookBodySize is the largest webhook body the receiver accepts.
+	MaxWebhookBodySize = 1 << 20
+)
+
+// Errors returned when a webhook delivery can not be authenticated.
+var (
+	ErrInvalidSignature = errors.New("upvest: invalid webhook signature")
+	ErrStaleWebhook     = errors.New("upvest: webhook timestamp outside tolerance")
+)
+
+var (
+	errWebhookTooLarge = errors.New("webhook body too large")
+	errEventHandler    = errors.New("event handler failed")
+)
+
+// Event is a webhook delivery from Upvest
+type Event struct {
+	ID            string          `json:"id"`
+	Created       time.Time       `json:"created"`
+	EventNoun     string          `json:"event_noun"`
+	EventVerb     string          `json:"event_verb"`
+	ProtocolName  string          `json:"protocol_name"`
+	WalletAddress string          `json:"wallet_address"`
+	Data          json.RawMessage `json:"data"`
+}
+
+// Type returns the noun and verb of the event, e.g. "transaction.confirmed"
+func (e *Event) Type() string {
+	return e.EventNoun + "." + e.EventVerb
+}
+
+// EventHandlerFunc handles a webhook event. Returning an error makes the
+// receiver answer with a server error, so that Upvest redelivers the event.
+type EventHandlerFunc func(ctx context.Context, e *Event) error
+
+// SignWebhook returns the signature of a webhook body signed at timestamp,
+// the hex encoded HMAC-SHA512 of the timestamp followed by the body.
+func SignWebhook(secret string, timestamp int64, body []byte) string {
+	h := hmac.New(sha512.New, []byte(secret))
+	h.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// WebhookChallenge is the body of the request Upvest sends to a webhook URL
+// to verify it. The URL passes verification by answering with the same body.
+type WebhookChallenge struct {
+	Challenge string `json:"challenge"`
+}
+
+// WebhookVerificationHandler answers the challenges Upvest sends to verify a
+// webhook URL and passes all other requests to next. WebhookReceiver answers
+// challenges itself, so this is only needed for other webhook handlers.
+func WebhookVerificationHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if answerChallenge(w, r) {
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// answerChallenge answers r and returns true if it is an unsigned
+// verification challenge. Otherwise the body of r is left for the next reader.
+func answerChallenge(w http.ResponseWriter, r *http.Request) bool {
+	if r.Method != http.MethodPost || r.Header.Get(WebhookSignatureHeader) != "" {
+		return false
+	}
+	body, err := ioutil.ReadAll(io.LimitReader(r.Body, MaxWebhookBodySize+1))
+	r.Body = ioutil.NopCloser(bytes.NewReader(body))
+	if err != nil {
+		return false
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(body, &fields); err != nil || len(fields) != 1 {
+		return false
+	}
+	c := WebhookChallenge{}
+	if err := json.Unmarshal(fields["challenge"], &c.Challenge); err != nil || c.Challenge == "" {
+		return false
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(c)
+	return true
+}
+
+// WebhookReceiver is an http.Handler receiving webhook deliveries. It
+// authenticates each delivery with the webhook's HMAC secret key, rejects
+// deliveries with stale timestamps and passes the event to the registered
+// handlers in order.
+//
+// Usage:
+//
+//	receiver := upvest.NewWebhookReceiver(secret)
+//	receiver.Handle(func(ctx context.Context, e *upvest.Event) error {
+//		log.Println(e.Type())
+//		return nil
+//	})
+//	http.Handle("/webhooks/upvest", receiver)
+type WebhookReceiver struct {
+	// Tolerance is the maximum age of a delivery. A zero value means
+	// DefaultWebhookTolerance.
+	Tolerance time.Duration
+	// Dedup, if set, makes the receiver acknowledge events it has already
+	// received without handling them again.
+	Dedup DedupStore
+	// Inbox, if set, makes the receiver persist events in the inbox and
+	// acknowledge them before they are handled by the inbox's workers,
+	// instead of calling the registered handlers.
+	Inbox *Inbox
+
+	mu          sync.RWMutex
+	secrets     []string
+	retireAt    map[string]time.Time
+	handlers    []EventHandlerFunc
+	subscribers map[chan *Event]bool
+	now         func() time.Time
+}
+
+// NewWebhookReceiver returns a receiver for deliveries signed with secret
+func NewWebhookReceiver(secret string) *WebhookReceiver {
+	return &WebhookReceiver{secrets: []string{secret}, now: time.Now}
+}
+
+// AddSecret makes the receiver accept deliveries signed with secret in
+// addition to its other secrets, e.g. while the webhook's secret is rotated.
+// A secret which was to be retired is kept.
+func (wr *WebhookReceiver) AddSecret(secret string) {
+	wr.mu.Lock()
+	defer wr.mu.Unlock()
+	delete(wr.retireAt, secret)
+	for _, s := range wr.secrets {
+		if s == secret {
+			return
+		}
+	}
+	wr.secrets = append(wr.secrets, secret)
+}
+
+// RetireSecret makes the receiver reject deliveries signed with secret
+func (wr *WebhookReceiver) RetireSecret(secret string) {
+	wr.mu.Lock()
+	defer wr.mu.Unlock()
+	delete(wr.retireAt, secret)
+	secrets := make([]string, 0, len(wr.secrets))
+	for _, s := range wr.secrets {
+		if s != secret {
+			secrets = append(secrets, s)
+		}
+	}
+	wr.secrets = secrets
+}
+
+// RetireSecretAfter makes the receiver reject deliveries signed with secret
+// once grace has passed. If the secret is already to be retired earlier, it
+// is retired then.
+func (wr *WebhookReceiver) RetireSecretAfter(secret string, grace time.Duration) {
+	if grace <= 0 {
+		wr.RetireSecret(secret)
+		return
+	}
+	wr.mu.Lock()
+	defer wr.mu.Unlock()
+	at := wr.now().Add(grace)
+	if prev, ok := wr.retireAt[secret]; ok && prev.Before(at) {
+		return
+	}
+	if wr.retireAt == nil {
+		wr.retireAt = make(map[string]time.Time)
+	}
+	wr.retireAt[secret] = at
+}
+
+// Secrets returns the secrets the receiver currently accepts
+func (wr *WebhookReceiver) Secrets() []string {
+	wr.mu.RLock()
+	defer wr.mu.RUnlock()
+	return wr.activeSecrets()
+}
+
+// activeSecrets returns the secrets which are not yet retired. The caller
+// must hold wr.mu.
+func (wr *WebhookReceiver) activeSecrets() []string {
+	now := wr.now()
+	var secrets []string
+	for _, s := range wr.secrets {
+		if at, ok := wr.retireAt[s]; !ok || now.Before(at) {
+			secrets = append(secrets, s)
+		}
+	}
+	return secrets
+}
+
+// subscribe returns a channel receiving every authenticated event, e.g. to
+// wake up a waiting poller, until cancel is called. Events are dropped if the
+// channel is full.
+func (wr *WebhookReceiver) subscribe() (events <-chan *Event, cancel func()) {
+	ch := make(chan *Event, 16)
+	wr.mu.Lock()
+	defer wr.mu.Unlock()
+	if wr.subscribers == nil {
+		wr.subscribers = make(map[chan *Event]bool)
+	}
+	wr.subscribers[ch] = true
+	return ch, func() {
+		wr.mu.Lock()
+		defer wr.mu.Unlock()
+		delete(wr.subscribers, ch)
+	}
+}
+
+// notify passes an event to the subscribers.
+func (wr *WebhookReceiver) notify(e *Event) {
+	wr.mu.RLock()
+	defer wr.mu.RUnlock()
+	for ch := range wr.subscribers {
+		select {
+		case ch <- e:
+		default:
+		}
+	}
+}
+
+// Handle registers fn to be called for every event
+func (wr *WebhookReceiver) Handle(fn EventHandlerFunc) {
+	wr.mu.Lock()
+	defer wr.mu.Unlock()
+	wr.handlers = append(wr.handlers, fn)
+}
+
+// ParseEvent authenticates a delivery and decodes its event. The returned
+// error wraps ErrInvalidSignature or ErrStaleWebhook if the delivery is not
+// authentic.
+func (wr *WebhookReceiver) ParseEvent(r *http.Request) (*Event, error) {
+	e, _, err := wr.readEvent(r)
+	return e, err
+}
+
+// readEvent authenticates a delivery and returns its event and raw body.
+func (wr *WebhookReceiver) readEvent(r *http.Request) (*Event, []byte, error) {
+	body, err := ioutil.ReadAll(io.LimitReader(r.Body, MaxWebhookBodySize+1))
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not read webhook body: %w", err)
+	}
+	if len(body) > MaxWebhookBodySize {
+		return nil, nil, errWebhookTooLarge
+	}
+	if err := wr.verify(r.Header, body); err != nil {
+		return nil, nil, err
+	}
+	e := &Event{}
+	if err := json.Unmarshal(body, e); err != nil {
+		return nil, nil, fmt.Errorf("could not decode webhook event: %w", err)
+	}
+	return e, body, nil
+}
+
+// verify checks the timestamp and signature headers of a delivery.
+func (wr *WebhookReceiver) verify(h http.Header, body []byte) error {
+	timestamp, err := strconv.ParseInt(h.Get(WebhookTimestampHeader), 10, 64)
+	if err != nil {
+		return fmt.Errorf("missing or malformed %s header: %w", WebhookTimestampHeader, ErrInvalidSignature)
+	}
+	tolerance := wr.Tolerance
+	if tolerance == 0 {
+		tolerance = DefaultWebhookTolerance
+	}
+	if age := wr.now().Sub(time.Unix(timestamp, 0)); age > tolerance || age < -tolerance {
+		return ErrStaleWebhook
+	}
+
+	signature := []byte(h.Get(WebhookSignatureHeader))
+	wr.mu.RLock()
+	defer wr.mu.RUnlock()
+	for _, secret := range wr.activeSecrets() {
+		if hmac.Equal(signature, []byte(SignWebhook(secret, timestamp, body))) {
+			return nil
+		}
+	}
+	return ErrInvalidSignature
+}
+
+// ServeHTTP implements http.Handler. It answers verification challenges,
+// see WebhookVerificationHandler, and 401 for deliveries which are
+// not authentic, 400 for malformed events, 413 for oversized bodies and 500
+// if a handler failed or the event could not be persisted; Upvest redelivers
+// events until it receives a 2xx response. Events already received are
+// acknowledged without handling them again if the receiver has a Dedup store.
+func (wr *WebhookReceiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if answerChallenge(w, r) {
+		return
+	}
+	e, body, err := wr.readEvent(r)
+	switch {
+	case errors.Is(err, ErrInvalidSignature) || errors.Is(err, ErrStaleWebhook):
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	case err == errWebhookTooLarge:
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	wr.notify(e)
+
+	dedup := wr.Dedup != nil && e.ID != ""
+	if dedup {
+		first, err := wr.Dedup.Claim(e.ID)
+		if err != nil {
+			http.Error(w, "could not check for duplicate event", http.StatusInternalServerError)
+			return
+		}
+		if !first {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+	}
+
+	if wr.Inbox != nil {
+		err = wr.Inbox.Add(e.ID, body)
+	} else {
+		err = wr.handle(r.Context(), e)
+	}
+	if err != nil {
+		if dedup {
+			wr.Dedup.Release(e.ID)
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// handle passes an event to the registered handlers in order, stopping at
+// the first one which fails.
+func (wr *WebhookReceiver) handle(ctx context.Context, e *Event) error {
+	wr.mu.RLock()
+	handlers := wr.handlers
+	wr.mu.RUnlock()
+	for _, fn := range handlers {
+		if err := fn(ctx, e); err != nil {
+			return errEventHandler
+		}
+	}
+	return nil
+}
@@ -0,0 +1,172 @@
+package upvest
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testEvent = `{"id":"e1","created":"2019-10-01T10:00:00Z","event_noun":"transaction","event_verb":"confirmed",` +
+	`"protocol_name":"ethereum_ropsten","wallet_address":"0xabc","data":{"txhash":"0x01"}}`
+
+// newDelivery returns a webhook delivery of body signed with secret at timestamp
+func newDelivery(secret string, timestamp time.Time, body string) *http.Request {
+	req := httptest.NewRequest(http.MethodPost, "/webhook", bytes.NewBufferString(body))
+	req.Header.Set(WebhookTimestampHeader, strconv.FormatInt(timestamp.Unix(), 10))
+	req.Header.Set(WebhookSignatureHeader, SignWebhook(secret, timestamp.Unix(), []byte(body)))
+	return req
+}
+
+func TestWebhookReceiver(t *testing.T) {
+	receiver := NewWebhookReceiver("secret")
+	var got []*Event
+	receiver.Handle(func(ctx context.Context, e *Event) error {
+		got = append(got, e)
+		return nil
+	})
+
+	w := httptest.NewRecorder()
+	receiver.ServeHTTP(w, newDelivery("secret", time.Now(), testEvent))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body)
+	}
+	if len(got) != 1 || got[0].ID != "e1" || got[0].Type() != "transaction.confirmed" {
+		t.Errorf("Unexpected events %+v", got)
+	}
+	if string(got[0].Data) != `{"txhash":"0x01"}` {
+		t.Errorf("Unexpected event data %s", got[0].Data)
+	}
+}
+
+func TestWebhookReceiverRejects(t *testing.T) {
+	receiver := NewWebhookReceiver("secret")
+	receiver.Handle(func(ctx context.Context, e *Event) error {
+		return errors.New("handler failed")
+	})
+
+	tampered := newDelivery("secret", time.Now(), testEvent)
+	tampered.Body = httptest.NewRequest(http.MethodPost, "/", bytes.NewBufferString(testEvent+" ")).Body
+
+	cases := []struct {
+		name string
+		req  *http.Request
+		code int
+	}{
+		{"wrong secret", newDelivery("other", time.Now(), testEvent), http.StatusUnauthorized},
+		{"tampered body", tampered, http.StatusUnauthorized},
+		{"stale", newDelivery("secret", time.Now().Add(-time.Hour), testEvent), http.StatusUnauthorized},
+		{"malformed", newDelivery("secret", time.Now(), "{"), http.StatusBadRequest},
+		{"method", httptest.NewRequest(http.MethodGet, "/webhook", nil), http.StatusMethodNotAllowed},
+		{"handler error", newDelivery("secret", time.Now(), testEvent), http.StatusInternalServerError},
+	}
+	for _, c := range cases {
+		w := httptest.NewRecorder()
+		receiver.ServeHTTP(w, c.req)
+		if w.Code != c.code {
+			t.Errorf("%s: expected status %d, got %d", c.name, c.code, w.Code)
+		}
+	}
+}
+
+func TestWebhookReceiverSecrets(t *testing.T) {
+	receiver := NewWebhookReceiver("old")
+	receiver.AddSecret("new")
+	for _, secret := range []string{"old", "new"} {
+		w := httptest.NewRecorder()
+		receiver.ServeHTTP(w, newDelivery(secret, time.Now(), testEvent))
+		if w.Code != http.StatusOK {
+			t.Errorf("Expected delivery signed with %q to be accepted, got %d", secret, w.Code)
+		}
+	}
+
+	receiver.RetireSecret("old")
+	w := httptest.NewRecorder()
+	receiver.ServeHTTP(w, newDelivery("old", time.Now(), testEvent))
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected delivery signed with a retired secret to be rejected, got %d", w.Code)
+	}
+	if secrets := receiver.Secrets(); len(secrets) != 1 || secrets[0] != "new" {
+		t.Errorf("Expected only the new secret, got %v", secrets)
+	}
+}
+
+func TestWebhookReceiverRetireSecretAfter(t *testing.T) {
+	now := time.Now()
+	receiver := NewWebhookReceiver("old")
+	receiver.now = func() time.Time { return now }
+	receiver.AddSecret("new")
+	receiver.RetireSecretAfter("old", time.Hour)
+	// a later rotation does not postpone the retirement
+	receiver.RetireSecretAfter("old", 2*time.Hour)
+
+	now = now.Add(59 * time.Minute)
+	w := httptest.NewRecorder()
+	receiver.ServeHTTP(w, newDelivery("old", now, testEvent))
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected delivery signed with a retiring secret to be accepted, got %d", w.Code)
+	}
+
+	now = now.Add(2 * time.Minute)
+	w = httptest.NewRecorder()
+	receiver.ServeHTTP(w, newDelivery("old", now, testEvent))
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected delivery signed with a retired secret to be rejected, got %d", w.Code)
+	}
+	if secrets := receiver.Secrets(); len(secrets) != 1 || secrets[0] != "new" {
+		t.Errorf("Expected only the new secret, got %v", secrets)
+	}
+
+	receiver.AddSecret("old")
+	if secrets := receiver.Secrets(); len(secrets) != 2 {
+		t.Errorf("Expected a secret added again to be accepted, got %v", secrets)
+	}
+}
+
+func TestWebhookReceiverDedup(t *testing.T) {
+	receiver := NewWebhookReceiver("secret")
+	receiver.Dedup = NewMemoryDedupStore(10)
+	calls := 0
+	fail := true
+	receiver.Handle(func(ctx context.Context, e *Event) error {
+		calls++
+		if fail {
+			return errors.New("handler failed")
+		}
+		return nil
+	})
+
+	codes := []int{}
+	for i := 0; i < 3; i++ {
+		w := httptest.NewRecorder()
+		receiver.ServeHTTP(w, newDelivery("secret", time.Now(), testEvent))
+		codes = append(codes, w.Code)
+		fail = false
+	}
+	if codes[0] != http.StatusInternalServerError || codes[1] != http.StatusOK || codes[2] != http.StatusOK {
+		t.Errorf("Unexpected status codes %v", codes)
+	}
+	if calls != 2 {
+		t.Errorf("Expected a failed event to be handled again and a duplicate to be skipped, got %d calls", calls)
+	}
+}
+
+func TestWebhookReceiverChallenge(t *testing.T) {
+	receiver := NewWebhookReceiver("secret")
+	w := httptest.NewRecorder()
+	receiver.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/webhook", bytes.NewBufferString(`{"challenge":"c1"}`)))
+	if w.Code != http.StatusOK || strings.TrimSpace(w.Body.String()) != `{"challenge":"c1"}` {
+		t.Errorf("Expected challenge to be answered, got %d: %s", w.Code, w.Body)
+	}
+
+	w = httptest.NewRecorder()
+	receiver.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/webhook", bytes.NewBufferString(testEvent)))
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected unsigned event to be rejected, got %d", w.Code)
+	}
+}
@@ -0,0 +1,197 @@
+package upvest
+
+import (
+	"context"
+	"io"
+	"math"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+// RetryPolicy configures how the client retries requests which failed
+// because of a transient error. Only idempotent methods are retried unless
+// RetryNonIdempotent is set.
+type RetryPolicy struct {
+	// MaxAttempts is the total number of attempts, including the first one.
+	// A value of 1 or less disables retries.
+	MaxAttempts int
+
+	// InitialBackoff is the delay before the first retry. Every further retry
+	// waits Multiplier times longer, up to MaxBackoff.
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	Multiplier     float64
+
+	// Jitter is the fraction (0 to 1) by which each delay is randomly
+	// shortened, so that clients failing together do not retry together.
+	Jitter float64
+
+	// RetryableStatusCodes lists the HTTP status codes worth retrying.
+	RetryableStatusCodes []int
+
+	// RetryableError reports whether a transport level error is worth
+	// retrying. Defaults to IsTemporaryNetError if nil.
+	RetryableError func(error) bool
+
+	// RetryNonIdempotent allows retrying methods such as POST, which may
+	// end up applying the same change twice.
+	RetryNonIdempotent bool
+}
+
+// DefaultRetryPolicy returns the retry policy used by new clients:
+// three attempts with exponential backoff starting at half a second.
+func DefaultRetryPolicy() *RetryPolicy {
+	return &RetryPolicy{
+		MaxAttempts:          3,
+		InitialBackoff:       500 * time.Millisecond,
+		MaxBackoff:           10 * time.Second,
+		Multiplier:           2,
+		Jitter:               0.5,
+		RetryableStatusCodes: append([]int(nil), retryableStatusCodes...),
+	}
+}
+
+// isIdempotent reports whether repeating a request with method has the same
+// effect as sending it once.
+func isIdempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace,
+		http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+// shouldRetry decides whether the outcome of an attempt is worth retrying.
+func (rp *RetryPolicy) shouldRetry(method string, attempt int, resp *http.Response, err error) bool {
+	if rp == nil || attempt >= rp.MaxAttempts {
+		return false
+	}
+	if !rp.RetryNonIdempotent && !isIdempotent(method) {
+		return false
+	}
+	if err != nil {
+		return rp.retryableNetError(err)
+	}
+	return rp.retryableStatus(resp.StatusCode)
+}
+
+// retryableCallError reports whether an error returned by Call is worth
+// retrying, leaving aside whether the method is idempotent.
+func (rp *RetryPolicy) retryableCallError(err error) bool {
+	if rp == nil {
+		return false
+	}
+	if aerr, ok := asError(err); ok {
+		return rp.retryableStatus(aerr.StatusCode)
+	}
+	return rp.retryableNetError(err)
+}
+
+func (rp *RetryPolicy) retryableNetError(err error) bool {
+	if rp.RetryableError != nil {
+		return rp.RetryableError(err)
+	}
+	return IsTemporaryNetError(err)
+}
+
+func (rp *RetryPolicy) retryableStatus(code int) bool {
+	for _, c := range rp.RetryableStatusCodes {
+		if code == c {
+			return true
+		}
+	}
+	return false
+}
+
+// backoff returns how long to wait before the given retry. A Retry-After
+// header on the failed response takes precedence if it asks for longer.
+func (rp *RetryPolicy) backoff(attempt int, resp *http.Response) time.Duration {
+	d := float64(rp.InitialBackoff)
+	if rp.Multiplier > 0 {
+		d *= math.Pow(rp.Multiplier, float64(attempt-1))
+	}
+	if rp.MaxBackoff > 0 && d > float64(rp.MaxBackoff) {
+		d = float64(rp.MaxBackoff)
+	}
+	if rp.Jitter > 0 {
+		d -= d * rp.Jitter * rand.Float64()
+	}
+	wait := time.Duration(d)
+
+	if resp != nil {
+		if after, ok := parseRetryAfter(resp.Header.Get("Retry-After")); ok && after > wait {
+			wait = after
+		}
+	}
+	return wait
+}
+
+// parseRetryAfter parses a Retry-After header given either in seconds or as
+// an HTTP date.
+func parseRetryAfter(v string) (time.Duration, bool) {
+	if v == "" {
+		return 0, false
+	}
+	if secs, err := strconv.Atoi(v); err == nil {
+		if secs < 0 {
+			return 0, false
+		}
+		return time.Duration(secs) * time.Second, true
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		d := time.Until(t)
+		if d < 0 {
+			d = 0
+		}
+		return d, true
+	}
+	return 0, false
+}
+
+// IsTemporaryNetError reports whether err is a network error which may go
+// away when retrying, such as a timeout or a reset connection.
+func IsTemporaryNetError(err error) bool {
+	for err != nil {
+		switch e := err.(type) {
+		case *url.Error:
+			if e.Timeout() {
+				return true
+			}
+			err = e.Err
+		case *net.OpError:
+			if e.Timeout() {
+				return true
+			}
+			err = e.Err
+		case *os.SyscallError:
+			err = e.Err
+		case syscall.Errno:
+			return e == syscall.ECONNRESET || e == syscall.ECONNREFUSED ||
+				e == syscall.ECONNABORTED || e == syscall.EPIPE
+		case net.Error:
+			return e.Timeout()
+		default:
+			return err == io.EOF || err == io.ErrUnexpectedEOF
+		}
+	}
+	return false
+}
+
+// sleepContext waits for d or until ctx is done, whichever happens first.
+func sleepContext(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,119 @@
+package upvest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// countingAuth counts how often requests have been authenticated
+type countingAuth struct {
+	calls *int
+}
+
+func (a countingAuth) GetHeaders(method, path string, body interface{}, c *Client) (Headers, error) {
+	*a.calls++
+	return Headers{"X-Attempt": "1"}, nil
+}
+
+func newFlakyServer(failures int, status int) (*httptest.Server, *int) {
+	hits := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+		if hits <= failures {
+			w.WriteHeader(status)
+			return
+		}
+		w.Write([]byte(`{"id": "1"}`))
+	}))
+	return ts, &hits
+}
+
+func fastRetryPolicy() *RetryPolicy {
+	rp := DefaultRetryPolicy()
+	rp.InitialBackoff = time.Millisecond
+	rp.MaxBackoff = 5 * time.Millisecond
+	return rp
+}
+
+func TestRetryTransientStatus(t *testing.T) {
+	ts, hits := newFlakyServer(2, http.StatusServiceUnavailable)
+	defer ts.Close()
+	c := NewClient(ts.URL, nil)
+	c.Retry = fastRetryPolicy()
+
+	auths := 0
+	resp := &Response{}
+	err := c.Call(http.MethodGet, "/assets/", nil, resp, NewParams(countingAuth{&auths}))
+	if err != nil {
+		t.Fatalf("Call returned error: %v", err)
+	}
+	if *hits != 3 {
+		t.Errorf("Expected 3 attempts, got %d", *hits)
+	}
+	if auths != 3 {
+		t.Errorf("Expected every attempt to be authenticated, got %d", auths)
+	}
+}
+
+func TestRetryGivesUp(t *testing.T) {
+	ts, hits := newFlakyServer(5, http.StatusBadGateway)
+	defer ts.Close()
+	c := NewClient(ts.URL, nil)
+	c.Retry = fastRetryPolicy()
+
+	err := c.Call(http.MethodGet, "/assets/", nil, &Response{}, &Params{})
+	if err == nil {
+		t.Fatalf("Expected error after exhausting retries")
+	}
+	if *hits != c.Retry.MaxAttempts {
+		t.Errorf("Expected %d attempts, got %d", c.Retry.MaxAttempts, *hits)
+	}
+}
+
+func TestRetrySkipsNonIdempotent(t *testing.T) {
+	ts, hits := newFlakyServer(1, http.StatusServiceUnavailable)
+	defer ts.Close()
+	c := NewClient(ts.URL, nil)
+	c.Retry = fastRetryPolicy()
+
+	c.Call(http.MethodPost, "/kms/wallets/", nil, &Response{}, &Params{})
+	if *hits != 1 {
+		t.Errorf("Expected POST not to be retried, got %d attempts", *hits)
+	}
+
+	c.Retry.RetryNonIdempotent = true
+	*hits = 0
+	if err := c.Call(http.MethodPost, "/kms/wallets/", nil, &Response{}, &Params{}); err != nil {
+		t.Errorf("Call returned error: %v", err)
+	}
+	if *hits != 2 {
+		t.Errorf("Expected POST to be retried when allowed, got %d attempts", *hits)
+	}
+}
+
+func TestRetryBackoff(t *testing.T) {
+	rp := &RetryPolicy{InitialBackoff: time.Second, MaxBackoff: 5 * time.Second, Multiplier: 2}
+	expected := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second}
+	for i, want := range expected {
+		if got := rp.backoff(i+1, nil); got != want {
+			t.Errorf("Expected backoff %v for attempt %d, got %v", want, i+1, got)
+		}
+	}
+
+	resp := &http.Response{Header: http.Header{"Retry-After": []string{"7"}}}
+	if got := rp.backoff(1, resp); got != 7*time.Second {
+		t.Errorf("Expected Retry-After to be honoured, got %v", got)
+	}
+}
+
+func TestIsTemporaryNetError(t *testing.T) {
+	if !IsTemporaryNetError(syscall.ECONNRESET) {
+		t.Errorf("Expected connection reset to be temporary")
+	}
+	if IsTemporaryNetError(syscall.EACCES) {
+		t.Errorf("Expected permission denied not to be temporary")
+	}
+}
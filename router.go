@@ -0,0 +1,171 @@
+package upvest
+
+import (
+	"context"
+	"strings"
+	"sync"
+)
+
+// RouteOption restricts the events a route of a Router matches
+type RouteOption func(*route)
+
+// WithProtocol restricts a route to events of a protocol, e.g. "ethereum_ropsten"
+func WithProtocol(name string) RouteOption {
+	return func(r *route) {
+		r.protocol = name
+	}
+}
+
+// WithWallet restricts a route to events of the wallet with an address
+func WithWallet(address string) RouteOption {
+	return func(r *route) {
+		r.wallet = address
+	}
+}
+
+type route struct {
+	noun, verb string
+	protocol   string
+	wallet     string
+	fn         func(ctx context.Context, typed interface{}) error
+}
+
+func (r *route) matches(e *Event) bool {
+	return (r.noun == "" || r.noun == e.EventNoun) &&
+		(r.verb == "" || r.verb == e.EventVerb) &&
+		(r.protocol == "" || r.protocol == e.ProtocolName) &&
+		(r.wallet == "" || strings.EqualFold(r.wallet, e.WalletAddress))
+}
+
+// Router dispatches webhook events to the handlers registered for their noun
+// and verb. Every matching handler is called, in the order of registration.
+// Events without a matching handler are acknowledged and dropped.
+//
+// Usage:
+//
+//	router := upvest.NewRouter()
+//	router.OnTransactionConfirmed(func(ctx context.Context, e *upvest.TransactionEvent) error {
+//		return markPaid(e.Transaction.TxHash)
+//	}, upvest.WithProtocol("ethereum_ropsten"))
+//	receiver.Handle(router.Dispatch)
+type Router struct {
+	mu     sync.RWMutex
+	routes []*route
+}
+
+// NewRouter returns a router without routes
+func NewRouter() *Router {
+	return &Router{}
+}
+
+func (rt *Router) add(noun, verb string, fn func(ctx context.Context, typed interface{}) error, opts []RouteOption) {
+	r := &route{noun: noun, verb: verb, fn: fn}
+	for _, opt := range opts {
+		opt(r)
+	}
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	rt.routes = append(rt.routes, r)
+}
+
+// On registers fn for the events of a noun and verb. An empty noun or verb
+// matches any.
+func (rt *Router) On(noun, verb string, fn EventHandlerFunc, opts ...RouteOption) {
+	rt.add(noun, verb, func(ctx context.Context, typed interface{}) error {
+		return fn(ctx, eventOf(typed))
+	}, opts)
+}
+
+// OnWalletCreated registers fn for wallet creation events
+func (rt *Router) OnWalletCreated(fn func(ctx context.Context, e *WalletEvent) error, opts ...RouteOption) {
+	rt.add(EventNounWallet, EventVerbCreated, func(ctx context.Context, typed interface{}) error {
+		return fn(ctx, typed.(*WalletEvent))
+	}, opts)
+}
+
+// OnTransactionPending registers fn for transactions which were broadcast
+func (rt *Router) OnTransactionPending(fn func(ctx context.Context, e *TransactionEvent) error, opts ...RouteOption) {
+	rt.onTransaction(EventVerbPending, fn, opts)
+}
+
+// OnTransactionConfirmed registers fn for transactions which were mined
+func (rt *Router) OnTransactionConfirmed(fn func(ctx context.Context, e *TransactionEvent) error, opts ...RouteOption) {
+	rt.onTransaction(EventVerbConfirmed, fn, opts)
+}
+
+// OnTransactionFailed registers fn for transactions which failed
+func (rt *Router) OnTransactionFailed(fn func(ctx context.Context, e *TransactionEvent) error, opts ...RouteOption) {
+	rt.onTransaction(EventVerbFailed, fn, opts)
+}
+
+func (rt *Router) onTransaction(verb string, fn func(ctx context.Context, e *TransactionEvent) error, opts []RouteOption) {
+	rt.add(EventNounTransaction, verb, func(ctx context.Context, typed interface{}) error {
+		return fn(ctx, typed.(*TransactionEvent))
+	}, opts)
+}
+
+// OnUserCreated registers fn for user creation events
+func (rt *Router) OnUserCreated(fn func(ctx context.Context, e *UserEvent) error, opts ...RouteOption) {
+	rt.onUser(EventVerbCreated, fn, opts)
+}
+
+// OnUserDeleted registers fn for user deletion events
+func (rt *Router) OnUserDeleted(fn func(ctx context.Context, e *UserEvent) error, opts ...RouteOption) {
+	rt.onUser(EventVerbDeleted, fn, opts)
+}
+
+func (rt *Router) onUser(verb string, fn func(ctx context.Context, e *UserEvent) error, opts []RouteOption) {
+	rt.add(EventNounUser, verb, func(ctx context.Context, typed interface{}) error {
+		return fn(ctx, typed.(*UserEvent))
+	}, opts)
+}
+
+// OnEcho registers fn for echo events, which Upvest sends to test a webhook
+func (rt *Router) OnEcho(fn func(ctx context.Context, e *EchoEvent) error, opts ...RouteOption) {
+	rt.add(EventNounEcho, "", func(ctx context.Context, typed interface{}) error {
+		return fn(ctx, typed.(*EchoEvent))
+	}, opts)
+}
+
+// Dispatch decodes e and calls the matching handlers. It stops at, and
+// returns, the first error. Dispatch is an EventHandlerFunc, so a router
+// is registered with a WebhookReceiver by passing it to Handle.
+func (rt *Router) Dispatch(ctx context.Context, e *Event) error {
+	rt.mu.RLock()
+	var matched []*route
+	for _, r := range rt.routes {
+		if r.matches(e) {
+			matched = append(matched, r)
+		}
+	}
+	rt.mu.RUnlock()
+	if len(matched) == 0 {
+		return nil
+	}
+
+	typed, err := DecodeEvent(e)
+	if err != nil {
+		return err
+	}
+	for _, r := range matched {
+		if err := r.fn(ctx, typed); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// eventOf returns the untyped event of a decoded event.
+func eventOf(typed interface{}) *Event {
+	switch e := typed.(type) {
+	case *WalletEvent:
+		return e.Event
+	case *TransactionEvent:
+		return e.Event
+	case *UserEvent:
+		return e.Event
+	case *EchoEvent:
+		return e.Event
+	}
+	return typed.(*Event)
+}
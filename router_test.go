@@ -0,0 +1,90 @@
+package upvest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func newEvent(noun, verb, protocol, wallet string, data map[string]interface{}) *Event {
+	raw, _ := json.Marshal(data)
+	return &Event{ID: "e1", EventNoun: noun, EventVerb: verb, ProtocolName: protocol, WalletAddress: wallet, Data: raw}
+}
+
+func TestDecodeEvent(t *testing.T) {
+	e := newEvent(EventNounTransaction, EventVerbConfirmed, "ethereum_ropsten", "0xabc", map[string]interface{}{
+		"id": "t1", "txhash": "0x01", "quantity": 10, "exponent": 18, "confirmations": 12,
+	})
+	typed, err := DecodeEvent(e)
+	if err != nil {
+		t.Fatalf("DecodeEvent returned error: %v", err)
+	}
+	te, ok := typed.(*TransactionEvent)
+	if !ok {
+		t.Fatalf("Expected *TransactionEvent, got %T", typed)
+	}
+	if te.Transaction.TxHash != "0x01" || te.Transaction.Quantity.MinorString() != "10" || te.Confirmations != 12 || te.ID != "e1" {
+		t.Errorf("Unexpected transaction event %+v", te)
+	}
+
+	typed, err = DecodeEvent(newEvent("invoice", "paid", "", "", nil))
+	if err != nil {
+		t.Fatalf("DecodeEvent returned error: %v", err)
+	}
+	if _, ok := typed.(*Event); !ok {
+		t.Errorf("Expected unknown events to stay *Event, got %T", typed)
+	}
+}
+
+func TestRouterDispatch(t *testing.T) {
+	router := NewRouter()
+	var calls []string
+	router.OnTransactionConfirmed(func(ctx context.Context, e *TransactionEvent) error {
+		calls = append(calls, "confirmed:"+e.Transaction.TxHash)
+		return nil
+	})
+	router.OnTransactionConfirmed(func(ctx context.Context, e *TransactionEvent) error {
+		calls = append(calls, "wallet")
+		return nil
+	}, WithWallet("0xABC"), WithProtocol("ethereum_ropsten"))
+	router.OnTransactionFailed(func(ctx context.Context, e *TransactionEvent) error {
+		return errors.New("failed")
+	})
+	router.OnWalletCreated(func(ctx context.Context, e *WalletEvent) error {
+		calls = append(calls, "wallet created:"+e.Wallet.Address)
+		return nil
+	})
+	router.On(EventNounEcho, "", func(ctx context.Context, e *Event) error {
+		calls = append(calls, "echo:"+e.ID)
+		return nil
+	})
+
+	ctx := context.Background()
+	events := []*Event{
+		newEvent(EventNounTransaction, EventVerbConfirmed, "ethereum_ropsten", "0xabc", map[string]interface{}{"txhash": "0x01"}),
+		newEvent(EventNounTransaction, EventVerbConfirmed, "ethereum_ropsten", "0xdef", map[string]interface{}{"txhash": "0x02"}),
+		newEvent(EventNounWallet, EventVerbCreated, "ethereum_ropsten", "0xabc", map[string]interface{}{"address": "0xabc"}),
+		newEvent(EventNounEcho, EventVerbPost, "", "", map[string]interface{}{"echo": "hi"}),
+		newEvent(EventNounUser, EventVerbCreated, "", "", nil),
+	}
+	for _, e := range events {
+		if err := router.Dispatch(ctx, e); err != nil {
+			t.Errorf("Dispatch of %s returned error: %v", e.Type(), err)
+		}
+	}
+	expected := []string{"confirmed:0x01", "wallet", "confirmed:0x02", "wallet created:0xabc", "echo:e1"}
+	if len(calls) != len(expected) {
+		t.Fatalf("Expected calls %v, got %v", expected, calls)
+	}
+	for i := range expected {
+		if calls[i] != expected[i] {
+			t.Errorf("Expected calls %v, got %v", expected, calls)
+			break
+		}
+	}
+
+	if err := router.Dispatch(ctx, newEvent(EventNounTransaction, EventVerbFailed, "", "", nil)); err == nil {
+		t.Error("Expected the handler error to be returned")
+	}
+}
@@ -0,0 +1,256 @@
+package upvest
+
+import (
+	"crypto/ecdsa"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"github.com/decred/dcrd/dcrec/secp256k1/v3"
+	secpecdsa "github.com/decred/dcrd/dcrec/secp256k1/v3/ecdsa"
+)
+
+// ErrSignatureMismatch is returned when a wallet signature does not verify
+var ErrSignatureMismatch = errors.New("upvest: signature does not match")
+
+// parseBigNumber decodes a big number in the format of a signature, "hex" or
+// "decimal". Hex numbers may have a 0x prefix.
+func parseBigNumber(s, format string) (*big.Int, error) {
+	base := 16
+	switch strings.ToLower(format) {
+	case "", "hex":
+		s = strings.TrimPrefix(strings.TrimPrefix(s, "0x"), "0X")
+	case "decimal":
+		base = 10
+	default:
+		return nil, fmt.Errorf("unsupported big number format %q", format)
+	}
+	n, ok := new(big.Int).SetString(s, base)
+	if !ok {
+		return nil, fmt.Errorf("invalid %s number %q", format, s)
+	}
+	return n, nil
+}
+
+// Components returns the r and s components of the signature
+func (sig *Signature) Components() (r, s *big.Int, err error) {
+	if r, err = parseBigNumber(sig.R, sig.BigNumberFormat); err != nil {
+		return nil, nil, fmt.Errorf("r: %w", err)
+	}
+	if s, err = parseBigNumber(sig.S, sig.BigNumberFormat); err != nil {
+		return nil, nil, fmt.Errorf("s: %w", err)
+	}
+	return r, s, nil
+}
+
+// RecoveryID returns the recover component of the signature as 0 or 1.
+// Ethereum style values of 27 and 28 are accepted as well.
+func (sig *Signature) RecoveryID() (int, error) {
+	v, err := strconv.Atoi(strings.TrimSpace(sig.Recover))
+	if err != nil {
+		return 0, fmt.Errorf("invalid recover component %q", sig.Recover)
+	}
+	if v >= 27 {
+		v -= 27
+	}
+	if v != 0 && v != 1 {
+		return 0, fmt.Errorf("invalid recover component %q", sig.Recover)
+	}
+	return v, nil
+}
+
+// Key returns the public key of the wallet included in the signature
+func (sig *Signature) Key() (*ecdsa.PublicKey, error) {
+	if err := sig.checkCurve(); err != nil {
+		return nil, err
+	}
+	coordinate := func(name string) (*big.Int, error) {
+		v, ok := sig.PublicKey[name]
+		if !ok {
+			return nil, fmt.Errorf("public key has no %s coordinate", name)
+		}
+		return parseBigNumber(fmt.Sprint(v), sig.BigNumberFormat)
+	}
+	x, err := coordinate("x")
+	if err != nil {
+		return nil, err
+	}
+	y, err := coordinate("y")
+	if err != nil {
+		return nil, err
+	}
+	pub, err := parsePublicKey(x, y)
+	if err != nil {
+		return nil, err
+	}
+	return pub.ToECDSA(), nil
+}
+
+// parsePublicKey returns the secp256k1 public key at (x, y).
+func parsePublicKey(x, y *big.Int) (*secp256k1.PublicKey, error) {
+	if x.Sign() < 0 || y.Sign() < 0 || x.BitLen() > 256 || y.BitLen() > 256 {
+		return nil, errors.New("public key is not on the curve")
+	}
+	buf := make([]byte, 65)
+	buf[0] = 4
+	copy(buf[33-len(x.Bytes()):33], x.Bytes())
+	copy(buf[65-len(y.Bytes()):], y.Bytes())
+	pub, err := secp256k1.ParsePubKey(buf)
+	if err != nil {
+		return nil, errors.New("public key is not on the curve")
+	}
+	return pub, nil
+}
+
+// checkCurve returns an error unless the signature is an ECDSA signature on
+// secp256k1.
+func (sig *Signature) checkCurve() error {
+	if sig.Algorithm != "" && !strings.EqualFold(sig.Algorithm, "ECDSA") {
+		return fmt.Errorf("unsupported signature algorithm %q", sig.Algorithm)
+	}
+	if !strings.EqualFold(sig.Curve, "secp256k1") {
+		return fmt.Errorf("unsupported curve %q", sig.Curve)
+	}
+	return nil
+}
+
+// Verify verifies the signature of hash against the public key included in
+// the signature. It returns ErrSignatureMismatch if it does not verify.
+func (sig *Signature) Verify(hash []byte) error {
+	pub, err := sig.Key()
+	if err != nil {
+		return err
+	}
+	r, s, err := sig.Components()
+	if err != nil {
+		return err
+	}
+	if !verifySecp256k1(pub, hash, r, s) {
+		return ErrSignatureMismatch
+	}
+	return nil
+}
+
+// RecoverKey recovers the public key which signed hash from the signature
+// and its recover component.
+func (sig *Signature) RecoverKey(hash []byte) (*ecdsa.PublicKey, error) {
+	if err := sig.checkCurve(); err != nil {
+		return nil, err
+	}
+	r, s, err := sig.Components()
+	if err != nil {
+		return nil, err
+	}
+	v, err := sig.RecoveryID()
+	if err != nil {
+		return nil, err
+	}
+	return recoverSecp256k1(hash, r, s, v)
+}
+
+// VerifyWallet verifies the signature of hash by an Ethereum wallet: the
+// signature must verify against the included public key, that key must be
+// recoverable from the signature and derive the wallet's address.
+func (sig *Signature) VerifyWallet(hash []byte, wallet *Wallet) error {
+	if !strings.HasPrefix(wallet.Protocol, "ethereum") && !strings.HasPrefix(wallet.Protocol, "erc20") {
+		return fmt.Errorf("address derivation is not supported for protocol %s", wallet.Protocol)
+	}
+	if err := sig.verifyRecoverable(hash); err != nil {
+		return err
+	}
+	pub, _ := sig.Key()
+	if address := EthereumAddress(pub); !strings.EqualFold(address, wallet.Address) {
+		return fmt.Errorf("%w: key of address %s signed for wallet %s", ErrSignatureMismatch, address, wallet.Address)
+	}
+	return nil
+}
+
+// verifyRecoverable verifies the signature of hash and checks that the
+// public key recovered from it is the included one.
+func (sig *Signature) verifyRecoverable(hash []byte) error {
+	if err := sig.Verify(hash); err != nil {
+		return err
+	}
+	pub, _ := sig.Key()
+	recovered, err := sig.RecoverKey(hash)
+	if err != nil {
+		return err
+	}
+	if recovered.X.Cmp(pub.X) != 0 || recovered.Y.Cmp(pub.Y) != 0 {
+		return fmt.Errorf("%w: recovered key differs from the public key", ErrSignatureMismatch)
+	}
+	return nil
+}
+
+// EthereumAddress derives the EIP-55 checksummed Ethereum address of a
+// secp256k1 public key.
+func EthereumAddress(pub *ecdsa.PublicKey) string {
+	x, y := pub.X.Bytes(), pub.Y.Bytes()
+	buf := make([]byte, 64)
+	copy(buf[32-len(x):32], x)
+	copy(buf[64-len(y):], y)
+	return checksumAddress(Keccak256(buf)[12:])
+}
+
+// checksumAddress formats a 20 byte address with the EIP-55 checksum.
+func checksumAddress(address []byte) string {
+	out := []byte(hex.EncodeToString(address))
+	checksum := Keccak256(out)
+	for i, c := range out {
+		if c >= 'a' && checksum[i/2]>>(4*uint(1-i%2))&0xf >= 8 {
+			out[i] = c - 'a' + 'A'
+		}
+	}
+	return "0x" + string(out)
+}
+
+// scalar converts a signature component to a scalar, reporting whether it
+// is in [1, N-1].
+func scalar(n *big.Int) (*secp256k1.ModNScalar, bool) {
+	if n.Sign() <= 0 || n.BitLen() > 256 {
+		return nil, false
+	}
+	var sc secp256k1.ModNScalar
+	if overflow := sc.SetByteSlice(n.Bytes()); overflow {
+		return nil, false
+	}
+	return &sc, true
+}
+
+// verifySecp256k1 reports whether (r, s) is a signature of hash by pub.
+func verifySecp256k1(pub *ecdsa.PublicKey, hash []byte, r, s *big.Int) bool {
+	key, err := parsePublicKey(pub.X, pub.Y)
+	if err != nil {
+		return false
+	}
+	rs, ok := scalar(r)
+	if !ok {
+		return false
+	}
+	ss, ok := scalar(s)
+	if !ok {
+		return false
+	}
+	return secpecdsa.NewSignature(rs, ss).Verify(hash, key)
+}
+
+// recoverSecp256k1 recovers the public key of a signature (r, s) of hash with
+// the recovery id v, the parity of the y coordinate of the point R.
+func recoverSecp256k1(hash []byte, r, s *big.Int, v int) (*ecdsa.PublicKey, error) {
+	if r.Sign() <= 0 || s.Sign() <= 0 || r.BitLen() > 256 || s.BitLen() > 256 {
+		return nil, ErrSignatureMismatch
+	}
+	// compact form: 27 + recovery id, followed by r and s
+	compact := make([]byte, 65)
+	compact[0] = byte(27 + v)
+	copy(compact[33-len(r.Bytes()):33], r.Bytes())
+	copy(compact[65-len(s.Bytes()):], s.Bytes())
+	pub, _, err := secpecdsa.RecoverCompact(compact, hash)
+	if err != nil {
+		return nil, ErrSignatureMismatch
+	}
+	return pub.ToECDSA(), nil
+}
@@ -0,0 +1,133 @@
+package upvest
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/decred/dcrd/dcrec/secp256k1/v3"
+	secpecdsa "github.com/decred/dcrd/dcrec/secp256k1/v3/ecdsa"
+)
+
+func TestKeccak256(t *testing.T) {
+	cases := map[string]string{
+		"":    "c5d2460186f7233c927e7db2dcc703c0e500b653ca82273b7bfad8045d85a470",
+		"abc": "4e03657aea45a94fc7d47ba826c8d667c0d1e6e33a64a036ec44f58fa12d6c45",
+		// spans two blocks of the 136 byte rate
+		strings.Repeat("a", 200): "96ea54061def936c4be90b518992fdc6f12f535068a256229aca54267b4d084d",
+	}
+	for in, want := range cases {
+		if got := hex.EncodeToString(Keccak256([]byte(in))); got != want {
+			t.Errorf("Keccak256(%q) = %s, want %s", in, got, want)
+		}
+	}
+	if got := hex.EncodeToString(Keccak256(make([]byte, 100), make([]byte, 36))); got != "3a5912a7c5faa06ee4fe906253e339467a9ce87d533c65be3c15cb231cdb25f9" {
+		t.Errorf("Keccak256 of a full block = %s", got)
+	}
+}
+
+func TestEthereumAddress(t *testing.T) {
+	pub := secp256k1.PrivKeyFromBytes([]byte{1}).PubKey().ToECDSA()
+	if got := EthereumAddress(pub); got != "0x7E5F4552091A69125d5DfCb7b8C2659029395Bdf" {
+		t.Errorf("Unexpected address %s", got)
+	}
+}
+
+// testSign signs hash with the private key d.
+func testSign(d int64, hash []byte) *Signature {
+	key := secp256k1.PrivKeyFromBytes(big.NewInt(d).Bytes())
+	compact := secpecdsa.SignCompact(key, hash, false)
+	pub := key.PubKey()
+	return &Signature{
+		BigNumberFormat: "decimal",
+		Algorithm:       "ECDSA",
+		Curve:           "secp256k1",
+		PublicKey:       map[string]interface{}{"x": pub.X().String(), "y": pub.Y().String()},
+		R:               new(big.Int).SetBytes(compact[1:33]).String(),
+		S:               new(big.Int).SetBytes(compact[33:]).String(),
+		Recover:         fmt.Sprint(compact[0] - 27),
+	}
+}
+
+// TestRecoverEIP155 recovers the sender of the example transaction of EIP-155.
+func TestRecoverEIP155(t *testing.T) {
+	signingData, _ := hex.DecodeString("ec098504a817c800825208943535353535353535353535353535353535353535880de0b6b3a764000080018080")
+	hash := Keccak256(signingData)
+	if hex.EncodeToString(hash) != "daf5a779ae972f972197303d7b574746c7ef83eadac0f2791ad23db92e4c8e53" {
+		t.Fatalf("Unexpected signing hash %x", hash)
+	}
+	sig := &Signature{
+		BigNumberFormat: "decimal",
+		Curve:           "secp256k1",
+		R:               "18515461264373351373200002665853028612451056578545711640558177340181847433846",
+		S:               "46948507304638947509940763649030358759909902576025900602547168820602576006531",
+		// v = 37 = chain ID * 2 + 35 + recovery id
+		Recover: "0",
+	}
+	pub, err := sig.RecoverKey(hash)
+	if err != nil {
+		t.Fatalf("RecoverKey returned error: %v", err)
+	}
+	if got := EthereumAddress(pub); got != "0x9d8A62f656a8d1615C1294fd71e9CFb3E4855A4F" {
+		t.Errorf("Recovered address %s", got)
+	}
+
+	x, y := pub.X.String(), pub.Y.String()
+	sig.PublicKey = map[string]interface{}{"x": x, "y": y}
+	if err := sig.Verify(hash); err != nil {
+		t.Errorf("Verify returned error: %v", err)
+	}
+	sig.Recover = "1"
+	if pub, err := sig.RecoverKey(hash); err == nil && EthereumAddress(pub) == "0x9d8A62f656a8d1615C1294fd71e9CFb3E4855A4F" {
+		t.Error("Expected the other recovery id to recover another key")
+	}
+}
+
+func TestSignatureVerify(t *testing.T) {
+	hash := Keccak256([]byte("hello"))
+	sig := testSign(1, hash)
+	wallet := &Wallet{Protocol: "ethereum_ropsten", Address: "0x7e5f4552091a69125d5dfcb7b8c2659029395bdf"}
+	if err := sig.VerifyWallet(hash, wallet); err != nil {
+		t.Fatalf("VerifyWallet returned error: %v", err)
+	}
+
+	if err := sig.Verify(Keccak256([]byte("other"))); !errors.Is(err, ErrSignatureMismatch) {
+		t.Errorf("Expected ErrSignatureMismatch for another hash, got %v", err)
+	}
+	other := *wallet
+	other.Address = "0xf9b44Ba370CAfc6a7AF77D0BDB0d50106823D91b"
+	if err := sig.VerifyWallet(hash, &other); !errors.Is(err, ErrSignatureMismatch) {
+		t.Errorf("Expected ErrSignatureMismatch for another wallet, got %v", err)
+	}
+
+	flipped := *sig
+	if sig.Recover == "1" {
+		flipped.Recover = "27"
+	} else {
+		flipped.Recover = "28"
+	}
+	if err := flipped.VerifyWallet(hash, wallet); !errors.Is(err, ErrSignatureMismatch) {
+		t.Errorf("Expected ErrSignatureMismatch for the wrong recovery id, got %v", err)
+	}
+
+	r, _ := new(big.Int).SetString(sig.R, 10)
+	s, _ := new(big.Int).SetString(sig.S, 10)
+	hexed := *sig
+	hexed.BigNumberFormat = "hex"
+	hexed.R, hexed.S = fmt.Sprintf("0x%064x", r), fmt.Sprintf("%064x", s)
+	x, _ := new(big.Int).SetString(sig.PublicKey["x"].(string), 10)
+	y, _ := new(big.Int).SetString(sig.PublicKey["y"].(string), 10)
+	hexed.PublicKey = map[string]interface{}{"x": fmt.Sprintf("%x", x), "y": fmt.Sprintf("%x", y)}
+	if err := hexed.VerifyWallet(hash, wallet); err != nil {
+		t.Errorf("VerifyWallet of hex encoded signature returned error: %v", err)
+	}
+
+	bad := *sig
+	bad.Curve = "ed25519"
+	if err := bad.Verify(hash); err == nil {
+		t.Error("Expected an error for an unsupported curve")
+	}
+}
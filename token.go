@@ -0,0 +1,167 @@
+package upvest
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// tokenExpiryDelta is how long before its advertised expiry a token is
+// considered stale, so that it is never presented right as it expires.
+const tokenExpiryDelta = 30 * time.Second
+
+// Token is an OAuth2 token along with the absolute time it expires at.
+type Token struct {
+	OAuthResponse
+	Expiry time.Time `json:"expiry"`
+}
+
+// newToken computes the expiry of a token endpoint response received now.
+func newToken(resp *OAuthResponse) *Token {
+	tok := &Token{OAuthResponse: *resp}
+	if resp.ExpiresIn > 0 {
+		tok.Expiry = time.Now().Add(time.Duration(resp.ExpiresIn) * time.Second)
+	}
+	return tok
+}
+
+// Valid reports whether the token is present and not about to expire.
+func (t *Token) Valid() bool {
+	if t == nil || t.AccessToken == "" {
+		return false
+	}
+	if t.Expiry.IsZero() {
+		return true
+	}
+	return time.Now().Add(tokenExpiryDelta).Before(t.Expiry)
+}
+
+// tokenManager caches the token of a single OAuth identity and makes sure
+// that concurrent callers share one token request instead of each
+// issuing their own.
+type tokenManager struct {
+	mu    sync.Mutex
+	token *Token
+	call  *tokenCall
+}
+
+// tokenCall is an in-flight token request.
+type tokenCall struct {
+	done  chan struct{}
+	token *Token
+	err   error
+}
+
+// Token returns a valid token, fetching a new one with fetch if the cached one
+// is missing or stale. fetch receives the stale token (or nil) so it can
+// attempt a refresh.
+func (m *tokenManager) Token(ctx context.Context, fetch func(context.Context, *Token) (*Token, error)) (*Token, error) {
+	for {
+		m.mu.Lock()
+		if m.token.Valid() {
+			tok := m.token
+			m.mu.Unlock()
+			return tok, nil
+		}
+		if call := m.call; call != nil {
+			m.mu.Unlock()
+			select {
+			case <-call.done:
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+			// The leading request may have failed only because its own
+			// context was cancelled; try again with ours.
+			if call.err != nil && isContextErr(call.err) && ctx.Err() == nil {
+				continue
+			}
+			return call.token, call.err
+		}
+
+		call := &tokenCall{done: make(chan struct{})}
+		m.call = call
+		stale := m.token
+		m.mu.Unlock()
+
+		call.token, call.err = fetch(ctx, stale)
+
+		m.mu.Lock()
+		if call.err == nil {
+			m.token = call.token
+		}
+		m.call = nil
+		m.mu.Unlock()
+		close(call.done)
+
+		return call.token, call.err
+	}
+}
+
+// invalidate marks the cached token as expired if it is accessToken, so that
+// the next caller refreshes it. Its refresh token is kept.
+func (m *tokenManager) invalidate(accessToken string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.token != nil && m.token.AccessToken == accessToken {
+		expired := *m.token
+		expired.Expiry = time.Unix(0, 0)
+		m.token = &expired
+	}
+}
+
+// isContextErr reports whether err is a cancellation, which CallContext
+// returns wrapped in a *url.Error.
+func isContextErr(err error) bool {
+	return errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)
+}
+
+// fetchToken obtains a new token, preferring the refresh_token grant when a
+// previous token is available and falling back to the password grant.
+func (oauth OAuth) fetchToken(ctx context.Context, c *Client, stale *Token) (*Token, error) {
+	if stale != nil && stale.RefreshToken != "" {
+		resp, err := oauth.refresh(ctx, c, stale.RefreshToken)
+		if err == nil {
+			return newToken(resp), nil
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		c.logEntry(LogLevelInfo, "OAuth2 token refresh failed, falling back to password grant", Fields{"error": err})
+		if oauth.store != nil {
+			oauth.store.Delete(oauth.tokenKey())
+		}
+	}
+
+	resp, err := oauth.preFlight(ctx, c)
+	if err != nil {
+		return nil, err
+	}
+	return newToken(resp), nil
+}
+
+func (oauth OAuth) refresh(ctx context.Context, c *Client, refreshToken string) (*OAuthResponse, error) {
+	data := url.Values{}
+	data.Add("grant_type", refreshGrantType)
+	data.Add("refresh_token", refreshToken)
+	data.Add("client_id", oauth.clientID)
+	data.Add("client_secret", oauth.clientSecret)
+	return requestToken(ctx, c, data)
+}
+
+// requestToken posts the form encoded token request to the OAuth2 endpoint.
+func requestToken(ctx context.Context, c *Client, data url.Values) (*OAuthResponse, error) {
+	payload := bytes.NewBufferString(data.Encode())
+
+	p := &Params{}
+	// TODO: refactor this to pass content type to Call/CallRaw
+	p.AddHeader("Content-Type", URLEncodeHeader)
+	p.AddHeader("Cache-Control", "no-cache")
+
+	resp := &OAuthResponse{}
+	err := c.CallContext(ctx, http.MethodPost, oauthPath, payload, resp, p)
+	return resp, err
+}
@@ -0,0 +1,157 @@
+package upvest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// tokenServer is a minimal OAuth2 token endpoint counting the grants it serves
+type tokenServer struct {
+	*httptest.Server
+	passwordGrants int32
+	refreshGrants  int32
+	expiresIn      int
+	failRefresh    bool
+	// reject makes every other request fail with 401
+	reject bool
+}
+
+func newTokenServer(expiresIn int) *tokenServer {
+	ts := &tokenServer{expiresIn: expiresIn}
+	ts.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/1.0/clientele/oauth2/token" {
+			if ts.reject {
+				w.WriteHeader(http.StatusUnauthorized)
+			}
+			w.Write([]byte(`{}`))
+			return
+		}
+		r.ParseForm()
+		var n int32
+		switch r.PostForm.Get("grant_type") {
+		case grantType:
+			n = atomic.AddInt32(&ts.passwordGrants, 1)
+		case refreshGrantType:
+			if ts.failRefresh {
+				w.WriteHeader(http.StatusBadRequest)
+				w.Write([]byte(`{"error": "invalid_grant"}`))
+				return
+			}
+			n = atomic.AddInt32(&ts.refreshGrants, 1)
+		}
+		fmt.Fprintf(w, `{"access_token": "token-%s-%d", "expires_in": %d, "token_type": "Bearer", "refresh_token": "refresh"}`,
+			r.PostForm.Get("grant_type"), n, ts.expiresIn)
+	}))
+	return ts
+}
+
+func TestOAuthTokenCached(t *testing.T) {
+	ts := newTokenServer(3600)
+	defer ts.Close()
+	auth := OAuth{clientID: "id", clientSecret: "secret", username: "user", password: "pw", tokens: &tokenManager{}}
+	c := NewClient(ts.URL, nil)
+
+	for i := 0; i < 3; i++ {
+		headers, err := auth.GetHeadersContext(context.Background(), http.MethodGet, "/kms/wallets/", nil, c)
+		if err != nil {
+			t.Fatalf("GetHeaders returned error: %v", err)
+		}
+		if headers["Authorization"] != "Bearer token-password-1" {
+			t.Errorf("Expected cached token, got %s", headers["Authorization"])
+		}
+	}
+	if ts.passwordGrants != 1 {
+		t.Errorf("Expected 1 password grant, got %d", ts.passwordGrants)
+	}
+}
+
+func TestOAuthTokenRefresh(t *testing.T) {
+	// a lifetime shorter than the expiry delta makes every token stale at once
+	ts := newTokenServer(1)
+	defer ts.Close()
+	auth := OAuth{clientID: "id", clientSecret: "secret", username: "user", password: "pw", tokens: &tokenManager{}}
+	c := NewClient(ts.URL, nil)
+
+	auth.GetHeaders(http.MethodGet, "/kms/wallets/", nil, c)
+	headers, err := auth.GetHeaders(http.MethodGet, "/kms/wallets/", nil, c)
+	if err != nil {
+		t.Fatalf("GetHeaders returned error: %v", err)
+	}
+	if headers["Authorization"] != "Bearer token-refresh_token-1" {
+		t.Errorf("Expected refreshed token, got %s", headers["Authorization"])
+	}
+
+	ts.failRefresh = true
+	headers, err = auth.GetHeaders(http.MethodGet, "/kms/wallets/", nil, c)
+	if err != nil {
+		t.Fatalf("GetHeaders returned error: %v", err)
+	}
+	if headers["Authorization"] != "Bearer token-password-2" {
+		t.Errorf("Expected fallback to password grant, got %s", headers["Authorization"])
+	}
+}
+
+func TestOAuthTokenConcurrent(t *testing.T) {
+	ts := newTokenServer(3600)
+	defer ts.Close()
+	auth := OAuth{clientID: "id", clientSecret: "secret", username: "user", password: "pw", tokens: &tokenManager{}}
+	c := NewClient(ts.URL, nil)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := auth.GetHeaders(http.MethodGet, "/kms/wallets/", nil, c); err != nil {
+				t.Errorf("GetHeaders returned error: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if ts.passwordGrants != 1 {
+		t.Errorf("Expected concurrent requests to share 1 password grant, got %d", ts.passwordGrants)
+	}
+}
+
+func TestOAuthTokenRejected(t *testing.T) {
+	ts := newTokenServer(3600)
+	defer ts.Close()
+	ts.reject = true
+	store := NewMemoryTokenStore()
+	auth := OAuth{clientID: "id", clientSecret: "secret", username: "user", password: "pw", tokens: &tokenManager{}, store: store}
+	c := NewClient(ts.URL, nil)
+
+	// a rejected token is replaced once, by refreshing it
+	err := c.Call(http.MethodGet, "/kms/wallets/", nil, &Response{}, NewParams(auth))
+	if !errors.Is(err, ErrUnauthorized) {
+		t.Errorf("Expected ErrUnauthorized, got %v", err)
+	}
+	if ts.passwordGrants != 1 || ts.refreshGrants != 1 {
+		t.Errorf("Expected 1 password and 1 refresh grant, got %d and %d", ts.passwordGrants, ts.refreshGrants)
+	}
+	if stored, _ := store.Get(auth.tokenKey()); stored == nil || stored.AccessToken != "token-refresh_token-1" {
+		t.Errorf("Expected the stored token to be replaced, got %+v", stored)
+	}
+}
+
+func TestIsContextErr(t *testing.T) {
+	cases := map[error]bool{
+		context.Canceled: true,
+		&url.Error{Op: "Post", URL: "/oauth2/token", Err: context.DeadlineExceeded}:                    true,
+		fmt.Errorf("refresh: %w", &url.Error{Op: "Post", URL: "/oauth2/token", Err: context.Canceled}): true,
+		&Error{StatusCode: http.StatusUnauthorized}:                                                    false,
+	}
+	for err, want := range cases {
+		if got := isContextErr(err); got != want {
+			t.Errorf("isContextErr(%v) = %v, want %v", err, got, want)
+		}
+	}
+}
@@ -0,0 +1,160 @@
+package upvest
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// TokenKey identifies the OAuth identity a token was issued to.
+type TokenKey struct {
+	ClientID string
+	Username string
+}
+
+// String returns the textual representation of the key
+func (k TokenKey) String() string {
+	return k.ClientID + ":" + k.Username
+}
+
+// TokenStore persists OAuth tokens so that they can outlive the process that
+// requested them and be shared between processes.
+// Get returns a nil token and a nil error if no token is stored for the key.
+// Implementations must be safe for concurrent use.
+type TokenStore interface {
+	Get(key TokenKey) (*Token, error)
+	Put(key TokenKey, token *Token) error
+	Delete(key TokenKey) error
+}
+
+// MemoryTokenStore is a TokenStore keeping tokens in memory. It can be used to
+// share tokens between several clientele APIs in the same process.
+type MemoryTokenStore struct {
+	mu     sync.RWMutex
+	tokens map[TokenKey]Token
+}
+
+// NewMemoryTokenStore creates an empty in-memory token store
+func NewMemoryTokenStore() *MemoryTokenStore {
+	return &MemoryTokenStore{tokens: make(map[TokenKey]Token)}
+}
+
+// Get returns the token stored for key
+func (s *MemoryTokenStore) Get(key TokenKey) (*Token, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	tok, ok := s.tokens[key]
+	if !ok {
+		return nil, nil
+	}
+	return &tok, nil
+}
+
+// Put stores the token for key, replacing any previous one
+func (s *MemoryTokenStore) Put(key TokenKey, token *Token) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tokens[key] = *token
+	return nil
+}
+
+// Delete removes the token stored for key
+func (s *MemoryTokenStore) Delete(key TokenKey) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.tokens, key)
+	return nil
+}
+
+// FileTokenStore is a TokenStore keeping each token in its own file, encrypted
+// with AES-GCM. Files are replaced atomically, so the same directory may be
+// shared by several processes.
+type FileTokenStore struct {
+	dir  string
+	aead cipher.AEAD
+}
+
+// NewFileTokenStore creates a token store in dir, which is created if needed.
+// The encryption key must be 16, 24 or 32 bytes long to select AES-128,
+// AES-192 or AES-256.
+func NewFileTokenStore(dir string, key []byte) (*FileTokenStore, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid token encryption key")
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, errors.Wrap(err, "could not create token directory")
+	}
+	return &FileTokenStore{dir: dir, aead: aead}, nil
+}
+
+// filename returns the name of the file holding the token for key.
+// The identity is hashed so that usernames never appear on disk.
+func (s *FileTokenStore) filename(key TokenKey) string {
+	sum := sha256.Sum256([]byte(key.String()))
+	return hex.EncodeToString(sum[:]) + ".token"
+}
+
+// Get returns the token stored for key
+func (s *FileTokenStore) Get(key TokenKey) (*Token, error) {
+	data, err := ioutil.ReadFile(filepath.Join(s.dir, s.filename(key)))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	size := s.aead.NonceSize()
+	if len(data) < size {
+		return nil, errors.New("token file is corrupt")
+	}
+	plain, err := s.aead.Open(nil, data[:size], data[size:], []byte(key.String()))
+	if err != nil {
+		return nil, errors.Wrap(err, "could not decrypt token file")
+	}
+
+	tok := &Token{}
+	if err := json.Unmarshal(plain, tok); err != nil {
+		return nil, errors.Wrap(err, "could not decode token file")
+	}
+	return tok, nil
+}
+
+// Put stores the token for key, replacing any previous one
+func (s *FileTokenStore) Put(key TokenKey, token *Token) error {
+	plain, err := json.Marshal(token)
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, s.aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return err
+	}
+	data := s.aead.Seal(nonce, nonce, plain, []byte(key.String()))
+
+	return writeFileAtomic(s.dir, s.filename(key), data)
+}
+
+// Delete removes the token stored for key
+func (s *FileTokenStore) Delete(key TokenKey) error {
+	err := os.Remove(filepath.Join(s.dir, s.filename(key)))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,101 @@
+package upvest
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func testTokenStore(t *testing.T, store TokenStore) {
+	key := TokenKey{ClientID: "id", Username: "user"}
+
+	tok, err := store.Get(key)
+	if err != nil || tok != nil {
+		t.Fatalf("Expected no token, got %+v, %v", tok, err)
+	}
+
+	expiry := time.Now().Add(time.Hour).Round(time.Second)
+	err = store.Put(key, &Token{OAuthResponse: OAuthResponse{AccessToken: "access", RefreshToken: "refresh"}, Expiry: expiry})
+	if err != nil {
+		t.Fatalf("Put returned error: %v", err)
+	}
+
+	tok, err = store.Get(key)
+	if err != nil {
+		t.Fatalf("Get returned error: %v", err)
+	}
+	if tok.AccessToken != "access" || tok.RefreshToken != "refresh" || !tok.Expiry.Equal(expiry) {
+		t.Errorf("Expected stored token, got %+v", tok)
+	}
+
+	other, err := store.Get(TokenKey{ClientID: "id", Username: "other"})
+	if err != nil || other != nil {
+		t.Errorf("Expected no token for other user, got %+v, %v", other, err)
+	}
+
+	if err := store.Delete(key); err != nil {
+		t.Fatalf("Delete returned error: %v", err)
+	}
+	tok, err = store.Get(key)
+	if err != nil || tok != nil {
+		t.Errorf("Expected token to be deleted, got %+v, %v", tok, err)
+	}
+}
+
+func TestMemoryTokenStore(t *testing.T) {
+	testTokenStore(t, NewMemoryTokenStore())
+}
+
+func TestFileTokenStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "upvest-tokens")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	key := bytes.Repeat([]byte{1}, 32)
+	store, err := NewFileTokenStore(dir, key)
+	if err != nil {
+		t.Fatalf("NewFileTokenStore returned error: %v", err)
+	}
+	testTokenStore(t, store)
+
+	// tokens must not be stored in clear text nor readable with another key
+	tk := TokenKey{ClientID: "id", Username: "user"}
+	store.Put(tk, &Token{OAuthResponse: OAuthResponse{AccessToken: "secret-access-token"}})
+	files, _ := filepath.Glob(filepath.Join(dir, "*.token"))
+	if len(files) != 1 {
+		t.Fatalf("Expected 1 token file, got %d", len(files))
+	}
+	data, _ := ioutil.ReadFile(files[0])
+	if bytes.Contains(data, []byte("secret-access-token")) {
+		t.Errorf("Expected token file to be encrypted")
+	}
+	other, _ := NewFileTokenStore(dir, bytes.Repeat([]byte{2}, 32))
+	if _, err := other.Get(tk); err == nil {
+		t.Errorf("Expected decrypting with the wrong key to fail")
+	}
+}
+
+// Tests that clienteles sharing a store share their token
+func TestOAuthTokenStore(t *testing.T) {
+	ts := newTokenServer(3600)
+	defer ts.Close()
+	c := NewClient(ts.URL, nil)
+	c.TokenStore = NewMemoryTokenStore()
+
+	for i := 0; i < 2; i++ {
+		clientele := c.NewClientele("id", "secret", "user", "pw")
+		auth := clientele.Wallet.auth.(OAuth)
+		if _, err := auth.GetHeaders(http.MethodGet, "/kms/wallets/", nil, c); err != nil {
+			t.Fatalf("GetHeaders returned error: %v", err)
+		}
+	}
+	if ts.passwordGrants != 1 {
+		t.Errorf("Expected 1 password grant, got %d", ts.passwordGrants)
+	}
+}
@@ -1,12 +1,15 @@
 package upvest
 
 import (
+	"context"
 	"fmt"
 	"net/http"
-	"net/url"
-	"strconv"
+	"strings"
+	"time"
 
+	"github.com/google/uuid"
 	"github.com/pkg/errors"
+	"github.com/upvestco/upvest-go/internal/ethenc"
 )
 
 // Transaction represents a wallet transaction
@@ -17,12 +20,14 @@ type Transaction struct {
 	WalletID  string `json:"wallet_id"`
 	AssetID   string `json:"asset_id"`
 	AssetName string `json:"asset_name"`
-	Exponent  string `json:"exponent"`
+	Exponent  int    `json:"exponent"`
 	Sender    string `json:"sender"`
 	Recipient string `json:"recipient"`
-	Quantity  string `json:"quantity"`
-	Fee       string `json:"fee"`
-	Status    string `json:"status"`
+	Quantity  Amount `json:"quantity"`
+	// Fee is in the minor units of the protocol's native asset, so its
+	// exponent is not known and left at 0.
+	Fee    Amount `json:"fee"`
+	Status string `json:"status"`
 }
 
 // TransactionParams is the set of parameters that can be used when creating a transaction
@@ -30,8 +35,8 @@ type Transaction struct {
 type TransactionParams struct {
 	Password  string `json:"password"`
 	AssetID   string `json:"asset_id"`
-	Quantity  int64  `json:"quantity"`
-	Fee       int64  `json:"fee"`
+	Quantity  Amount `json:"quantity"`
+	Fee       Amount `json:"fee"`
 	Recipient string `json:"recipient"`
 }
 
@@ -47,88 +52,337 @@ type TransactionList struct {
 	Values []Transaction `json:"results"`
 }
 
+// SubmitOption configures the submission of a transaction
+type SubmitOption func(*submitOptions)
+
+type submitOptions struct {
+	idempotencyKey string
+	feeEstimator   FeeEstimator
+	feeSpeed       FeeSpeed
+	feeCeiling     Amount
+	// fingerprint, if set, replaces the body when fingerprinting the submission.
+	fingerprint interface{}
+}
+
+// WithIdempotencyKey submits the transaction under the given idempotency key
+// instead of a generated one. Reusing the key of an earlier submission, e.g.
+// after a crash, returns the transaction created by that submission rather
+// than sending it again, provided the client has an IdempotencyStore.
+func WithIdempotencyKey(key string) SubmitOption {
+	return func(o *submitOptions) {
+		o.idempotencyKey = key
+	}
+}
+
 // Create creates a new transaction
 // For more details https://doc.upvest.co/reference#kms_transaction_create
-func (s *TransactionService) Create(walletID string, tp *TransactionParams) (*Transaction, error) {
+func (s *TransactionService) Create(walletID string, tp *TransactionParams, opts ...SubmitOption) (*Transaction, error) {
+	return s.CreateContext(context.Background(), walletID, tp, opts...)
+}
+
+// CreateContext is like Create but takes a context.
+func (s *TransactionService) CreateContext(ctx context.Context, walletID string, tp *TransactionParams, opts ...SubmitOption) (*Transaction, error) {
 	u := fmt.Sprintf("/kms/wallets/%s/transactions/", walletID)
-	transaction := &Transaction{}
-	p := &Params{}
-	p.SetAuthProvider(s.auth)
-	err := s.client.Call(http.MethodPost, u, tp, transaction, p)
-	return transaction, err
+	o := &submitOptions{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	if err := s.validateRecipient(ctx, walletID, tp.Recipient); err != nil {
+		return nil, err
+	}
+	if o.feeEstimator == nil {
+		return s.submit(ctx, walletID, u, tp, tp.matches, opts)
+	}
+
+	estimated, err := s.estimateFee(ctx, walletID, tp, o)
+	if err != nil {
+		return nil, err
+	}
+	unfeed := *tp
+	unfeed.Fee = Amount{}
+	opts = append(opts, func(o *submitOptions) { o.fingerprint = &unfeed })
+	// a resumed submission may have been posted with an earlier estimate
+	return s.submit(ctx, walletID, u, estimated, unfeed.matchesPayment, opts)
+}
+
+// matches reports whether txn could have been created from these parameters.
+func (tp *TransactionParams) matches(txn *Transaction) bool {
+	return tp.matchesPayment(txn) && txn.Fee.Minor().Cmp(tp.Fee.Minor()) == 0
+}
+
+// matchesPayment is like matches but ignores the fee.
+func (tp *TransactionParams) matchesPayment(txn *Transaction) bool {
+	return txn.AssetID == tp.AssetID &&
+		strings.EqualFold(txn.Recipient, tp.Recipient) &&
+		txn.Quantity.Minor().Cmp(tp.Quantity.Minor()) == 0
 }
 
 // Get returns the details of a transaction.
 // For more details see https://doc.upvest.co/reference#kms_transactions_read
 func (s *TransactionService) Get(walletID, txnID string) (*Transaction, error) {
+	return s.GetContext(context.Background(), walletID, txnID)
+}
+
+// GetContext is like Get but takes a context.
+func (s *TransactionService) GetContext(ctx context.Context, walletID, txnID string) (*Transaction, error) {
 	u := fmt.Sprintf("/kms/wallets/%s/transactions/%s", walletID, txnID)
 	txn := &Transaction{}
 	p := &Params{}
 	p.SetAuthProvider(s.auth)
-	err := s.client.Call(http.MethodGet, u, nil, txn, p)
+	err := s.client.CallContext(ctx, http.MethodGet, u, nil, txn, p)
 	return txn, err
 }
 
 // List returns list of all transactions.
 // For more details see https://doc.upvest.co/reference#kms_transaction_list
 func (s *TransactionService) List(walletID string) (*TransactionList, error) {
-	path := fmt.Sprintf("/kms/wallets/%s/transactions/", walletID)
-	u, _ := url.Parse(path)
-	p := &Params{}
-	p.SetAuthProvider(s.auth)
+	return s.ListContext(context.Background(), walletID)
+}
 
-	var results []Transaction
-	transactions := &TransactionList{}
+// ListContext is like List but takes a context.
+func (s *TransactionService) ListContext(ctx context.Context, walletID string) (*TransactionList, error) {
+	return s.list(s.Iter(ctx, walletID, nil))
+}
 
-	for {
-		err := s.client.Call(http.MethodGet, u.String(), nil, transactions, p)
-		if err != nil {
-			return nil, errors.Wrap(err, "Could not retrieve list of transactions")
-		}
-		results = append(results, transactions.Values...)
+// ListN returns a specific number of transactions
+// For more details see https://doc.upvest.co/reference#kms_transaction_list
+func (s *TransactionService) ListN(walletID string, count int) (*TransactionList, error) {
+	return s.ListNContext(context.Background(), walletID, count)
+}
 
-		// append page_size param to the returned params
-		u1, err := url.Parse(transactions.Meta.Next)
-		if err != nil {
-			return nil, errors.Wrap(err, "Can not parse url")
-		}
-		q := u1.Query()
-		q.Set("page_size", strconv.Itoa(MaxPageSize))
-		u.RawQuery = q.Encode()
-		if transactions.Meta.Next == "" {
-			break
-		}
+// ListNContext is like ListN but takes a context.
+func (s *TransactionService) ListNContext(ctx context.Context, walletID string, count int) (*TransactionList, error) {
+	if count <= 0 {
+		return &TransactionList{}, nil
 	}
+	return s.list(s.Iter(ctx, walletID, &ListOptions{Limit: count}))
+}
+
+// TransactionIter is an iterator over transactions.
+type TransactionIter struct {
+	*Iter
+}
+
+// Value returns the transaction at the current position
+func (it *TransactionIter) Value() *Transaction {
+	return it.Current().(*Transaction)
+}
 
+// Iter returns an iterator over transactions, fetching pages as they are needed.
+func (s *TransactionService) Iter(ctx context.Context, walletID string, opts *ListOptions) *TransactionIter {
+	path := fmt.Sprintf("/kms/wallets/%s/transactions/", walletID)
+	return &TransactionIter{s.newIter(ctx, path, opts, func(v interface{}) (interface{}, error) {
+		transaction := &Transaction{}
+		err := mapstruct(v, transaction)
+		return transaction, err
+	})}
+}
+
+// list collects the transactions of the iterator.
+func (s *TransactionService) list(it *TransactionIter) (*TransactionList, error) {
+	var results []Transaction
+	for it.Next() {
+		results = append(results, *it.Value())
+	}
+	if err := it.Err(); err != nil {
+		return nil, fmt.Errorf("Could not retrieve list of transactions: %w", err)
+	}
 	return &TransactionList{Values: results}, nil
 }
 
 // CreateComplex creates a complex transaction
 // For more details https://doc.upvest.co/docs/complex-transactions
-func (s *TransactionService) CreateComplex(walletID string, password string, tx DataParams, fund bool) (*Transaction, error) {
+func (s *TransactionService) CreateComplex(walletID string, password string, tx DataParams, fund bool, opts ...SubmitOption) (*Transaction, error) {
+	return s.CreateComplexContext(context.Background(), walletID, password, tx, fund, opts...)
+}
+
+// CreateComplexContext is like CreateComplex but takes a context.
+func (s *TransactionService) CreateComplexContext(ctx context.Context, walletID string, password string, tx DataParams, fund bool, opts ...SubmitOption) (*Transaction, error) {
+	if err := rejectEstimatedFee(opts); err != nil {
+		return nil, err
+	}
 	u := fmt.Sprintf("/kms/wallets/%s/transactions/complex", walletID)
-	txn := &Transaction{}
 	data := DataParams{"password": password, "tx": tx, "fund": fund}
-	p := &Params{}
-	p.SetAuthProvider(s.auth)
-	err := s.client.Call(http.MethodPost, u, data, txn, p)
-	return txn, err
+	return s.submit(ctx, walletID, u, data, complexMatcher(tx), opts)
+}
+
+// complexMatcher matches transactions against the recipient and value of a
+// complex transaction. The value may be decimal or hex. Transactions do not
+// report their data or nonce, so contract calls and transactions with a
+// nonce can not be recognised; like transactions without a recipient or a
+// valid value, they get no matcher and rely on the idempotency key alone.
+func complexMatcher(tx DataParams) func(*Transaction) bool {
+	to, ok := tx["to"].(string)
+	if !ok {
+		return nil
+	}
+	if data, ok := tx["data"]; ok && data != "" && data != "0x" {
+		return nil
+	}
+	if _, ok := tx["nonce"]; ok {
+		return nil
+	}
+	value, err := ethenc.Int(tx["value"])
+	if err != nil {
+		return nil
+	}
+	return func(txn *Transaction) bool {
+		return strings.EqualFold(txn.Recipient, to) && txn.Quantity.Minor().Cmp(value) == 0
+	}
 }
 
 // CreateRaw creates a raw transaction
 // For more details https://doc.upvest.co/docs/complex-transactions
 func (s *TransactionService) CreateRaw(walletID string, password string,
-	rawTx DataParams, fund bool, inputFormat string) (*Transaction, error) {
+	rawTx DataParams, fund bool, inputFormat string, opts ...SubmitOption) (*Transaction, error) {
+	return s.CreateRawContext(context.Background(), walletID, password, rawTx, fund, inputFormat, opts...)
+}
+
+// CreateRawContext is like CreateRaw but takes a context.
+// Raw transactions are opaque to the client, so retried submissions rely on
+// the idempotency key header alone.
+func (s *TransactionService) CreateRawContext(ctx context.Context, walletID string, password string,
+	rawTx DataParams, fund bool, inputFormat string, opts ...SubmitOption) (*Transaction, error) {
+	if err := rejectEstimatedFee(opts); err != nil {
+		return nil, err
+	}
 	u := fmt.Sprintf("/kms/wallets/%s/transactions/raw", walletID)
-	txn := &Transaction{}
 	data := map[string]interface{}{
 		"password":     password,
 		"raw_tx":       rawTx,
 		"fund":         fund,
 		"input_format": inputFormat,
 	}
-	p := &Params{}
-	p.SetAuthProvider(s.auth)
-	err := s.client.Call(http.MethodPost, u, data, txn, p)
-	return txn, err
+	return s.submit(ctx, walletID, u, data, nil, opts)
+}
+
+// submit posts a new transaction under an idempotency key and retries it
+// while the failure is transient. Before every retry, and before resuming a
+// submission found in the client's IdempotencyStore, the wallet's
+// transactions are searched with match for one which already landed, so
+// that the transaction is never sent twice. Only transactions created after
+// the first attempt are searched, so an identical earlier payment is never
+// taken for this one. A nil match disables the search. Transactions which
+// have failed never match.
+func (s *TransactionService) submit(ctx context.Context, walletID, path string, body interface{},
+	match func(*Transaction) bool, opts []SubmitOption) (*Transaction, error) {
+	o := &submitOptions{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	if o.idempotencyKey == "" {
+		o.idempotencyKey = uuid.New().String()
+	}
+
+	fpBody := body
+	if o.fingerprint != nil {
+		fpBody = o.fingerprint
+	}
+	fp, err := fingerprint(path, fpBody)
+	if err != nil {
+		return nil, errors.Wrap(err, "json encoding failed")
+	}
+
+	store := s.client.IdempotencyStore
+	var rec *IdempotencyRecord
+	if store != nil {
+		if rec, err = store.Get(o.idempotencyKey); err != nil {
+			return nil, errors.Wrap(err, "could not load idempotency record")
+		}
+	}
+	if rec == nil {
+		rec = &IdempotencyRecord{Key: o.idempotencyKey, WalletID: walletID, Fingerprint: fp, CreatedAt: time.Now()}
+		if match != nil && s.mayResubmit() {
+			// without the snapshot the submission relies on the idempotency
+			// key alone, which is no reason to fail it
+			if rec.PriorTransactionIDs, err = s.transactionIDs(ctx, walletID); err != nil {
+				s.client.logEntry(LogLevelError, "could not snapshot transactions", Fields{"error": err})
+			}
+		}
+	} else if rec.Fingerprint != fp || rec.WalletID != walletID {
+		return nil, ErrIdempotencyKeyReused
+	} else if rec.TransactionID != "" {
+		return s.GetContext(ctx, walletID, rec.TransactionID)
+	}
+	save := func() {
+		if store != nil {
+			if err := store.Put(rec); err != nil {
+				s.client.logEntry(LogLevelError, "could not save idempotency record", Fields{"error": err})
+			}
+		}
+	}
+
+	for attempt := 1; ; attempt++ {
+		if rec.Attempts > 0 && match != nil && rec.PriorTransactionIDs != nil {
+			txn, err := s.findTransaction(ctx, walletID, rec.PriorTransactionIDs, match)
+			if err != nil {
+				return nil, err
+			}
+			if txn != nil {
+				rec.TransactionID = txn.ID
+				save()
+				return txn, nil
+			}
+		}
+
+		rec.Attempts++
+		save()
+
+		txn := &Transaction{}
+		p := NewParams(s.auth)
+		p.AddHeader(IdempotencyKeyHeader, o.idempotencyKey)
+		err := s.client.CallContext(ctx, http.MethodPost, path, body, txn, p)
+		if err == nil {
+			rec.TransactionID = txn.ID
+			save()
+			return txn, nil
+		}
+
+		rp := s.client.Retry
+		if rp == nil || attempt >= rp.MaxAttempts || !rp.retryableCallError(err) || ctx.Err() != nil {
+			return txn, err
+		}
+		wait := rp.backoff(attempt, nil)
+		s.client.logEntry(LogLevelInfo, "transaction submission failed, retrying", Fields{"error": err, "wait": wait, "attempt": attempt})
+		if err := sleepContext(ctx, wait); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// mayResubmit reports whether a submission may be attempted again, by a
+// retry or by resuming it from the idempotency store.
+func (s *TransactionService) mayResubmit() bool {
+	rp := s.client.Retry
+	return s.client.IdempotencyStore != nil || rp != nil && rp.MaxAttempts > 1
+}
+
+// transactionIDs returns the IDs of the wallet's transactions.
+func (s *TransactionService) transactionIDs(ctx context.Context, walletID string) ([]string, error) {
+	ids := []string{}
+	it := s.Iter(ctx, walletID, nil)
+	for it.Next() {
+		ids = append(ids, it.Value().ID)
+	}
+	if err := it.Err(); err != nil {
+		return nil, fmt.Errorf("Could not retrieve list of transactions: %w", err)
+	}
+	return ids, nil
+}
+
+// findTransaction returns the first transaction of the wallet accepted by
+// match which is not one of prior and has not failed, or nil if there is none.
+func (s *TransactionService) findTransaction(ctx context.Context, walletID string, prior []string, match func(*Transaction) bool) (*Transaction, error) {
+	skip := make(map[string]bool, len(prior))
+	for _, id := range prior {
+		skip[id] = true
+	}
+	it := s.Iter(ctx, walletID, nil)
+	for it.Next() {
+		txn := it.Value()
+		if !skip[txn.ID] && !strings.EqualFold(txn.Status, "FAILED") && match(txn) {
+			return txn, nil
+		}
+	}
+	return nil, it.Err()
 }
@@ -2,6 +2,7 @@ package upvest
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"io"
 	"io/ioutil"
@@ -9,6 +10,8 @@ import (
 	"net/http"
 	"net/url"
 	"os"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/pkg/errors"
@@ -53,6 +56,32 @@ type Client struct {
 
 	LoggingEnabled bool
 	Log            Logger
+	// LogLevel limits what is logged when logging is enabled.
+	LogLevel LogLevel
+	// RedactKeys lists the fields and headers whose values are replaced in
+	// logs. DefaultRedactKeys is used if it is nil.
+	RedactKeys []string
+
+	// Retry is the policy for retrying failed requests. Set it to nil to
+	// disable retries.
+	Retry *RetryPolicy
+
+	// IdempotencyStore keeps track of transaction submissions, so that a
+	// transaction resubmitted under the same idempotency key is not created
+	// twice, even across restarts. Without it, submissions are only
+	// deduplicated within a single call.
+	IdempotencyStore IdempotencyStore
+
+	// TokenStore persists the OAuth tokens of clientele APIs created
+	// afterwards. Tokens are only cached in memory if it is nil.
+	TokenStore TokenStore
+
+	// SkipAddressValidation disables checking the recipients of transactions
+	// against the protocol of their wallet before submitting them.
+	SkipAddressValidation bool
+
+	// walletProtocols caches the protocol of each wallet by ID
+	walletProtocols sync.Map
 }
 
 // Logger interface for custom loggers
@@ -87,17 +116,13 @@ func NewClient(baseURL string, httpClient *http.Client) *Client {
 		baseURL:        u,
 		LoggingEnabled: false,
 		Log:            log.New(os.Stderr, "", log.LstdFlags),
+		LogLevel:       LogLevelDebug,
+		Retry:          DefaultRetryPolicy(),
 	}
 
 	return c
 }
 
-func (c *Client) log(format string, a ...interface{}) {
-	if c.LoggingEnabled {
-		c.Log.Printf(format, a...)
-	}
-}
-
 // SetUA sets the useragent to the provided value
 func (c *Client) SetUA(userAgent string) {
 	c.useragent = userAgent
@@ -106,26 +131,82 @@ func (c *Client) SetUA(userAgent string) {
 // Call actually does the HTTP request to Upvest API
 // TODO: refactor additional params into Param struct
 func (c *Client) Call(method, path string, body, v interface{}, p *Params) error {
-	req, err := c.NewRequest(method, path, body, p)
-	if err != nil {
-		return err
-	}
-	start := time.Now()
+	return c.CallContext(context.Background(), method, path, body, v, p)
+}
 
-	resp, err := c.client.Do(req)
-	if err != nil {
-		return err
+// CallContext is like Call but carries a context. The context is attached to
+// the outgoing request and passed on to the auth provider, so cancelling it
+// aborts both the request and any authentication round trip it requires.
+// Failed attempts are retried according to the client's retry policy; each
+// attempt is built and authenticated afresh.
+func (c *Client) CallContext(ctx context.Context, method, path string, body, v interface{}, p *Params) error {
+	// readers can only be consumed once, keep their content for retries
+	var raw []byte
+	if r, ok := body.(io.Reader); ok {
+		b, err := ioutil.ReadAll(r)
+		if err != nil {
+			return errors.Wrap(err, "could not read request body")
+		}
+		raw = b
 	}
 
-	c.log("Completed in %v\n", time.Since(start))
+	reauthenticated := false
+	for attempt := 1; ; attempt++ {
+		if raw != nil {
+			body = bytes.NewBuffer(raw)
+		}
+		req, err := c.NewRequestContext(ctx, method, path, body, p)
+		if err != nil {
+			return err
+		}
+		start := time.Now()
+
+		resp, err := c.client.Do(req)
+		if inv, ok := p.AuthProvider.(tokenInvalidator); ok && err == nil &&
+			resp.StatusCode == http.StatusUnauthorized && !reauthenticated {
+			// the token may have been revoked before it expired; retry once
+			// with a new one, which does not count as an attempt
+			c.logEntry(LogLevelInfo, "token rejected, reauthenticating", Fields{"status": resp.StatusCode})
+			io.Copy(ioutil.Discard, resp.Body)
+			resp.Body.Close()
+			inv.invalidateToken(c, strings.TrimPrefix(req.Header.Get("Authorization"), "Bearer "))
+			reauthenticated = true
+			attempt--
+			continue
+		}
+		if !c.Retry.shouldRetry(method, attempt, resp, err) || ctx.Err() != nil {
+			if err != nil {
+				return err
+			}
+			c.logEntry(LogLevelInfo, "completed", Fields{"status": resp.StatusCode, "duration": time.Since(start)})
+
+			defer resp.Body.Close()
+			return c.decodeResponse(resp, v)
+		}
 
-	defer resp.Body.Close()
-	return c.decodeResponse(resp, v)
+		wait := c.Retry.backoff(attempt, resp)
+		if err != nil {
+			c.logEntry(LogLevelInfo, "request failed, retrying", Fields{"error": err, "wait": wait, "attempt": attempt})
+		} else {
+			c.logEntry(LogLevelInfo, "request failed, retrying", Fields{"status": resp.StatusCode, "wait": wait, "attempt": attempt})
+			// drain the body so that the connection can be reused
+			io.Copy(ioutil.Discard, resp.Body)
+			resp.Body.Close()
+		}
+		if err := sleepContext(ctx, wait); err != nil {
+			return err
+		}
+	}
 }
 
 // NewRequest is used by Call to generate an http.Request. It handles encoding
 // parameters and attaching the appropriate headers.
 func (c *Client) NewRequest(method, path string, body interface{}, params *Params) (*http.Request, error) {
+	return c.NewRequestContext(context.Background(), method, path, body, params)
+}
+
+// NewRequestContext is like NewRequest but returns a request bound to ctx.
+func (c *Client) NewRequestContext(ctx context.Context, method, path string, body interface{}, params *Params) (*http.Request, error) {
 	u, err := joinURLs(c.baseURL.String(), APIVersion, path)
 	if err != nil {
 		return nil, errors.Wrap(err, "invalid request path")
@@ -147,13 +228,11 @@ func (c *Client) NewRequest(method, path string, body interface{}, params *Param
 	}
 
 	req, err := http.NewRequest(method, u.String(), payload)
-	c.log("Requesting %v %v%v\n", req.Method, req.URL.Host, req.URL.Path)
-	c.log("POST request data %v\n", payload)
-
 	if err != nil {
-		c.log("Cannot create Upvest request: %v\n", err)
+		c.logEntry(LogLevelError, "cannot create Upvest request", Fields{"error": err})
 		return nil, errors.Wrap(err, "could not create HTTP request object")
 	}
+	req = req.WithContext(ctx)
 
 	// set user agent
 	if c.useragent != "" {
@@ -171,10 +250,15 @@ func (c *Client) NewRequest(method, path string, body interface{}, params *Param
 
 	// Get the headers from the auth provider
 	if params.AuthProvider != nil {
-		authHeaders, err := params.AuthProvider.GetHeaders(method, path, body, c)
+		var authHeaders Headers
+		if cp, ok := params.AuthProvider.(ContextAuthProvider); ok {
+			authHeaders, err = cp.GetHeadersContext(ctx, method, path, body, c)
+		} else {
+			authHeaders, err = params.AuthProvider.GetHeaders(method, path, body, c)
+		}
 		if err != nil {
-			log.Println(err)
-			return nil, errors.Wrap(err, "")
+			c.logEntry(LogLevelError, "authentication failed", Fields{"error": err})
+			return nil, err
 		}
 		// Execute request with authenticated headers
 		for k, v := range authHeaders {
@@ -182,6 +266,14 @@ func (c *Client) NewRequest(method, path string, body interface{}, params *Param
 		}
 	}
 
+	c.logEntry(LogLevelInfo, "request", Fields{"method": req.Method, "url": req.URL.Host + req.URL.Path})
+	if c.LoggingEnabled && c.LogLevel >= LogLevelDebug {
+		c.logEntry(LogLevelDebug, "request data", Fields{
+			"headers": c.redactHeaders(req.Header),
+			"body":    c.redactBody(body),
+		})
+	}
+
 	return req, nil
 }
 
@@ -190,7 +282,12 @@ func (c *Client) NewRequest(method, path string, body interface{}, params *Param
 func (c *Client) decodeResponse(httpResp *http.Response, v interface{}) error {
 	if httpResp.StatusCode >= http.StatusBadRequest {
 		err := NewError(httpResp)
-		c.log("Upvest error: %+v", err)
+		c.logEntry(LogLevelError, "error response", Fields{
+			"status":     err.StatusCode,
+			"message":    err.Message,
+			"request_id": err.RequestID,
+			"url":        err.URL,
+		})
 		return err
 	}
 
@@ -199,9 +296,24 @@ func (c *Client) decodeResponse(httpResp *http.Response, v interface{}) error {
 	if err != nil {
 		return err
 	}
-	json.Unmarshal(respBody, &resp)
-
-	c.log("Upvest response: %v\n", resp)
+	// numbers are kept as json.Number, so that amounts beyond the precision
+	// of float64 survive decoding; mapstruct turns them into float64 where
+	// they end up in untyped values
+	dec := json.NewDecoder(bytes.NewReader(respBody))
+	dec.UseNumber()
+	dec.Decode(&resp)
+
+	if c.LoggingEnabled && c.LogLevel >= LogLevelDebug {
+		c.logEntry(LogLevelDebug, "response data", Fields{
+			"status": httpResp.StatusCode,
+			"body":   c.redactBody(resp),
+		})
+	}
 
+	if page, ok := v.(*listPage); ok {
+		// list items are decoded by their iterator, from the exact numbers
+		page.fill(resp)
+		return nil
+	}
 	return mapstruct(resp, v)
 }
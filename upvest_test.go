@@ -1,9 +1,13 @@
 package upvest
 
 import (
+	"context"
 	"fmt"
 	"log"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"testing"
 
 	"github.com/google/uuid"
 )
@@ -26,7 +30,7 @@ var (
 		ID: "8fc19cd0-8f50-4626-becb-c9e284d2315b",
 		Balances: []Balance{
 			Balance{
-				Amount:   0,
+				Amount:   AmountFromMinor(0, 12),
 				AssetID:  "cfc59efb-3b21-5340-ae96-8cadb4ce31a8",
 				Name:     "Example coin",
 				Symbol:   "COIN",
@@ -77,3 +81,25 @@ func initTestClients() {
 	clientSecret := os.Getenv("OAUTH2_CLIENT_SECRET")
 	clienteleTestClient = c.NewClientele(clientID, clientSecret, staticUser.Username, staticUserPW)
 }
+
+// Tests that a cancelled context aborts the request before it reaches the server
+func TestCallContextCancelled(t *testing.T) {
+	hits := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+		w.Write([]byte(`{}`))
+	}))
+	defer ts.Close()
+
+	c := NewClient(ts.URL, nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err := c.CallContext(ctx, http.MethodGet, "/assets/", nil, &Response{}, &Params{})
+	if err == nil {
+		t.Errorf("Expected error for cancelled context, got nil")
+	}
+	if hits != 0 {
+		t.Errorf("Expected no request to reach the server, got %d", hits)
+	}
+}
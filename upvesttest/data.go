@@ -0,0 +1,229 @@
+package upvesttest
+
+import (
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type block struct {
+	Number       int64
+	Hash         string
+	ParentHash   string
+	Timestamp    int64
+	Transactions []string
+}
+
+// chain is the mined history of one protocol and network
+type chain struct {
+	blocks  []*block
+	mined   map[string]int64 // transaction hash to block number
+	txIndex map[string]int
+}
+
+// chain returns the chain of protocol, creating it if needed. The caller
+// must hold the lock.
+func (s *Server) chain(protocol string) *chain {
+	c, ok := s.chains[protocol]
+	if !ok {
+		genesis := &block{Hash: "0x" + randomHex(32), ParentHash: "0x" + strings.Repeat("0", 64), Timestamp: time.Now().Unix()}
+		c = &chain{blocks: []*block{genesis}, mined: make(map[string]int64), txIndex: make(map[string]int)}
+		s.chains[protocol] = c
+	}
+	return c
+}
+
+// Mine appends n blocks to the chain of a protocol and network, such as
+// "ethereum" and "ropsten". The first block includes all pending
+// transactions of wallets on that chain which have not been replaced and
+// marks them confirmed.
+func (s *Server) Mine(protocol, network string, n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	name := protocol + "_" + network
+	c := s.chain(name)
+	for i := 0; i < n; i++ {
+		parent := c.blocks[len(c.blocks)-1]
+		b := &block{
+			Number:     parent.Number + 1,
+			Hash:       "0x" + randomHex(32),
+			ParentHash: parent.Hash,
+			Timestamp:  time.Now().Unix(),
+		}
+		if i == 0 {
+			for _, id := range s.txnOrder {
+				txn := s.transactions[id]
+				if txn.protocol != name || txn.Status != StatusPending || txn.replaced {
+					continue
+				}
+				txn.Status = StatusConfirmed
+				c.mined[txn.TxHash] = b.Number
+				c.txIndex[txn.TxHash] = len(b.Transactions)
+				b.Transactions = append(b.Transactions, txn.TxHash)
+			}
+		}
+		c.blocks = append(c.blocks, b)
+	}
+}
+
+func (s *Server) handleData(w http.ResponseWriter, r *request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(r.segments) < 4 || r.Method != http.MethodGet {
+		writeError(w, http.StatusNotFound, "Not found.")
+		return
+	}
+	name := r.segments[1] + "_" + r.segments[2]
+	c := s.chain(name)
+	args := r.segments[4:]
+
+	switch {
+	case r.segments[3] == "status" && len(args) == 0:
+		latest := c.blocks[len(c.blocks)-1].Number
+		writeResult(w, map[string]string{
+			"lowest":  "0",
+			"highest": strconv.FormatInt(latest, 10),
+			"latest":  strconv.FormatInt(latest, 10),
+		})
+	case r.segments[3] == "block" && len(args) == 1:
+		n, err := strconv.ParseInt(args[0], 10, 64)
+		if err != nil || n < 0 || n >= int64(len(c.blocks)) {
+			writeError(w, http.StatusNotFound, "Block not found.")
+			return
+		}
+		b := c.blocks[n]
+		writeResult(w, map[string]interface{}{
+			"number":       strconv.FormatInt(b.Number, 10),
+			"hash":         b.Hash,
+			"parentHash":   b.ParentHash,
+			"timestamp":    strconv.FormatInt(b.Timestamp, 10),
+			"transactions": append([]string{}, b.Transactions...),
+			"uncles":       []string{},
+		})
+	case r.segments[3] == "transaction" && len(args) == 1:
+		for _, id := range s.txnOrder {
+			if txn := s.transactions[id]; txn.protocol == name && strings.EqualFold(txn.TxHash, args[0]) {
+				writeResult(w, s.hdTransaction(c, txn))
+				return
+			}
+		}
+		writeError(w, http.StatusNotFound, "Transaction not found.")
+	case r.segments[3] == "transactions" && len(args) == 1:
+		s.hdTransactions(w, r, c, name, args[0])
+	case r.segments[3] == "balance" && (len(args) == 1 || len(args) == 2):
+		s.hdBalance(w, name, args)
+	default:
+		writeError(w, http.StatusNotFound, "Not found.")
+	}
+}
+
+// hdTransaction formats a transaction like the historical data API.
+func (s *Server) hdTransaction(c *chain, txn *transaction) map[string]interface{} {
+	result := map[string]interface{}{
+		"hash":          txn.TxHash,
+		"from":          txn.Sender,
+		"to":            txn.Recipient,
+		"value":         txn.Quantity,
+		"gasPrice":      txn.Fee,
+		"input":         txn.Input,
+		"nonce":         strconv.FormatInt(txn.nonce, 10),
+		"confirmations": 0,
+	}
+	if n, ok := c.mined[txn.TxHash]; ok {
+		result["blockNumber"] = strconv.FormatInt(n, 10)
+		result["blockHash"] = c.blocks[n].Hash
+		result["transactionIndex"] = strconv.Itoa(c.txIndex[txn.TxHash])
+		result["confirmations"] = c.blocks[len(c.blocks)-1].Number - n + 1
+	}
+	return result
+}
+
+// hdTransactions lists the mined transactions sent or received by address,
+// paginated by the limit and cursor query parameters.
+func (s *Server) hdTransactions(w http.ResponseWriter, r *request, c *chain, name, address string) {
+	q := r.URL.Query()
+	limit, err := strconv.Atoi(q.Get("limit"))
+	if err != nil || limit <= 0 {
+		limit = 100
+	}
+	start, _ := strconv.Atoi(q.Get("cursor"))
+	confirmations, _ := strconv.ParseInt(q.Get("confirmations"), 10, 64)
+	latest := c.blocks[len(c.blocks)-1].Number
+
+	var matches []interface{}
+	for _, id := range s.txnOrder {
+		txn := s.transactions[id]
+		n, mined := c.mined[txn.TxHash]
+		if txn.protocol != name || !mined || latest-n+1 < confirmations {
+			continue
+		}
+		if strings.EqualFold(txn.Sender, address) || strings.EqualFold(txn.Recipient, address) {
+			matches = append(matches, s.hdTransaction(c, txn))
+		}
+	}
+	if start < 0 || start > len(matches) {
+		start = len(matches)
+	}
+	end := start + limit
+	next := ""
+	if end < len(matches) {
+		next = strconv.Itoa(end)
+	} else {
+		end = len(matches)
+	}
+	writeResult(w, map[string]interface{}{
+		"result":      append([]interface{}{}, matches[start:end]...),
+		"next_cursor": next,
+	})
+}
+
+// hdBalance writes the balance of the native asset, or of the asset of a
+// contract, held by the wallet with an address.
+func (s *Server) hdBalance(w http.ResponseWriter, name string, args []string) {
+	var wl *wallet
+	for _, id := range s.walletOrder {
+		if other := s.wallets[id]; other.Protocol == name && strings.EqualFold(other.Address, args[0]) {
+			wl = other
+		}
+	}
+	var a *asset
+	for _, other := range s.assets {
+		contract, _ := other.MetaData["contract"].(string)
+		if other.Protocol != name {
+			continue
+		}
+		if len(args) == 1 && contract == "" || len(args) == 2 && strings.EqualFold(contract, args[1]) {
+			a = other
+		}
+	}
+	if a == nil {
+		writeError(w, http.StatusNotFound, "Asset not found.")
+		return
+	}
+
+	var amount int64
+	if wl != nil {
+		amount = wl.balance(a.ID).Amount
+	}
+	result := map[string]interface{}{
+		"id":      fmt.Sprintf("%s-%s", strings.ToLower(args[0]), a.ID),
+		"address": args[0],
+		"balance": strconv.FormatInt(amount, 10),
+	}
+	if len(args) == 2 {
+		result["contract"] = args[1]
+	}
+	writeResult(w, result)
+}
+
+func writeResult(w http.ResponseWriter, v interface{}) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{"result": v})
+}
+
+func hexBytes(s string) ([]byte, error) {
+	return hex.DecodeString(strings.TrimPrefix(s, "0x"))
+}
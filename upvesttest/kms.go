@@ -0,0 +1,438 @@
+package upvesttest
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/decred/dcrd/dcrec/secp256k1/v3"
+	"github.com/decred/dcrd/dcrec/secp256k1/v3/ecdsa"
+	"github.com/google/uuid"
+	"github.com/upvestco/upvest-go"
+)
+
+// Transaction statuses used by the fake
+const (
+	StatusPending   = "PENDING"
+	StatusConfirmed = "CONFIRMED"
+	StatusFailed    = "FAILED"
+)
+
+type balance struct {
+	Amount   int64  `json:"amount"`
+	AssetID  string `json:"asset_id"`
+	Name     string `json:"name"`
+	Symbol   string `json:"symbol"`
+	Exponent int64  `json:"exponent"`
+}
+
+type wallet struct {
+	ID       string     `json:"id"`
+	Path     string     `json:"path"`
+	Balances []*balance `json:"balances"`
+	Protocol string     `json:"protocol"`
+	Address  string     `json:"address"`
+	Status   string     `json:"status"`
+	Index    int64      `json:"index"`
+	owner    string
+	nonce    int64
+	key      *secp256k1.PrivateKey // if the protocol uses one
+}
+
+// newWallet creates a wallet of owner for the protocol of a. The caller must
+// hold the lock.
+func (s *Server) newWallet(owner string, a *asset, index int64) *wallet {
+	wl := &wallet{
+		ID:       uuid.New().String(),
+		Path:     fmt.Sprintf("m/1/%d/%d", len(s.walletOrder), index),
+		Protocol: a.Protocol,
+		Address:  newAddress(a.Protocol),
+		Status:   "ACTIVE",
+		Index:    index,
+		owner:    owner,
+	}
+	if !strings.HasPrefix(a.Protocol, "arweave") {
+		wl.key, wl.Address = newKey()
+	}
+	for _, other := range s.assets {
+		if other.Protocol == a.Protocol {
+			wl.Balances = append(wl.Balances, &balance{
+				AssetID:  other.ID,
+				Name:     other.Name,
+				Symbol:   other.Symbol,
+				Exponent: other.Exponent,
+			})
+		}
+	}
+	s.wallets[wl.ID] = wl
+	s.walletOrder = append(s.walletOrder, wl.ID)
+	return wl
+}
+
+// newAddress returns a random address in the format of protocol.
+func newAddress(protocol string) string {
+	if strings.HasPrefix(protocol, "arweave") {
+		b, _ := hexBytes(randomHex(32))
+		return base64.RawURLEncoding.EncodeToString(b)
+	}
+	return "0x" + randomHex(20)
+}
+
+// newKey returns a random secp256k1 private key and its Ethereum address.
+func newKey() (*secp256k1.PrivateKey, string) {
+	key, err := secp256k1.GeneratePrivateKey()
+	if err != nil {
+		panic(err)
+	}
+	return key, upvest.EthereumAddress(key.PubKey().ToECDSA())
+}
+
+// signHash signs hash with key, returning the signature and its recovery id.
+func signHash(key *secp256k1.PrivateKey, hash []byte) (r, s *big.Int, v uint) {
+	// compact form: 27 + recovery id, followed by r and s
+	sig := ecdsa.SignCompact(key, hash, false)
+	return new(big.Int).SetBytes(sig[1:33]), new(big.Int).SetBytes(sig[33:]), uint(sig[0]-27) & 1
+}
+
+// balance returns the balance of assetID in wl, or nil.
+func (wl *wallet) balance(assetID string) *balance {
+	for _, b := range wl.Balances {
+		if b.AssetID == assetID {
+			return b
+		}
+	}
+	return nil
+}
+
+// Fund adds amount of an asset, in its smallest unit, to the balance of a
+// wallet. It panics if the wallet or asset does not exist.
+func (s *Server) Fund(walletID, assetID string, amount int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	wl, ok := s.wallets[walletID]
+	if !ok {
+		panic("upvesttest: unknown wallet " + walletID)
+	}
+	b := wl.balance(assetID)
+	if b == nil {
+		panic("upvesttest: wallet " + walletID + " cannot hold asset " + assetID)
+	}
+	b.Amount += amount
+}
+
+type transaction struct {
+	ID        string `json:"id"`
+	TxHash    string `json:"txhash"`
+	WalletID  string `json:"wallet_id"`
+	AssetID   string `json:"asset_id"`
+	AssetName string `json:"asset_name"`
+	Exponent  int64  `json:"exponent"`
+	Sender    string `json:"sender"`
+	Recipient string `json:"recipient"`
+	Quantity  string `json:"quantity"`
+	Fee       string `json:"fee"`
+	Status    string `json:"status"`
+	Input     string `json:"-"`
+	protocol  string
+	nonce     int64
+	replaced  bool
+}
+
+// SetTransactionStatus sets the status of the transaction with id. It reports
+// whether the transaction exists.
+func (s *Server) SetTransactionStatus(id, status string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	txn, ok := s.transactions[id]
+	if ok {
+		txn.Status = status
+	}
+	return ok
+}
+
+// ReplaceTransaction replaces the pending transaction with id by another one
+// with the same sender and nonce but a higher fee, as a wallet speeding up a
+// transaction would. The original transaction is never mined. It returns the
+// hash of the replacement and reports whether a pending transaction with id
+// exists.
+func (s *Server) ReplaceTransaction(id string) (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	txn, ok := s.transactions[id]
+	if !ok || txn.Status != StatusPending || txn.replaced {
+		return "", false
+	}
+	replacement := *txn
+	replacement.ID = uuid.New().String()
+	replacement.TxHash = "0x" + randomHex(32)
+	if fee, ok := new(big.Int).SetString(txn.Fee, 10); ok {
+		replacement.Fee = fee.Mul(fee, big.NewInt(2)).String()
+	}
+	txn.replaced = true
+	s.transactions[replacement.ID] = &replacement
+	s.txnOrder = append(s.txnOrder, replacement.ID)
+	return replacement.TxHash, true
+}
+
+func (s *Server) handleKMS(w http.ResponseWriter, r *request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(r.segments) < 2 || r.segments[1] != "wallets" {
+		writeError(w, http.StatusNotFound, "Not found.")
+		return
+	}
+	if len(r.segments) == 2 {
+		switch r.Method {
+		case http.MethodGet:
+			var items []interface{}
+			for _, id := range s.walletOrder {
+				if wl := s.wallets[id]; wl.owner == r.username {
+					items = append(items, wl)
+				}
+			}
+			s.paginate(w, r, items)
+		case http.MethodPost:
+			s.createWallet(w, r)
+		default:
+			writeError(w, http.StatusMethodNotAllowed, "Method not allowed.")
+		}
+		return
+	}
+
+	wl, ok := s.wallets[r.segments[2]]
+	if !ok || wl.owner != r.username {
+		writeError(w, http.StatusNotFound, "Not found.")
+		return
+	}
+	switch {
+	case len(r.segments) == 3 && r.Method == http.MethodGet:
+		writeJSON(w, http.StatusOK, wl)
+	case len(r.segments) == 4 && r.segments[3] == "sign" && r.Method == http.MethodPost:
+		s.sign(w, r, wl)
+	case r.segments[3] == "transactions":
+		s.handleTransactions(w, r, wl)
+	default:
+		writeError(w, http.StatusNotFound, "Not found.")
+	}
+}
+
+func (s *Server) createWallet(w http.ResponseWriter, r *request) {
+	var params struct {
+		Password string      `json:"password"`
+		AssetID  string      `json:"asset_id"`
+		Index    json.Number `json:"index"`
+	}
+	if err := r.decode(&params); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON: %v", err)
+		return
+	}
+	if params.Password != s.users[r.username].password {
+		writeError(w, http.StatusForbidden, "Incorrect password.")
+		return
+	}
+	a := s.asset(params.AssetID)
+	if a == nil {
+		writeJSON(w, http.StatusBadRequest, map[string][]string{"asset_id": {"Unknown asset."}})
+		return
+	}
+	index, _ := params.Index.Int64()
+	for _, id := range s.walletOrder {
+		if other := s.wallets[id]; other.owner == r.username && other.Protocol == a.Protocol && other.Index == index {
+			writeError(w, http.StatusConflict, "A wallet for this protocol and index already exists.")
+			return
+		}
+	}
+	writeJSON(w, http.StatusCreated, s.newWallet(r.username, a, index))
+}
+
+// sign answers a signing request with a signature of the right shape.
+// The signature components are random and do not verify.
+func (s *Server) sign(w http.ResponseWriter, r *request, wl *wallet) {
+	var params struct {
+		Password     string `json:"password"`
+		ToSign       string `json:"to_sign"`
+		InputFormat  string `json:"input_format"`
+		OutputFormat string `json:"output_format"`
+	}
+	if err := r.decode(&params); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON: %v", err)
+		return
+	}
+	if params.Password != s.users[r.username].password {
+		writeError(w, http.StatusForbidden, "Incorrect password.")
+		return
+	}
+	if params.ToSign == "" {
+		writeJSON(w, http.StatusBadRequest, map[string][]string{"to_sign": {"This field is required."}})
+		return
+	}
+	var hash []byte
+	var err error
+	switch params.InputFormat {
+	case "", "hex":
+		hash, err = hexBytes(params.ToSign)
+	case "base64":
+		hash, err = base64.StdEncoding.DecodeString(params.ToSign)
+	default:
+		err = fmt.Errorf("unknown input format %q", params.InputFormat)
+	}
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string][]string{"to_sign": {err.Error()}})
+		return
+	}
+	if wl.key == nil {
+		writeError(w, http.StatusBadRequest, "Signing is not supported for protocol %s.", wl.Protocol)
+		return
+	}
+	format := params.OutputFormat
+	if format == "" {
+		format = "hex"
+	}
+	num := func(n *big.Int) string {
+		if format == "decimal" {
+			return n.String()
+		}
+		return fmt.Sprintf("%064x", n)
+	}
+	pub := wl.key.PubKey()
+	x, y := pub.X(), pub.Y()
+	sigR, sigS, v := signHash(wl.key, hash)
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"big_number_format": format,
+		"algorithm":         "ECDSA",
+		"curve":             "secp256k1",
+		"public_key":        map[string]string{"x": num(x), "y": num(y)},
+		"r":                 num(sigR),
+		"s":                 num(sigS),
+		"recover":           strconv.Itoa(int(v)),
+	})
+}
+
+func (s *Server) handleTransactions(w http.ResponseWriter, r *request, wl *wallet) {
+	if len(r.segments) == 4 {
+		switch r.Method {
+		case http.MethodGet:
+			var items []interface{}
+			for _, id := range s.txnOrder {
+				if txn := s.transactions[id]; txn.WalletID == wl.ID {
+					items = append(items, txn)
+				}
+			}
+			s.paginate(w, r, items)
+		case http.MethodPost:
+			s.createTransaction(w, r, wl, "")
+		default:
+			writeError(w, http.StatusMethodNotAllowed, "Method not allowed.")
+		}
+		return
+	}
+
+	if len(r.segments) == 5 && r.Method == http.MethodPost &&
+		(r.segments[4] == "complex" || r.segments[4] == "raw") {
+		s.createTransaction(w, r, wl, r.segments[4])
+		return
+	}
+	txn, ok := s.transactions[r.segments[4]]
+	if !ok || txn.WalletID != wl.ID || len(r.segments) > 5 || r.Method != http.MethodGet {
+		writeError(w, http.StatusNotFound, "Not found.")
+		return
+	}
+	writeJSON(w, http.StatusOK, txn)
+}
+
+// quantity converts a decimal or 0x prefixed hex value of a complex or raw
+// transaction to a decimal string.
+func quantity(v interface{}) string {
+	s := fmt.Sprint(v)
+	if strings.HasPrefix(s, "0x") {
+		if n, ok := new(big.Int).SetString(s[2:], 16); ok {
+			return n.String()
+		}
+	}
+	return s
+}
+
+// createTransaction creates a simple, complex or raw transaction. Requests
+// repeating the Idempotency-Key header of an earlier request are answered
+// with the transaction created by it.
+func (s *Server) createTransaction(w http.ResponseWriter, r *request, wl *wallet, kind string) {
+	key := r.Header.Get("Idempotency-Key")
+	if key != "" {
+		if id, ok := s.idempotency[wl.ID+"/"+key]; ok {
+			writeJSON(w, http.StatusCreated, s.transactions[id])
+			return
+		}
+	}
+
+	var params struct {
+		Password  string                 `json:"password"`
+		AssetID   string                 `json:"asset_id"`
+		Quantity  json.Number            `json:"quantity"`
+		Fee       json.Number            `json:"fee"`
+		Recipient string                 `json:"recipient"`
+		Tx        map[string]interface{} `json:"tx"`
+		RawTx     map[string]interface{} `json:"raw_tx"`
+	}
+	if err := r.decode(&params); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON: %v", err)
+		return
+	}
+	if params.Password != s.users[r.username].password {
+		writeError(w, http.StatusForbidden, "Incorrect password.")
+		return
+	}
+
+	txn := &transaction{
+		ID:       uuid.New().String(),
+		TxHash:   "0x" + randomHex(32),
+		WalletID: wl.ID,
+		Sender:   wl.Address,
+		Status:   StatusPending,
+		protocol: wl.Protocol,
+	}
+	switch kind {
+	case "":
+		a := s.asset(params.AssetID)
+		if a == nil || a.Protocol != wl.Protocol {
+			writeJSON(w, http.StatusBadRequest, map[string][]string{"asset_id": {"Unknown asset for this wallet."}})
+			return
+		}
+		if params.Recipient == "" || params.Quantity == "" {
+			writeJSON(w, http.StatusBadRequest, map[string][]string{"recipient": {"This field is required."}})
+			return
+		}
+		txn.AssetID, txn.AssetName, txn.Exponent = a.ID, a.Name, a.Exponent
+		txn.Recipient = params.Recipient
+		txn.Quantity = params.Quantity.String()
+		txn.Fee = params.Fee.String()
+	case "complex":
+		if params.Tx == nil {
+			writeJSON(w, http.StatusBadRequest, map[string][]string{"tx": {"This field is required."}})
+			return
+		}
+		txn.Recipient = fmt.Sprint(params.Tx["to"])
+		txn.Quantity = quantity(params.Tx["value"])
+		txn.Input, _ = params.Tx["data"].(string)
+	case "raw":
+		if params.RawTx == nil {
+			writeJSON(w, http.StatusBadRequest, map[string][]string{"raw_tx": {"This field is required."}})
+			return
+		}
+		txn.Recipient = fmt.Sprint(params.RawTx["to"])
+		txn.Quantity = quantity(params.RawTx["value"])
+	}
+
+	txn.nonce = wl.nonce
+	wl.nonce++
+	s.transactions[txn.ID] = txn
+	s.txnOrder = append(s.txnOrder, txn.ID)
+	if key != "" {
+		s.idempotency[wl.ID+"/"+key] = txn.ID
+	}
+	writeJSON(w, http.StatusCreated, txn)
+}
@@ -0,0 +1,85 @@
+package upvesttest
+
+import (
+	"net/http"
+	"time"
+)
+
+// token is an issued OAuth2 access token
+type token struct {
+	username string
+	expiry   time.Time
+}
+
+// oauthError is the error body of the OAuth2 token endpoint
+type oauthError struct {
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+// handleToken implements the password and refresh_token grants of the
+// OAuth2 token endpoint.
+func (s *Server) handleToken(w http.ResponseWriter, r *request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "Method not allowed.")
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		writeJSON(w, http.StatusBadRequest, oauthError{"invalid_request", err.Error()})
+		return
+	}
+	form := r.PostForm
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tokenRequests++
+
+	if form.Get("client_id") != s.ClientID || form.Get("client_secret") != s.ClientSecret {
+		writeJSON(w, http.StatusUnauthorized, oauthError{"invalid_client", "Invalid client credentials."})
+		return
+	}
+
+	var username string
+	switch form.Get("grant_type") {
+	case "password":
+		u, ok := s.users[form.Get("username")]
+		if !ok || u.password != form.Get("password") {
+			writeJSON(w, http.StatusBadRequest, oauthError{"invalid_grant", "Invalid credentials given."})
+			return
+		}
+		username = u.Username
+	case "refresh_token":
+		name, ok := s.refreshTokens[form.Get("refresh_token")]
+		if !ok {
+			writeJSON(w, http.StatusBadRequest, oauthError{"invalid_grant", "Invalid refresh token."})
+			return
+		}
+		// refresh tokens are single use
+		delete(s.refreshTokens, form.Get("refresh_token"))
+		username = name
+	default:
+		writeJSON(w, http.StatusBadRequest, oauthError{"unsupported_grant_type", "Unsupported grant type."})
+		return
+	}
+
+	access, refresh := randomHex(16), randomHex(16)
+	s.tokens[access] = &token{username: username, expiry: time.Now().Add(s.TokenLifetime)}
+	s.refreshTokens[refresh] = username
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"access_token":  access,
+		"expires_in":    int(s.TokenLifetime / time.Second),
+		"token_type":    "Bearer",
+		"scope":         "read write echo transaction",
+		"refresh_token": refresh,
+	})
+}
+
+// ExpireTokens invalidates all access tokens issued so far, as if their
+// lifetime had passed. Refresh tokens remain valid.
+func (s *Server) ExpireTokens() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, tok := range s.tokens {
+		tok.expiry = time.Time{}
+	}
+}
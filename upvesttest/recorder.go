@@ -0,0 +1,313 @@
+package upvesttest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+)
+
+// Mode selects whether a Recorder records or replays interactions
+type Mode int
+
+const (
+	// ModeReplay serves responses from the fixture file without network access.
+	ModeReplay Mode = iota
+	// ModeRecord forwards requests and writes the interactions to the fixture file.
+	ModeRecord
+)
+
+// Scrubbed replaces secrets in recorded interactions
+const Scrubbed = "[SCRUBBED]"
+
+// DefaultScrubHeaders are the headers removed from recorded requests. Their
+// values are either secret or differ on every request, so they are never
+// used for matching.
+var DefaultScrubHeaders = []string{
+	"Authorization",
+	"X-UP-API-Key",
+	"X-UP-API-Passphrase",
+	"X-UP-API-Signature",
+	"X-UP-API-Timestamp",
+	"Cookie",
+	"Set-Cookie",
+}
+
+// DefaultScrubKeys are the JSON and form fields whose values are scrubbed from
+// recorded request and response bodies.
+var DefaultScrubKeys = []string{
+	"password",
+	"old_password",
+	"new_password",
+	"client_secret",
+	"access_token",
+	"refresh_token",
+	"recoverykit",
+	"hmac_secret_key",
+}
+
+// Interaction is a recorded request and its response
+type Interaction struct {
+	Request  RecordedRequest  `json:"request"`
+	Response RecordedResponse `json:"response"`
+}
+
+// RecordedRequest is the scrubbed part of a request kept in a fixture
+type RecordedRequest struct {
+	Method string      `json:"method"`
+	Path   string      `json:"path"`
+	Header http.Header `json:"header,omitempty"`
+	Body   string      `json:"body,omitempty"`
+}
+
+// RecordedResponse is the scrubbed part of a response kept in a fixture
+type RecordedResponse struct {
+	StatusCode int         `json:"status_code"`
+	Header     http.Header `json:"header,omitempty"`
+	Body       string      `json:"body,omitempty"`
+}
+
+// Recorder is an http.RoundTripper which records interactions with the
+// Upvest API to a fixture file and replays them later. Requests are matched
+// by method, path and body, so signature and timestamp headers may differ
+// between recording and replay. Each recorded interaction is replayed once,
+// in the order it was recorded.
+//
+// Usage:
+//
+//	rec, err := upvesttest.NewRecorder("testdata/users.json", upvesttest.ModeReplay)
+//	c := upvest.NewClient(baseURL, rec.Client())
+//	...
+//	err = rec.Stop()
+type Recorder struct {
+	// Transport performs the requests in record mode. If nil,
+	// http.DefaultTransport is used.
+	Transport http.RoundTripper
+
+	// ScrubHeaders and ScrubKeys list what is scrubbed before writing the
+	// fixture. They default to DefaultScrubHeaders and DefaultScrubKeys.
+	ScrubHeaders []string
+	ScrubKeys    []string
+
+	mode         Mode
+	fixture      string
+	mu           sync.Mutex
+	interactions []*Interaction
+	used         []bool
+}
+
+// NewRecorder returns a recorder for the fixture file. In replay mode the
+// fixture is loaded and must exist.
+func NewRecorder(fixture string, mode Mode) (*Recorder, error) {
+	r := &Recorder{
+		ScrubHeaders: DefaultScrubHeaders,
+		ScrubKeys:    DefaultScrubKeys,
+		mode:         mode,
+		fixture:      fixture,
+	}
+	if mode == ModeReplay {
+		data, err := ioutil.ReadFile(fixture)
+		if err != nil {
+			return nil, fmt.Errorf("could not load fixture: %w", err)
+		}
+		if err := json.Unmarshal(data, &r.interactions); err != nil {
+			return nil, fmt.Errorf("could not decode fixture %s: %w", fixture, err)
+		}
+		r.used = make([]bool, len(r.interactions))
+	}
+	return r, nil
+}
+
+// Mode returns the mode of the recorder
+func (r *Recorder) Mode() Mode {
+	return r.mode
+}
+
+// Client returns an HTTP client which uses the recorder as its transport
+func (r *Recorder) Client() *http.Client {
+	return &http.Client{Transport: r}
+}
+
+// Stop writes the recorded interactions to the fixture file in record mode.
+// In replay mode it returns an error if any interaction was not replayed.
+func (r *Recorder) Stop() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.mode == ModeReplay {
+		for i, used := range r.used {
+			if !used {
+				req := r.interactions[i].Request
+				return fmt.Errorf("recorded interaction %s %s was not replayed", req.Method, req.Path)
+			}
+		}
+		return nil
+	}
+
+	data, err := json.MarshalIndent(r.interactions, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(r.fixture, append(data, '\n'), os.FileMode(0644))
+}
+
+// RoundTrip implements http.RoundTripper
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		if body, err = ioutil.ReadAll(req.Body); err != nil {
+			return nil, err
+		}
+		req.Body.Close()
+	}
+	recorded := RecordedRequest{
+		Method: req.Method,
+		Path:   req.URL.RequestURI(),
+		Header: r.scrubHeader(req.Header),
+		Body:   r.scrubBody(req.Header.Get("Content-Type"), body),
+	}
+
+	if r.mode == ModeReplay {
+		return r.replay(req, recorded)
+	}
+
+	out := req.Clone(req.Context())
+	out.Body = ioutil.NopCloser(bytes.NewReader(body))
+	transport := r.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	resp, err := transport.RoundTrip(out)
+	if err != nil {
+		return nil, err
+	}
+	respBody, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = ioutil.NopCloser(bytes.NewReader(respBody))
+
+	r.mu.Lock()
+	r.interactions = append(r.interactions, &Interaction{
+		Request: recorded,
+		Response: RecordedResponse{
+			StatusCode: resp.StatusCode,
+			Header:     r.scrubHeader(resp.Header),
+			Body:       r.scrubBody(resp.Header.Get("Content-Type"), respBody),
+		},
+	})
+	r.mu.Unlock()
+	return resp, nil
+}
+
+// replay answers req with the first unused interaction matching it.
+func (r *Recorder) replay(req *http.Request, recorded RecordedRequest) (*http.Response, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i, in := range r.interactions {
+		if r.used[i] || in.Request.Method != recorded.Method ||
+			in.Request.Path != recorded.Path || in.Request.Body != recorded.Body {
+			continue
+		}
+		r.used[i] = true
+		header := http.Header{}
+		for k, v := range in.Response.Header {
+			header[k] = append([]string{}, v...)
+		}
+		return &http.Response{
+			Status:        fmt.Sprintf("%d %s", in.Response.StatusCode, http.StatusText(in.Response.StatusCode)),
+			StatusCode:    in.Response.StatusCode,
+			Proto:         "HTTP/1.1",
+			ProtoMajor:    1,
+			ProtoMinor:    1,
+			Header:        header,
+			Body:          ioutil.NopCloser(strings.NewReader(in.Response.Body)),
+			ContentLength: int64(len(in.Response.Body)),
+			Request:       req,
+		}, nil
+	}
+	return nil, fmt.Errorf("no recorded interaction matches %s %s", recorded.Method, recorded.Path)
+}
+
+// scrubHeader returns a copy of h without the scrubbed headers.
+func (r *Recorder) scrubHeader(h http.Header) http.Header {
+	out := http.Header{}
+	for k, v := range h {
+		out[k] = append([]string{}, v...)
+	}
+	for _, k := range r.ScrubHeaders {
+		out.Del(k)
+	}
+	if len(out) == 0 {
+		return nil
+	}
+	return out
+}
+
+// scrubBody scrubs the secrets from a JSON or form encoded body. JSON bodies
+// are re-encoded with sorted keys, so that matching does not depend on the
+// order of fields.
+func (r *Recorder) scrubBody(contentType string, body []byte) string {
+	if len(body) == 0 {
+		return ""
+	}
+	if strings.HasPrefix(contentType, "application/x-www-form-urlencoded") {
+		form, err := url.ParseQuery(string(body))
+		if err != nil {
+			return string(body)
+		}
+		for _, k := range r.ScrubKeys {
+			if _, ok := form[k]; ok {
+				form.Set(k, Scrubbed)
+			}
+		}
+		return form.Encode()
+	}
+
+	var v interface{}
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	if err := dec.Decode(&v); err != nil {
+		return string(body)
+	}
+	out, err := json.Marshal(r.scrubValue(v))
+	if err != nil {
+		return string(body)
+	}
+	return string(out)
+}
+
+func (r *Recorder) scrubValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, val := range v {
+			if r.isSecret(k) {
+				v[k] = Scrubbed
+			} else {
+				v[k] = r.scrubValue(val)
+			}
+		}
+	case []interface{}:
+		for i, val := range v {
+			v[i] = r.scrubValue(val)
+		}
+	}
+	return v
+}
+
+func (r *Recorder) isSecret(key string) bool {
+	for _, k := range r.ScrubKeys {
+		if strings.EqualFold(k, key) {
+			return true
+		}
+	}
+	return false
+}
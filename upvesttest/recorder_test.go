@@ -0,0 +1,81 @@
+package upvesttest_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/upvestco/upvest-go"
+	"github.com/upvestco/upvest-go/upvesttest"
+)
+
+// exercise makes the same calls against the API behind c, in record or replay.
+func exercise(t *testing.T, c *upvest.Client, fake *upvesttest.Server) string {
+	tenant := c.NewTenant(fake.APIKey, fake.APISecret, fake.APIPassphrase)
+	if _, err := tenant.User.Create("dave", "secret", nil); err != nil {
+		t.Fatalf("Create User returned error: %v", err)
+	}
+	clientele := c.NewClientele(fake.ClientID, fake.ClientSecret, "dave", "secret")
+	wallet, err := clientele.Wallet.Create(&upvest.WalletParams{Password: "secret", AssetID: upvesttest.EthereumAssetID})
+	if err != nil {
+		t.Fatalf("Create Wallet returned error: %v", err)
+	}
+	return wallet.Address
+}
+
+func TestRecordReplay(t *testing.T) {
+	dir, err := ioutil.TempDir("", "upvesttest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	fixture := filepath.Join(dir, "fixture.json")
+
+	fake := upvesttest.NewServer()
+	rec, err := upvesttest.NewRecorder(fixture, upvesttest.ModeRecord)
+	if err != nil {
+		t.Fatal(err)
+	}
+	recorded := exercise(t, upvest.NewClient(fake.URL, rec.Client()), fake)
+	if err := rec.Stop(); err != nil {
+		t.Fatalf("Stop returned error: %v", err)
+	}
+	fake.Close()
+
+	data, err := ioutil.ReadFile(fixture)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, secret := range []string{fake.APISecret, fake.ClientSecret, `"secret"`, "X-Up-Api-Signature"} {
+		if strings.Contains(string(data), secret) {
+			t.Errorf("Fixture contains secret %s", secret)
+		}
+	}
+
+	// the fake is closed, so every response must come from the fixture;
+	// signatures differ as the timestamps do
+	rec, err = upvesttest.NewRecorder(fixture, upvesttest.ModeReplay)
+	if err != nil {
+		t.Fatal(err)
+	}
+	replayed := exercise(t, upvest.NewClient(fake.URL, rec.Client()), fake)
+	if replayed != recorded {
+		t.Errorf("Expected replayed address %s, got %s", recorded, replayed)
+	}
+	if err := rec.Stop(); err != nil {
+		t.Errorf("Stop returned error: %v", err)
+	}
+
+	rec, _ = upvesttest.NewRecorder(fixture, upvesttest.ModeReplay)
+	c := upvest.NewClient(fake.URL, rec.Client())
+	c.Retry = nil
+	tenant := c.NewTenant(fake.APIKey, fake.APISecret, fake.APIPassphrase)
+	if _, err := tenant.User.Create("eve", "secret", nil); err == nil {
+		t.Error("Expected an unrecorded request to fail")
+	}
+	if err := rec.Stop(); err == nil {
+		t.Error("Expected Stop to report interactions which were not replayed")
+	}
+}
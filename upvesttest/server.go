@@ -0,0 +1,315 @@
+/*
+Package upvesttest provides an in-memory fake of the Upvest API for tests.
+
+The fake implements the tenancy, clientele, KMS, webhook and historical data
+endpoints closely enough to exercise the upvest client without network access
+or playground credentials. Tenant requests must be signed with the server's
+API key and secret, and clientele requests must carry a bearer token obtained
+from the OAuth2 token endpoint with the password of a user created through the
+tenancy API.
+
+Usage:
+
+	fake := upvesttest.NewServer()
+	defer fake.Close()
+
+	c := upvest.NewClient(fake.URL, nil)
+	tenant := c.NewTenant(fake.APIKey, fake.APISecret, fake.APIPassphrase)
+	user, err := tenant.User.Create("alice", "secret", nil)
+
+	clientele := c.NewClientele(fake.ClientID, fake.ClientSecret, "alice", "secret")
+	wallet, err := clientele.Wallet.Create(&upvest.WalletParams{
+		Password: "secret",
+		AssetID:  upvesttest.EthereumAssetID,
+	})
+*/
+package upvesttest
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha512"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// apiVersion is the path prefix of all endpoints.
+const apiVersion = "/1.0"
+
+// DefaultTokenLifetime is the lifetime of issued OAuth2 access tokens.
+const DefaultTokenLifetime = time.Hour
+
+// MaxTimestampSkew is how far the timestamp of a signed tenant request may be
+// from the server's clock before the request is rejected as stale.
+const MaxTimestampSkew = 5 * time.Minute
+
+// Server is a running fake of the Upvest API
+type Server struct {
+	*httptest.Server
+
+	// Credentials accepted by the fake.
+	APIKey        string
+	APISecret     string
+	APIPassphrase string
+	ClientID      string
+	ClientSecret  string
+
+	// TokenLifetime is the lifetime of access tokens issued from now on.
+	TokenLifetime time.Duration
+
+	mu            sync.Mutex
+	users         map[string]*user
+	userOrder     []string
+	assets        []*asset
+	wallets       map[string]*wallet
+	walletOrder   []string
+	transactions  map[string]*transaction
+	txnOrder      []string
+	idempotency   map[string]string
+	tokens        map[string]*token
+	refreshTokens map[string]string
+	webhooks      map[string]*webhook
+	webhookOrder  []string
+	chains        map[string]*chain
+	tokenRequests int
+}
+
+// NewServer starts a fake Upvest API server with random credentials and the
+// default assets. The caller should call Close when finished.
+func NewServer() *Server {
+	s := &Server{
+		APIKey:        randomHex(16),
+		APISecret:     randomHex(32),
+		APIPassphrase: randomHex(8),
+		ClientID:      randomHex(16),
+		ClientSecret:  randomHex(32),
+		TokenLifetime: DefaultTokenLifetime,
+		users:         make(map[string]*user),
+		wallets:       make(map[string]*wallet),
+		transactions:  make(map[string]*transaction),
+		idempotency:   make(map[string]string),
+		tokens:        make(map[string]*token),
+		refreshTokens: make(map[string]string),
+		webhooks:      make(map[string]*webhook),
+		chains:        make(map[string]*chain),
+	}
+	s.assets = defaultAssets()
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	return s
+}
+
+// TokenRequests returns the number of requests made to the OAuth2 token endpoint
+func (s *Server) TokenRequests() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.tokenRequests
+}
+
+// apiError is the error body returned by the fake
+type apiError struct {
+	Error struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+func writeError(w http.ResponseWriter, code int, format string, a ...interface{}) {
+	e := apiError{}
+	e.Error.Code = code
+	e.Error.Message = fmt.Sprintf(format, a...)
+	writeJSON(w, code, e)
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
+
+// request is an authenticated request to the fake.
+type request struct {
+	*http.Request
+	body     []byte
+	segments []string // path below the API version, split at slashes
+	username string   // set for clientele requests
+	tenant   bool     // set for tenant requests
+}
+
+// decode decodes the JSON request body into v.
+func (r *request) decode(v interface{}) error {
+	dec := json.NewDecoder(bytes.NewReader(r.body))
+	dec.UseNumber()
+	return dec.Decode(v)
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, hr *http.Request) {
+	w.Header().Set("X-Request-Id", randomHex(8))
+	if !strings.HasPrefix(hr.URL.Path, apiVersion+"/") {
+		writeError(w, http.StatusNotFound, "Not found.")
+		return
+	}
+	body, err := ioutil.ReadAll(hr.Body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "could not read body")
+		return
+	}
+	hr.Body = ioutil.NopCloser(bytes.NewReader(body))
+	r := &request{
+		Request:  hr,
+		body:     body,
+		segments: strings.Split(strings.Trim(strings.TrimPrefix(hr.URL.Path, apiVersion), "/"), "/"),
+	}
+
+	if r.segments[0] == "clientele" && len(r.segments) == 3 && r.segments[2] == "token" {
+		s.handleToken(w, r)
+		return
+	}
+	if code, err := s.authenticate(r); err != nil {
+		writeError(w, code, "%v", err)
+		return
+	}
+
+	switch r.segments[0] {
+	case "tenancy":
+		if !r.tenant {
+			writeError(w, http.StatusForbidden, "tenancy endpoints require API key authentication")
+			return
+		}
+		if len(r.segments) > 1 && r.segments[1] == "users" {
+			s.handleUsers(w, r)
+		} else {
+			s.handleWebhooks(w, r)
+		}
+	case "assets":
+		s.handleAssets(w, r)
+	case "kms":
+		if r.username == "" {
+			writeError(w, http.StatusForbidden, "KMS endpoints require OAuth2 authentication")
+			return
+		}
+		s.handleKMS(w, r)
+	case "data":
+		if !r.tenant {
+			writeError(w, http.StatusForbidden, "historical data endpoints require API key authentication")
+			return
+		}
+		s.handleData(w, r)
+	default:
+		writeError(w, http.StatusNotFound, "Not found.")
+	}
+}
+
+// authenticate verifies the API key signature or bearer token of a request.
+func (s *Server) authenticate(r *request) (int, error) {
+	if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		tok, ok := s.tokens[strings.TrimPrefix(auth, "Bearer ")]
+		if !ok || time.Now().After(tok.expiry) {
+			return http.StatusUnauthorized, fmt.Errorf("invalid or expired access token")
+		}
+		if _, ok := s.users[tok.username]; !ok {
+			return http.StatusUnauthorized, fmt.Errorf("user no longer exists")
+		}
+		r.username = tok.username
+		return 0, nil
+	}
+
+	if r.Header.Get("X-UP-API-Key") == "" {
+		return http.StatusUnauthorized, fmt.Errorf("authentication credentials were not provided")
+	}
+	if err := s.verifySignature(r.Request, r.body); err != nil {
+		return http.StatusUnauthorized, err
+	}
+	r.tenant = true
+	return 0, nil
+}
+
+// verifySignature checks the API key headers and the HMAC signature of a
+// tenant request, which covers the timestamp, method, path and body.
+func (s *Server) verifySignature(r *http.Request, body []byte) error {
+	if r.Header.Get("X-UP-API-Key") != s.APIKey {
+		return fmt.Errorf("invalid API key")
+	}
+	if r.Header.Get("X-UP-API-Passphrase") != s.APIPassphrase {
+		return fmt.Errorf("invalid API passphrase")
+	}
+
+	timestamp := r.Header.Get("X-UP-API-Timestamp")
+	secs, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid timestamp")
+	}
+	if skew := time.Since(time.Unix(secs, 0)); skew > MaxTimestampSkew || skew < -MaxTimestampSkew {
+		return fmt.Errorf("stale timestamp")
+	}
+
+	signedPath := r.Header.Get("X-UP-API-Signed-Path")
+	if signedPath != strings.TrimPrefix(r.URL.RequestURI(), "/") {
+		return fmt.Errorf("signed path does not match request path")
+	}
+
+	h := hmac.New(sha512.New, []byte(s.APISecret))
+	h.Write([]byte(timestamp + r.Method + signedPath))
+	h.Write(body)
+	expected := hex.EncodeToString(h.Sum(nil))
+	if !hmac.Equal([]byte(expected), []byte(r.Header.Get("X-UP-API-Signature"))) {
+		return fmt.Errorf("invalid signature")
+	}
+	return nil
+}
+
+// paginate writes a page of items selected by the page_size and cursor
+// query parameters, linking to the next page like the Upvest API.
+func (s *Server) paginate(w http.ResponseWriter, r *request, items []interface{}) {
+	q := r.URL.Query()
+	size, err := strconv.Atoi(q.Get("page_size"))
+	if err != nil || size <= 0 || size > 100 {
+		size = 100
+	}
+	start, _ := strconv.Atoi(q.Get("cursor"))
+	if start < 0 || start > len(items) {
+		start = len(items)
+	}
+	end := start + size
+	if end > len(items) {
+		end = len(items)
+	}
+
+	page := map[string]interface{}{
+		"previous": nil,
+		"next":     nil,
+		"results":  append([]interface{}{}, items[start:end]...),
+	}
+	link := func(cursor int) string {
+		v := url.Values{"cursor": {strconv.Itoa(cursor)}, "page_size": {strconv.Itoa(size)}}
+		return s.URL + r.URL.Path + "?" + v.Encode()
+	}
+	if end < len(items) {
+		page["next"] = link(end)
+	}
+	if start > 0 {
+		prev := start - size
+		if prev < 0 {
+			prev = 0
+		}
+		page["previous"] = link(prev)
+	}
+	writeJSON(w, http.StatusOK, page)
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,667 @@
+package upvesttest_test
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httputil"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/upvestco/upvest-go"
+	"github.com/upvestco/upvest-go/upvesttest"
+)
+
+func newTenant() (*upvesttest.Server, *upvest.Client, *upvest.TenancyAPI) {
+	fake := upvesttest.NewServer()
+	c := upvest.NewClient(fake.URL, nil)
+	c.LogLevel = upvest.LogLevelError
+	return fake, c, c.NewTenant(fake.APIKey, fake.APISecret, fake.APIPassphrase)
+}
+
+func TestTenancyUsers(t *testing.T) {
+	fake, _, tenant := newTenant()
+	defer fake.Close()
+
+	user, err := tenant.User.Create("alice", "secret", []string{upvesttest.EthereumAssetID})
+	if err != nil {
+		t.Fatalf("Create User returned error: %v", err)
+	}
+	if user.Username != "alice" || user.RecoveryKit == "" || len(user.WalletIDs) != 1 {
+		t.Errorf("Unexpected user %+v", user)
+	}
+	if _, err := tenant.User.Create("alice", "secret", nil); !errors.Is(err, upvest.ErrConflict) {
+		t.Errorf("Expected ErrConflict for duplicate user, got %v", err)
+	}
+
+	for i := 0; i < 12; i++ {
+		if _, err := tenant.User.Create("user"+strconv.Itoa(i), "secret", nil); err != nil {
+			t.Fatalf("Create User returned error: %v", err)
+		}
+	}
+	users, err := tenant.User.ListN(10)
+	if err != nil {
+		t.Fatalf("List Users returned error: %v", err)
+	}
+	if len(users.Values) != 10 {
+		t.Errorf("Expected 10 users, got %d", len(users.Values))
+	}
+
+	if _, err := tenant.User.ChangePassword("alice", &upvest.ChangePasswordParams{OldPassword: "secret", NewPassword: "new"}); err != nil {
+		t.Errorf("ChangePassword returned error: %v", err)
+	}
+	if err := tenant.User.Delete("alice"); err != nil {
+		t.Errorf("Delete User returned error: %v", err)
+	}
+	if _, err := tenant.User.Get("alice"); !errors.Is(err, upvest.ErrNotFound) {
+		t.Errorf("Expected ErrNotFound for deleted user, got %v", err)
+	}
+}
+
+func TestBadSignature(t *testing.T) {
+	fake, c, _ := newTenant()
+	defer fake.Close()
+	tenant := c.NewTenant(fake.APIKey, "wrong", fake.APIPassphrase)
+	if _, err := tenant.Asset.List(); !errors.Is(err, upvest.ErrUnauthorized) {
+		t.Errorf("Expected ErrUnauthorized, got %v", err)
+	}
+}
+
+func TestClienteleTransactions(t *testing.T) {
+	fake, c, tenant := newTenant()
+	defer fake.Close()
+	if _, err := tenant.User.Create("bob", "secret", nil); err != nil {
+		t.Fatalf("Create User returned error: %v", err)
+	}
+	clientele := c.NewClientele(fake.ClientID, fake.ClientSecret, "bob", "secret")
+
+	wallet, err := clientele.Wallet.Create(&upvest.WalletParams{Password: "secret", AssetID: upvesttest.EthereumAssetID})
+	if err != nil {
+		t.Fatalf("Create Wallet returned error: %v", err)
+	}
+	fake.Fund(wallet.ID, upvesttest.EthereumAssetID, 1000)
+
+	tp := &upvest.TransactionParams{
+		Password:  "secret",
+		AssetID:   upvesttest.EthereumAssetID,
+		Quantity:  upvest.AmountFromMinor(10, 18),
+		Fee:       upvest.AmountFromMinor(1, 0),
+		Recipient: "0xf9b44Ba370CAfc6a7AF77D0BDB0d50106823D91b",
+	}
+	txn, err := clientele.Transaction.Create(wallet.ID, tp, upvest.WithIdempotencyKey("k1"))
+	if err != nil {
+		t.Fatalf("Create Transaction returned error: %v", err)
+	}
+	again, err := clientele.Transaction.Create(wallet.ID, tp, upvest.WithIdempotencyKey("k1"))
+	if err != nil {
+		t.Fatalf("Create Transaction returned error: %v", err)
+	}
+	if again.ID != txn.ID {
+		t.Errorf("Expected idempotent submission to return %s, got %s", txn.ID, again.ID)
+	}
+	if txn.Status != upvesttest.StatusPending {
+		t.Errorf("Expected pending transaction, got %s", txn.Status)
+	}
+
+	fake.Mine("ethereum", "ropsten", 3)
+	got, err := clientele.Transaction.Get(wallet.ID, txn.ID)
+	if err != nil {
+		t.Fatalf("Get Transaction returned error: %v", err)
+	}
+	if got.Status != upvesttest.StatusConfirmed {
+		t.Errorf("Expected confirmed transaction, got %s", got.Status)
+	}
+
+	hd, err := tenant.Historical.GetTxByHash("ethereum", "ropsten", txn.TxHash)
+	if err != nil {
+		t.Fatalf("GetTxByHash returned error: %v", err)
+	}
+	if hd.Confirmations != 3 || hd.BlockNumber != "1" {
+		t.Errorf("Expected 3 confirmations in block 1, got %d in %s", hd.Confirmations, hd.BlockNumber)
+	}
+	txns, err := tenant.Historical.GetTransactions("ethereum", "ropsten", wallet.Address, &upvest.TxFilters{Confirmations: 2})
+	if err != nil {
+		t.Fatalf("GetTransactions returned error: %v", err)
+	}
+	if len(txns.Values) != 1 {
+		t.Errorf("Expected 1 historical transaction, got %d", len(txns.Values))
+	}
+	balance, err := tenant.Historical.GetAssetBalance("ethereum", "ropsten", wallet.Address)
+	if err != nil {
+		t.Fatalf("GetAssetBalance returned error: %v", err)
+	}
+	if balance.Balance.MinorString() != "1000" {
+		t.Errorf("Expected balance 1000, got %s", balance.Balance)
+	}
+}
+
+func TestTokenExpiry(t *testing.T) {
+	fake, c, tenant := newTenant()
+	defer fake.Close()
+	if _, err := tenant.User.Create("carol", "secret", nil); err != nil {
+		t.Fatalf("Create User returned error: %v", err)
+	}
+	clientele := c.NewClientele(fake.ClientID, fake.ClientSecret, "carol", "secret")
+	if _, err := clientele.Wallet.List(); err != nil {
+		t.Fatalf("List Wallets returned error: %v", err)
+	}
+	if _, err := clientele.Wallet.List(); err != nil {
+		t.Fatalf("List Wallets returned error: %v", err)
+	}
+	if n := fake.TokenRequests(); n != 1 {
+		t.Errorf("Expected the token to be reused, got %d token requests", n)
+	}
+
+	// a token revoked before its expiry is replaced on the first 401
+	fake.ExpireTokens()
+	if _, err := clientele.Wallet.List(); err != nil {
+		t.Fatalf("Expected a new token after the old one was rejected, got %v", err)
+	}
+	if n := fake.TokenRequests(); n != 2 {
+		t.Errorf("Expected one more token request, got %d", n)
+	}
+	if _, err := clientele.Wallet.List(); err != nil {
+		t.Errorf("List Wallets returned error: %v", err)
+	}
+	if n := fake.TokenRequests(); n != 2 {
+		t.Errorf("Expected the new token to be reused, got %d token requests", n)
+	}
+}
+
+func TestWebhookVerify(t *testing.T) {
+	fake, _, tenant := newTenant()
+	defer fake.Close()
+	receiver := httptest.NewServer(upvest.NewWebhookReceiver("abc"))
+	defer receiver.Close()
+	silent := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer silent.Close()
+	wrapped := httptest.NewServer(upvest.WebhookVerificationHandler(http.NotFoundHandler()))
+	defer wrapped.Close()
+
+	wh, err := tenant.Webhook.Create(&upvest.WebhookParams{URL: receiver.URL, Name: "test", HMACSecretKey: "abc"})
+	if err != nil {
+		t.Fatalf("Create Webhook returned error: %v", err)
+	}
+	if !tenant.Webhook.Verify(receiver.URL) {
+		t.Error("Expected webhook to verify")
+	}
+	if v := tenant.Webhook.VerifyDetailed(wrapped.URL); !v.Verified || v.StatusCode != http.StatusOK || v.Err != nil {
+		t.Errorf("Expected wrapped handler to verify, got %+v", v)
+	}
+	if tenant.Webhook.Verify("http://127.0.0.1:1/") {
+		t.Error("Expected unreachable webhook not to verify")
+	}
+	v := tenant.Webhook.VerifyDetailed(silent.URL)
+	if v.Verified || v.StatusCode != http.StatusBadRequest || !errors.Is(v.Err, upvest.ErrValidation) ||
+		v.Reason != "webhook URL did not answer the verification challenge" || v.Latency <= 0 {
+		t.Errorf("Unexpected verification of a URL ignoring the challenge %+v", v)
+	}
+	if err := tenant.Webhook.Delete(wh.ID); err != nil {
+		t.Errorf("Delete Webhook returned error: %v", err)
+	}
+}
+
+func TestWebhookUpdate(t *testing.T) {
+	fake, _, tenant := newTenant()
+	defer fake.Close()
+
+	wh, err := tenant.Webhook.Create(&upvest.WebhookParams{URL: "https://example.com/a", Name: "test", HMACSecretKey: "abc"})
+	if err != nil {
+		t.Fatalf("Create Webhook returned error: %v", err)
+	}
+	wh, err = tenant.Webhook.Update(wh.ID, &upvest.WebhookParams{URL: "https://example.com/b", Name: "renamed", HMACSecretKey: "abc"})
+	if err != nil {
+		t.Fatalf("Update Webhook returned error: %v", err)
+	}
+	if wh.URL != "https://example.com/b" || wh.Name != "renamed" {
+		t.Errorf("Unexpected updated webhook %+v", wh)
+	}
+
+	wh, err = tenant.Webhook.Patch(wh.ID, &upvest.WebhookPatchParams{URL: "https://example.com/c"})
+	if err != nil {
+		t.Fatalf("Patch Webhook returned error: %v", err)
+	}
+	if wh.URL != "https://example.com/c" || wh.Name != "renamed" {
+		t.Errorf("Expected Patch to only change the URL, got %+v", wh)
+	}
+
+	if wh, err = tenant.Webhook.Disable(wh.ID); err != nil || wh.Status != upvest.WebhookStatusInactive {
+		t.Errorf("Expected disabled webhook, got %+v, %v", wh, err)
+	}
+	if wh, err = tenant.Webhook.Enable(wh.ID); err != nil || wh.Status != upvest.WebhookStatusActive {
+		t.Errorf("Expected enabled webhook, got %+v, %v", wh, err)
+	}
+}
+
+func TestWebhookRotateSecret(t *testing.T) {
+	fake, _, tenant := newTenant()
+	defer fake.Close()
+
+	wh, err := tenant.Webhook.Create(&upvest.WebhookParams{URL: "https://example.com/a", Name: "test", HMACSecretKey: "abc"})
+	if err != nil {
+		t.Fatalf("Create Webhook returned error: %v", err)
+	}
+	receiver := upvest.NewWebhookReceiver("abc")
+	rotated, err := tenant.Webhook.RotateSecret(wh.ID, receiver, time.Hour)
+	if err != nil {
+		t.Fatalf("RotateSecret returned error: %v", err)
+	}
+	if rotated.HMACSecretKey == "" || rotated.HMACSecretKey == "abc" {
+		t.Errorf("Expected a new secret, got %q", rotated.HMACSecretKey)
+	}
+	if got, _ := tenant.Webhook.Get(wh.ID); got.HMACSecretKey != rotated.HMACSecretKey {
+		t.Errorf("Expected the webhook to be updated with the new secret, got %q", got.HMACSecretKey)
+	}
+	if secrets := receiver.Secrets(); len(secrets) != 2 {
+		t.Errorf("Expected the receiver to accept both secrets during the grace period, got %v", secrets)
+	}
+
+	again, err := tenant.Webhook.RotateSecret(wh.ID, receiver, 0)
+	if err != nil {
+		t.Fatalf("RotateSecret returned error: %v", err)
+	}
+	if secrets := receiver.Secrets(); len(secrets) != 1 || secrets[0] != again.HMACSecretKey {
+		t.Errorf("Expected previous secrets to be retired without a grace period, got %v", secrets)
+	}
+
+	if _, err := tenant.Webhook.RotateSecret("missing", receiver, 0); !errors.Is(err, upvest.ErrNotFound) {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+	if secrets := receiver.Secrets(); len(secrets) != 1 || secrets[0] != again.HMACSecretKey {
+		t.Errorf("Expected a failed rotation to leave the secrets unchanged, got %v", secrets)
+	}
+}
+
+func TestWebhookRotateSecretLostResponse(t *testing.T) {
+	fake := upvesttest.NewServer()
+	defer fake.Close()
+	target, _ := url.Parse(fake.URL)
+	proxy := httputil.NewSingleHostReverseProxy(target)
+	// the change is applied, but the response is lost on the way back
+	proxy.ModifyResponse = func(resp *http.Response) error {
+		if resp.Request.Method == http.MethodPatch {
+			resp.StatusCode = http.StatusBadGateway
+		}
+		return nil
+	}
+	lossy := httptest.NewServer(proxy)
+	defer lossy.Close()
+	c := upvest.NewClient(lossy.URL, nil)
+	c.LogLevel = upvest.LogLevelError
+	tenant := c.NewTenant(fake.APIKey, fake.APISecret, fake.APIPassphrase)
+
+	wh, err := tenant.Webhook.Create(&upvest.WebhookParams{URL: "https://example.com/a", Name: "test", HMACSecretKey: "abc"})
+	if err != nil {
+		t.Fatalf("Create Webhook returned error: %v", err)
+	}
+	receiver := upvest.NewWebhookReceiver("abc")
+	_, err = tenant.Webhook.RotateSecret(wh.ID, receiver, 0)
+	var rerr *upvest.SecretRotationError
+	if !errors.As(err, &rerr) {
+		t.Fatalf("Expected a *SecretRotationError, got %v", err)
+	}
+	got, err := tenant.Webhook.Get(wh.ID)
+	if err != nil {
+		t.Fatalf("Get Webhook returned error: %v", err)
+	}
+	if got.HMACSecretKey != rerr.Secret {
+		t.Errorf("Expected the error to carry the applied secret %q, got %q", got.HMACSecretKey, rerr.Secret)
+	}
+	if secrets := receiver.Secrets(); len(secrets) != 2 {
+		t.Errorf("Expected the receiver to accept both secrets, got %v", secrets)
+	}
+}
+
+func TestWaitForTransaction(t *testing.T) {
+	fake, c, tenant := newTenant()
+	defer fake.Close()
+	if _, err := tenant.User.Create("dave", "secret", nil); err != nil {
+		t.Fatalf("Create User returned error: %v", err)
+	}
+	clientele := c.NewClientele(fake.ClientID, fake.ClientSecret, "dave", "secret")
+	wallet, err := clientele.Wallet.Create(&upvest.WalletParams{Password: "secret", AssetID: upvesttest.EthereumAssetID})
+	if err != nil {
+		t.Fatalf("Create Wallet returned error: %v", err)
+	}
+	fake.Fund(wallet.ID, upvesttest.EthereumAssetID, 1000)
+	submit := func() *upvest.Transaction {
+		txn, err := clientele.Transaction.Create(wallet.ID, &upvest.TransactionParams{
+			Password:  "secret",
+			AssetID:   upvesttest.EthereumAssetID,
+			Quantity:  upvest.AmountFromMinor(10, 18),
+			Fee:       upvest.AmountFromMinor(1, 0),
+			Recipient: "0xf9b44Ba370CAfc6a7AF77D0BDB0d50106823D91b",
+		})
+		if err != nil {
+			t.Fatalf("Create Transaction returned error: %v", err)
+		}
+		return txn
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	opts := &upvest.WaitOptions{Confirmations: 3, Historical: tenant.Historical, PollInterval: 5 * time.Millisecond}
+
+	txn := submit()
+	go func() {
+		for i := 0; i < 3; i++ {
+			time.Sleep(10 * time.Millisecond)
+			fake.Mine("ethereum", "ropsten", 1)
+		}
+	}()
+	outcome, err := clientele.Transaction.WaitForTransaction(ctx, wallet.ID, txn.ID, opts)
+	if err != nil {
+		t.Fatalf("WaitForTransaction returned error: %v", err)
+	}
+	if outcome.State != upvest.TransactionConfirmed || outcome.Confirmations < 3 || outcome.Mined == nil {
+		t.Errorf("Expected confirmed transaction with 3 confirmations, got %+v", outcome)
+	}
+
+	txn = submit()
+	fake.SetTransactionStatus(txn.ID, "FAILED")
+	outcome, err = clientele.Transaction.WaitForTransaction(ctx, wallet.ID, txn.ID, opts)
+	if err != nil || outcome.State != upvest.TransactionFailed {
+		t.Errorf("Expected failed transaction, got %+v, %v", outcome, err)
+	}
+
+	txn = submit()
+	hash, _ := fake.ReplaceTransaction(txn.ID)
+	fake.Mine("ethereum", "ropsten", 1)
+	outcome, err = clientele.Transaction.WaitForTransaction(ctx, wallet.ID, txn.ID, opts)
+	if err != nil || outcome.State != upvest.TransactionReplaced || outcome.ReplacedBy != hash {
+		t.Errorf("Expected transaction replaced by %s, got %+v, %v", hash, outcome, err)
+	}
+
+	txn = submit()
+	dropOpts := *opts
+	dropOpts.DropAfter = 20 * time.Millisecond
+	outcome, err = clientele.Transaction.WaitForTransaction(ctx, wallet.ID, txn.ID, &dropOpts)
+	if err != nil || outcome.State != upvest.TransactionDropped {
+		t.Errorf("Expected dropped transaction, got %+v, %v", outcome, err)
+	}
+
+	if _, err := clientele.Transaction.WaitForTransaction(ctx, wallet.ID, txn.ID, &upvest.WaitOptions{Confirmations: 2}); err == nil {
+		t.Error("Expected an error waiting for 2 confirmations without historical data")
+	}
+}
+
+func TestWaitForTransactionWebhook(t *testing.T) {
+	fake, c, tenant := newTenant()
+	defer fake.Close()
+	if _, err := tenant.User.Create("erin", "secret", nil); err != nil {
+		t.Fatalf("Create User returned error: %v", err)
+	}
+	clientele := c.NewClientele(fake.ClientID, fake.ClientSecret, "erin", "secret")
+	wallet, err := clientele.Wallet.Create(&upvest.WalletParams{Password: "secret", AssetID: upvesttest.EthereumAssetID})
+	if err != nil {
+		t.Fatalf("Create Wallet returned error: %v", err)
+	}
+	fake.Fund(wallet.ID, upvesttest.EthereumAssetID, 1000)
+	txn, err := clientele.Transaction.Create(wallet.ID, &upvest.TransactionParams{
+		Password:  "secret",
+		AssetID:   upvesttest.EthereumAssetID,
+		Quantity:  upvest.AmountFromMinor(10, 18),
+		Fee:       upvest.AmountFromMinor(1, 0),
+		Recipient: "0xf9b44Ba370CAfc6a7AF77D0BDB0d50106823D91b",
+	})
+	if err != nil {
+		t.Fatalf("Create Transaction returned error: %v", err)
+	}
+
+	receiver := upvest.NewWebhookReceiver("whsec")
+	srv := httptest.NewServer(receiver)
+	defer srv.Close()
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		fake.Mine("ethereum", "ropsten", 2)
+		filter := upvest.NewEventFilter(upvest.EventNounTransaction, upvest.EventVerbConfirmed).
+			ForProtocol("ethereum_ropsten").WithMaxConfirmations(2)
+		sim := upvesttest.NewWebhookSimulator(srv.URL, "whsec")
+		sim.Simulate(context.Background(), filter, map[string]interface{}{"id": txn.ID, "txhash": txn.TxHash})
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	// The poll interval is long, so only the webhook events can end the wait in time.
+	outcome, err := clientele.Transaction.WaitForTransaction(ctx, wallet.ID, txn.ID, &upvest.WaitOptions{
+		Confirmations: 2,
+		Receiver:      receiver,
+		PollInterval:  time.Minute,
+	})
+	if err != nil {
+		t.Fatalf("WaitForTransaction returned error: %v", err)
+	}
+	if outcome.State != upvest.TransactionConfirmed || outcome.Confirmations != 2 {
+		t.Errorf("Expected confirmed transaction with 2 confirmations, got %+v", outcome)
+	}
+}
+
+func TestEstimatedFee(t *testing.T) {
+	fake, c, tenant := newTenant()
+	defer fake.Close()
+	if _, err := tenant.User.Create("frank", "secret", nil); err != nil {
+		t.Fatalf("Create User returned error: %v", err)
+	}
+	clientele := c.NewClientele(fake.ClientID, fake.ClientSecret, "frank", "secret")
+	wallet, err := clientele.Wallet.Create(&upvest.WalletParams{Password: "secret", AssetID: upvesttest.EthereumAssetID})
+	if err != nil {
+		t.Fatalf("Create Wallet returned error: %v", err)
+	}
+	fake.Fund(wallet.ID, upvesttest.EthereumAssetID, 1000)
+	tp := &upvest.TransactionParams{
+		Password:  "secret",
+		AssetID:   upvesttest.EthereumAssetID,
+		Quantity:  upvest.AmountFromMinor(10, 18),
+		Recipient: "0xf9b44Ba370CAfc6a7AF77D0BDB0d50106823D91b",
+	}
+
+	estimator := &upvest.HistoricalFeeEstimator{Historical: tenant.Historical}
+	if _, err := estimator.EstimateFee(context.Background(), "ethereum", "ropsten", upvesttest.EthereumAssetID); err == nil {
+		t.Error("Expected an error estimating fees of an empty chain")
+	}
+	for _, fee := range []int64{1, 2, 3, 4} {
+		tp.Fee = upvest.AmountFromMinor(fee, 0)
+		if _, err := clientele.Transaction.Create(wallet.ID, tp); err != nil {
+			t.Fatalf("Create Transaction returned error: %v", err)
+		}
+	}
+	fake.Mine("ethereum", "ropsten", 1)
+
+	estimate, err := estimator.EstimateFee(context.Background(), "ethereum", "ropsten", upvesttest.EthereumAssetID)
+	if err != nil {
+		t.Fatalf("EstimateFee returned error: %v", err)
+	}
+	if estimate.Slow.MinorString() != "21000" || estimate.Standard.MinorString() != "42000" || estimate.Fast.MinorString() != "63000" {
+		t.Errorf("Unexpected estimate %s/%s/%s", estimate.Slow.MinorString(), estimate.Standard.MinorString(), estimate.Fast.MinorString())
+	}
+	if estimate.Fast.Exponent() != 0 {
+		t.Errorf("Expected fees in minor units like Transaction.Fee, got exponent %d", estimate.Fast.Exponent())
+	}
+	// tokens are transferred on the Ethereum chain
+	if tokens, err := estimator.EstimateFee(context.Background(), "erc20", "ropsten", upvesttest.ExampleCoinID); err != nil || tokens.Fast.MinorString() != "63000" {
+		t.Errorf("Unexpected ERC20 estimate %+v, %v", tokens, err)
+	}
+
+	tp.Fee = upvest.Amount{}
+	txn, err := clientele.Transaction.Create(wallet.ID, tp, upvest.WithEstimatedFee(estimator, upvest.FeeFast, upvest.AmountFromMinor(100000, 0)))
+	if err != nil {
+		t.Fatalf("Create Transaction returned error: %v", err)
+	}
+	if txn.Fee.MinorString() != "63000" {
+		t.Errorf("Expected fee 63000, got %s", txn.Fee.MinorString())
+	}
+	if !tp.Fee.IsZero() {
+		t.Errorf("Expected the parameters to be left unchanged, got fee %s", tp.Fee.MinorString())
+	}
+
+	_, err = clientele.Transaction.Create(wallet.ID, tp, upvest.WithEstimatedFee(estimator, upvest.FeeFast, upvest.AmountFromMinor(50000, 0)))
+	if !errors.Is(err, upvest.ErrFeeAboveCeiling) {
+		t.Errorf("Expected ErrFeeAboveCeiling, got %v", err)
+	}
+
+	// recently sampled gas prices are reused
+	tp.Fee = upvest.AmountFromMinor(100, 0)
+	if _, err := clientele.Transaction.Create(wallet.ID, tp); err != nil {
+		t.Fatalf("Create Transaction returned error: %v", err)
+	}
+	fake.Mine("ethereum", "ropsten", 1)
+	if cached, err := estimator.EstimateFee(context.Background(), "ethereum", "ropsten", upvesttest.EthereumAssetID); err != nil || cached.Fast.MinorString() != "63000" {
+		t.Errorf("Expected the cached estimate, got %+v, %v", cached, err)
+	}
+	uncached := &upvest.HistoricalFeeEstimator{Historical: tenant.Historical, CacheTTL: -1}
+	if fresh, err := uncached.EstimateFee(context.Background(), "ethereum", "ropsten", upvesttest.EthereumAssetID); err != nil || fresh.Fast.MinorString() == "63000" {
+		t.Errorf("Expected a fresh estimate, got %+v, %v", fresh, err)
+	}
+
+	tx := upvest.NewEthereumTx(tp.Recipient).WithValue(tp.Quantity)
+	_, err = clientele.Transaction.CreateEthereum(wallet.ID, "secret", tx, false, upvest.WithEstimatedFee(estimator, upvest.FeeFast, upvest.Amount{}))
+	if !errors.Is(err, upvest.ErrFeeEstimationUnsupported) {
+		t.Errorf("Expected ErrFeeEstimationUnsupported, got %v", err)
+	}
+}
+
+func TestCreateValidatesRecipient(t *testing.T) {
+	fake, c, tenant := newTenant()
+	defer fake.Close()
+	if _, err := tenant.User.Create("heidi", "secret", nil); err != nil {
+		t.Fatalf("Create User returned error: %v", err)
+	}
+	clientele := c.NewClientele(fake.ClientID, fake.ClientSecret, "heidi", "secret")
+	wallet, err := clientele.Wallet.Create(&upvest.WalletParams{Password: "secret", AssetID: upvesttest.EthereumAssetID})
+	if err != nil {
+		t.Fatalf("Create Wallet returned error: %v", err)
+	}
+	fake.Fund(wallet.ID, upvesttest.EthereumAssetID, 1000)
+	tp := &upvest.TransactionParams{
+		Password:  "secret",
+		AssetID:   upvesttest.EthereumAssetID,
+		Quantity:  upvest.AmountFromMinor(10, 18),
+		Fee:       upvest.AmountFromMinor(1, 18),
+		Recipient: "1A1zP1eP5QGefi2DMPTfTL5SLmv7DivfNa",
+	}
+
+	_, err = clientele.Transaction.Create(wallet.ID, tp)
+	var addrErr *upvest.AddressError
+	if !errors.As(err, &addrErr) || !errors.Is(err, upvest.ErrValidation) {
+		t.Fatalf("Expected an *AddressError, got %v", err)
+	}
+	if addrErr.Protocol != wallet.Protocol || addrErr.Address != tp.Recipient {
+		t.Errorf("Unexpected error %+v", addrErr)
+	}
+	txns, err := clientele.Transaction.List(wallet.ID)
+	if err != nil {
+		t.Fatalf("List Transactions returned error: %v", err)
+	}
+	if len(txns.Values) != 0 {
+		t.Errorf("Expected no transactions to be submitted, got %d", len(txns.Values))
+	}
+
+	tp.Recipient = "0xf9b44Ba370CAfc6a7AF77D0BDB0d50106823D91b"
+	if _, err := clientele.Transaction.Create(wallet.ID, tp); err != nil {
+		t.Errorf("Create Transaction returned error: %v", err)
+	}
+}
+
+func TestWalletSignVerify(t *testing.T) {
+	fake, c, tenant := newTenant()
+	defer fake.Close()
+	if _, err := tenant.User.Create("grace", "secret", nil); err != nil {
+		t.Fatalf("Create User returned error: %v", err)
+	}
+	clientele := c.NewClientele(fake.ClientID, fake.ClientSecret, "grace", "secret")
+	wallet, err := clientele.Wallet.Create(&upvest.WalletParams{Password: "secret", AssetID: upvesttest.EthereumAssetID})
+	if err != nil {
+		t.Fatalf("Create Wallet returned error: %v", err)
+	}
+
+	hash := upvest.Keccak256([]byte("hello"))
+	for _, format := range []string{"hex", "decimal"} {
+		sig, err := clientele.Wallet.Sign(wallet.ID, &upvest.SignatureParams{
+			Password:     "secret",
+			ToSign:       hex.EncodeToString(hash),
+			OutputFormat: format,
+		})
+		if err != nil {
+			t.Fatalf("Sign returned error: %v", err)
+		}
+		if err := sig.VerifyWallet(hash, wallet); err != nil {
+			t.Errorf("VerifyWallet of %s signature returned error: %v", format, err)
+		}
+	}
+}
+
+func TestSignPersonalMessage(t *testing.T) {
+	fake, c, tenant := newTenant()
+	defer fake.Close()
+	if _, err := tenant.User.Create("heidi", "secret", nil); err != nil {
+		t.Fatalf("Create User returned error: %v", err)
+	}
+	clientele := c.NewClientele(fake.ClientID, fake.ClientSecret, "heidi", "secret")
+	wallet, err := clientele.Wallet.Create(&upvest.WalletParams{Password: "secret", AssetID: upvesttest.EthereumAssetID})
+	if err != nil {
+		t.Fatalf("Create Wallet returned error: %v", err)
+	}
+
+	message := []byte("Sign in to example.com")
+	b, err := clientele.Wallet.SignPersonalMessage(wallet.ID, "secret", message)
+	if err != nil {
+		t.Fatalf("SignPersonalMessage returned error: %v", err)
+	}
+	sig := &upvest.Signature{
+		Curve:   "secp256k1",
+		R:       hex.EncodeToString(b[:32]),
+		S:       hex.EncodeToString(b[32:64]),
+		Recover: strconv.Itoa(int(b[64])),
+	}
+	pub, err := sig.RecoverKey(upvest.PersonalMessageHash(message))
+	if err != nil {
+		t.Fatalf("RecoverKey returned error: %v", err)
+	}
+	if address := upvest.EthereumAddress(pub); address != wallet.Address {
+		t.Errorf("Expected the signature to recover to %s, got %s", wallet.Address, address)
+	}
+
+	td := &upvest.TypedData{
+		Types:       map[string][]upvest.TypedDataField{"Login": {{Name: "nonce", Type: "uint256"}}},
+		PrimaryType: "Login",
+		Domain:      map[string]interface{}{"name": "example.com", "chainId": 3},
+		Message:     map[string]interface{}{"nonce": 42},
+	}
+	if b, err := clientele.Wallet.SignTypedData(wallet.ID, "secret", td); err != nil || len(b) != 65 {
+		t.Errorf("SignTypedData returned %x, %v", b, err)
+	}
+}
+
+func TestCreateEthereum(t *testing.T) {
+	fake, c, tenant := newTenant()
+	defer fake.Close()
+	if _, err := tenant.User.Create("ivan", "secret", nil); err != nil {
+		t.Fatalf("Create User returned error: %v", err)
+	}
+	clientele := c.NewClientele(fake.ClientID, fake.ClientSecret, "ivan", "secret")
+	wallet, err := clientele.Wallet.Create(&upvest.WalletParams{Password: "secret", AssetID: upvesttest.EthereumAssetID})
+	if err != nil {
+		t.Fatalf("Create Wallet returned error: %v", err)
+	}
+
+	tx := upvest.NewEthereumTx("0xf9b44Ba370CAfc6a7AF77D0BDB0d50106823D91b").
+		WithValue(upvest.AmountFromMinor(1000, 18)).
+		WithGasPrice(upvest.AmountFromMinor(1000000000, 18))
+	txn, err := clientele.Transaction.CreateEthereum(wallet.ID, "secret", tx, false)
+	if err != nil {
+		t.Fatalf("CreateEthereum returned error: %v", err)
+	}
+	if txn.Quantity.MinorString() != "1000" {
+		t.Errorf("Expected quantity 1000, got %s", txn.Quantity.MinorString())
+	}
+	if _, err := clientele.Transaction.CreateEthereumRaw(wallet.ID, "secret", tx, false, upvest.InputFormatDecimal); err != nil {
+		t.Errorf("CreateEthereumRaw returned error: %v", err)
+	}
+
+	if _, err := clientele.Transaction.CreateEthereum(wallet.ID, "secret", tx.WithGas(100), false); err == nil {
+		t.Error("Expected a malformed transaction to be rejected")
+	}
+}
@@ -0,0 +1,214 @@
+package upvesttest
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/upvestco/upvest-go"
+)
+
+// defaultVerbs are the verbs of simulated events whose filter matches any verb.
+var defaultVerbs = map[string]string{
+	upvest.EventNounWallet:      upvest.EventVerbCreated,
+	upvest.EventNounTransaction: upvest.EventVerbConfirmed,
+	upvest.EventNounUser:        upvest.EventVerbCreated,
+	upvest.EventNounEcho:        upvest.EventVerbPost,
+	upvest.EventNounBlock:       upvest.EventVerbConfirmed,
+}
+
+// Events returns the events Upvest would deliver to a webhook with filter:
+// one event, or one per confirmation of a transaction or block if the filter
+// has max confirmations. The event data is a sample for the event noun, with
+// the fields of data set on top of it.
+func Events(filter *upvest.EventFilter, data map[string]interface{}) ([]*upvest.Event, error) {
+	if err := filter.Validate(); err != nil {
+		return nil, err
+	}
+	if filter.EventNoun == upvest.EventWildcard {
+		return nil, fmt.Errorf("simulated events need a noun")
+	}
+	verb := filter.EventVerb
+	if verb == upvest.EventWildcard {
+		verb = defaultVerbs[filter.EventNoun]
+	}
+	protocol := filter.ProtocolName
+	address := filter.WalletAddress
+	if address == "" && (filter.EventNoun == upvest.EventNounWallet || filter.EventNoun == upvest.EventNounTransaction) {
+		address = newAddress(protocol)
+	}
+	sample := sampleData(filter.EventNoun, protocol, address)
+	for k, v := range data {
+		sample[k] = v
+	}
+
+	confirmations := []int{0}
+	if filter.MaxConfirmations > 0 {
+		confirmations = confirmations[:0]
+		for n := 1; n <= filter.MaxConfirmations; n++ {
+			confirmations = append(confirmations, n)
+		}
+	}
+	var events []*upvest.Event
+	for _, n := range confirmations {
+		if n > 0 {
+			sample["confirmations"] = n
+		}
+		raw, err := json.Marshal(sample)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, &upvest.Event{
+			ID:            uuid.New().String(),
+			Created:       time.Now().UTC().Truncate(time.Second),
+			EventNoun:     filter.EventNoun,
+			EventVerb:     verb,
+			ProtocolName:  protocol,
+			WalletAddress: address,
+			Data:          raw,
+		})
+	}
+	return events, nil
+}
+
+// sampleData returns plausible data of an event about noun.
+func sampleData(noun, protocol, address string) map[string]interface{} {
+	switch noun {
+	case upvest.EventNounWallet:
+		return map[string]interface{}{
+			"id":       uuid.New().String(),
+			"protocol": protocol,
+			"address":  address,
+			"status":   "ACTIVE",
+		}
+	case upvest.EventNounTransaction:
+		return map[string]interface{}{
+			"id":         uuid.New().String(),
+			"txhash":     "0x" + randomHex(32),
+			"wallet_id":  uuid.New().String(),
+			"asset_id":   EthereumAssetID,
+			"asset_name": "Ethereum (Ropsten)",
+			"exponent":   "18",
+			"sender":     address,
+			"recipient":  newAddress(protocol),
+			"quantity":   "10000000000000000",
+			"fee":        "41180000000000",
+			"status":     StatusConfirmed,
+		}
+	case upvest.EventNounBlock:
+		return map[string]interface{}{
+			"number": 1,
+			"hash":   "0x" + randomHex(32),
+		}
+	case upvest.EventNounUser:
+		return map[string]interface{}{"username": "user-" + randomHex(4)}
+	case upvest.EventNounEcho:
+		return map[string]interface{}{"echo": "hello"}
+	}
+	return map[string]interface{}{}
+}
+
+// WebhookSimulator sends signed webhook deliveries to a URL, as Upvest would.
+//
+// Usage:
+//
+//	sim := upvesttest.NewWebhookSimulator("http://localhost:8080/webhook", secret)
+//	filter := upvest.NewEventFilter(upvest.EventNounTransaction, upvest.EventVerbConfirmed).
+//		ForProtocol("ethereum_ropsten")
+//	err := sim.Simulate(ctx, filter, nil)
+type WebhookSimulator struct {
+	// Client sends the deliveries. If nil, http.DefaultClient is used.
+	Client *http.Client
+
+	url    string
+	secret string
+}
+
+// NewWebhookSimulator returns a simulator delivering to url, signing with secret
+func NewWebhookSimulator(url, secret string) *WebhookSimulator {
+	return &WebhookSimulator{url: url, secret: secret}
+}
+
+// Simulate delivers the events of filter, see Events. It stops at the first
+// delivery which is not acknowledged with a 2xx response.
+func (s *WebhookSimulator) Simulate(ctx context.Context, filter *upvest.EventFilter, data map[string]interface{}) error {
+	events, err := Events(filter, data)
+	if err != nil {
+		return err
+	}
+	for _, e := range events {
+		if err := s.Send(ctx, e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Send delivers an event. It returns an error if the delivery is not
+// acknowledged with a 2xx response.
+func (s *WebhookSimulator) Send(ctx context.Context, e *upvest.Event) error {
+	body, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	return s.deliver(ctx, body)
+}
+
+// Replay delivers captured events read from r, one JSON encoded event per
+// line, and returns the number of events delivered. Deliveries are signed
+// again, so that their timestamps are current.
+func (s *WebhookSimulator) Replay(ctx context.Context, r io.Reader) (int, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), upvest.MaxWebhookBodySize)
+	n := 0
+	for line := 1; scanner.Scan(); line++ {
+		body := bytes.TrimSpace(scanner.Bytes())
+		if len(body) == 0 {
+			continue
+		}
+		if !json.Valid(body) {
+			return n, fmt.Errorf("line %d is not a JSON event", line)
+		}
+		if err := s.deliver(ctx, body); err != nil {
+			return n, fmt.Errorf("line %d: %w", line, err)
+		}
+		n++
+	}
+	return n, scanner.Err()
+}
+
+// deliver posts a signed delivery of body.
+func (s *WebhookSimulator) deliver(ctx context.Context, body []byte) error {
+	req, err := http.NewRequest(http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	timestamp := time.Now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(upvest.WebhookTimestampHeader, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(upvest.WebhookSignatureHeader, upvest.SignWebhook(s.secret, timestamp, body))
+
+	client := s.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("delivery answered with %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,76 @@
+package upvesttest_test
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/upvestco/upvest-go"
+	"github.com/upvestco/upvest-go/upvesttest"
+)
+
+func TestEvents(t *testing.T) {
+	filter := upvest.NewEventFilter(upvest.EventNounTransaction, upvest.EventVerbConfirmed).
+		ForProtocol("ethereum_ropsten").
+		ForWallet("0xabc").
+		WithMaxConfirmations(3)
+	events, err := upvesttest.Events(filter, map[string]interface{}{"quantity": "42"})
+	if err != nil {
+		t.Fatalf("Events returned error: %v", err)
+	}
+	if len(events) != 3 {
+		t.Fatalf("Expected an event per confirmation, got %d", len(events))
+	}
+	for i, e := range events {
+		typed, err := upvest.DecodeEvent(e)
+		if err != nil {
+			t.Fatalf("DecodeEvent returned error: %v", err)
+		}
+		te := typed.(*upvest.TransactionEvent)
+		if te.Confirmations != i+1 || te.Transaction.Quantity.MinorString() != "42" || te.WalletAddress != "0xabc" || te.ProtocolName != "ethereum_ropsten" {
+			t.Errorf("Unexpected transaction event %+v", te)
+		}
+	}
+
+	if _, err := upvesttest.Events(upvest.NewEventFilter(upvest.EventNounTransaction, upvest.EventVerbConfirmed), nil); err == nil {
+		t.Error("Expected Events to reject an invalid filter")
+	}
+}
+
+func TestWebhookSimulator(t *testing.T) {
+	receiver := upvest.NewWebhookReceiver("secret")
+	var mu sync.Mutex
+	var got []string
+	receiver.Handle(func(ctx context.Context, e *upvest.Event) error {
+		mu.Lock()
+		defer mu.Unlock()
+		got = append(got, e.Type())
+		return nil
+	})
+	ts := httptest.NewServer(receiver)
+	defer ts.Close()
+
+	sim := upvesttest.NewWebhookSimulator(ts.URL, "secret")
+	if err := sim.Simulate(context.Background(), upvest.NewEventFilter(upvest.EventNounEcho, upvest.EventWildcard), nil); err != nil {
+		t.Fatalf("Simulate returned error: %v", err)
+	}
+
+	captured := `{"id":"e1","event_noun":"wallet","event_verb":"created","data":{}}
+
+{"id":"e2","event_noun":"user","event_verb":"created","data":{}}
+`
+	n, err := sim.Replay(context.Background(), strings.NewReader(captured))
+	if err != nil || n != 2 {
+		t.Fatalf("Expected 2 replayed events, got %d, %v", n, err)
+	}
+	if strings.Join(got, ",") != "echo.post,wallet.created,user.created" {
+		t.Errorf("Unexpected received events %v", got)
+	}
+
+	wrong := upvesttest.NewWebhookSimulator(ts.URL, "wrong")
+	if err := wrong.Simulate(context.Background(), upvest.NewEventFilter(upvest.EventNounEcho, upvest.EventVerbPost), nil); err == nil {
+		t.Error("Expected delivery with the wrong secret to fail")
+	}
+}
@@ -0,0 +1,318 @@
+package upvesttest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Asset IDs of the assets every fake server offers
+const (
+	EthereumAssetID = "deaaa6bf-d944-57fa-8ec4-2dd45d1f5d3f"
+	ExampleCoinID   = "cfc59efb-3b21-5340-ae96-8cadb4ce31a8"
+	ArweaveAssetID  = "51bfa4b5-6499-5fe2-998b-5fb3c9403ac7"
+)
+
+type asset struct {
+	ID       string                 `json:"id"`
+	Name     string                 `json:"name"`
+	Symbol   string                 `json:"symbol"`
+	Exponent int64                  `json:"exponent"`
+	Protocol string                 `json:"protocol"`
+	MetaData map[string]interface{} `json:"metadata"`
+}
+
+func defaultAssets() []*asset {
+	return []*asset{
+		{ID: ArweaveAssetID, Name: "Arweave (internal testnet)", Symbol: "AR", Exponent: 12, Protocol: "arweave_testnet"},
+		{ID: EthereumAssetID, Name: "Ethereum (Ropsten)", Symbol: "ETH", Exponent: 18, Protocol: "ethereum_ropsten"},
+		{ID: ExampleCoinID, Name: "Example coin", Symbol: "COIN", Exponent: 12, Protocol: "ethereum_ropsten",
+			MetaData: map[string]interface{}{"contract": "0x1d7cf6ad190772cc6177beea2e3ae24cc89b2a10"}},
+	}
+}
+
+// asset returns the asset with id. The caller must hold the lock.
+func (s *Server) asset(id string) *asset {
+	for _, a := range s.assets {
+		if a.ID == id {
+			return a
+		}
+	}
+	return nil
+}
+
+type user struct {
+	Username    string         `json:"username"`
+	RecoveryKit string         `json:"recoverykit,omitempty"`
+	WalletIDs   map[int]string `json:"wallet_ids,omitempty"`
+	password    string
+}
+
+func (s *Server) handleUsers(w http.ResponseWriter, r *request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(r.segments) == 2 {
+		switch r.Method {
+		case http.MethodGet:
+			items := make([]interface{}, 0, len(s.userOrder))
+			for _, name := range s.userOrder {
+				items = append(items, &user{Username: name})
+			}
+			s.paginate(w, r, items)
+		case http.MethodPost:
+			s.createUser(w, r)
+		default:
+			writeError(w, http.StatusMethodNotAllowed, "Method not allowed.")
+		}
+		return
+	}
+
+	u, ok := s.users[r.segments[2]]
+	if !ok {
+		writeError(w, http.StatusNotFound, "Not found.")
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, &user{Username: u.Username})
+	case http.MethodPatch:
+		var params struct {
+			OldPassword string `json:"old_password"`
+			NewPassword string `json:"new_password"`
+		}
+		if err := r.decode(&params); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid JSON: %v", err)
+			return
+		}
+		if params.OldPassword != u.password {
+			writeError(w, http.StatusBadRequest, "old_password is wrong")
+			return
+		}
+		if params.NewPassword == "" {
+			writeError(w, http.StatusBadRequest, "new_password is required")
+			return
+		}
+		u.password = params.NewPassword
+		writeJSON(w, http.StatusOK, &user{Username: u.Username})
+	case http.MethodDelete:
+		delete(s.users, u.Username)
+		s.userOrder = remove(s.userOrder, u.Username)
+		for id, wl := range s.wallets {
+			if wl.owner == u.Username {
+				delete(s.wallets, id)
+				s.walletOrder = remove(s.walletOrder, id)
+			}
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "Method not allowed.")
+	}
+}
+
+func (s *Server) createUser(w http.ResponseWriter, r *request) {
+	var params struct {
+		Username string   `json:"username"`
+		Password string   `json:"password"`
+		AssetIDs []string `json:"asset_ids"`
+	}
+	if err := r.decode(&params); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON: %v", err)
+		return
+	}
+	if params.Username == "" || params.Password == "" {
+		writeJSON(w, http.StatusBadRequest, map[string][]string{"username": {"This field is required."}})
+		return
+	}
+	if _, ok := s.users[params.Username]; ok {
+		writeJSON(w, http.StatusConflict, map[string][]string{"username": {"A user with that username already exists."}})
+		return
+	}
+	for _, id := range params.AssetIDs {
+		if s.asset(id) == nil {
+			writeError(w, http.StatusBadRequest, "unknown asset %s", id)
+			return
+		}
+	}
+
+	u := &user{Username: params.Username, password: params.Password, RecoveryKit: randomHex(32)}
+	s.users[u.Username] = u
+	s.userOrder = append(s.userOrder, u.Username)
+	for i, id := range params.AssetIDs {
+		wl := s.newWallet(u.Username, s.asset(id), 0)
+		if u.WalletIDs == nil {
+			u.WalletIDs = make(map[int]string)
+		}
+		u.WalletIDs[i] = wl.ID
+	}
+	writeJSON(w, http.StatusCreated, u)
+}
+
+func (s *Server) handleAssets(w http.ResponseWriter, r *request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "Method not allowed.")
+		return
+	}
+	if len(r.segments) == 1 {
+		items := make([]interface{}, len(s.assets))
+		for i, a := range s.assets {
+			items[i] = a
+		}
+		s.paginate(w, r, items)
+		return
+	}
+	a := s.asset(r.segments[1])
+	if a == nil {
+		writeError(w, http.StatusNotFound, "Not found.")
+		return
+	}
+	writeJSON(w, http.StatusOK, a)
+}
+
+type webhook struct {
+	ID            string            `json:"id"`
+	URL           string            `json:"url"`
+	Name          string            `json:"name"`
+	HMACSecretKey string            `json:"hmac_secret_key"`
+	Headers       map[string]string `json:"headers"`
+	Version       string            `json:"version"`
+	Status        string            `json:"status"`
+	EventFilters  []string          `json:"event_filters"`
+}
+
+func (s *Server) handleWebhooks(w http.ResponseWriter, r *request) {
+	if len(r.segments) == 2 && r.segments[1] == "webhooks-verify" {
+		s.verifyWebhook(w, r)
+		return
+	}
+	if r.segments[1] != "webhooks" {
+		writeError(w, http.StatusNotFound, "Not found.")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(r.segments) == 2 {
+		switch r.Method {
+		case http.MethodGet:
+			items := make([]interface{}, 0, len(s.webhookOrder))
+			for _, id := range s.webhookOrder {
+				items = append(items, s.webhooks[id])
+			}
+			s.paginate(w, r, items)
+		case http.MethodPost:
+			wh := &webhook{}
+			if err := r.decode(wh); err != nil {
+				writeError(w, http.StatusBadRequest, "invalid JSON: %v", err)
+				return
+			}
+			if wh.URL == "" || wh.Name == "" {
+				writeJSON(w, http.StatusBadRequest, map[string][]string{"url": {"This field is required."}})
+				return
+			}
+			wh.ID = uuid.New().String()
+			if wh.Status == "" {
+				wh.Status = "ACTIVE"
+			}
+			s.webhooks[wh.ID] = wh
+			s.webhookOrder = append(s.webhookOrder, wh.ID)
+			writeJSON(w, http.StatusCreated, wh)
+		default:
+			writeError(w, http.StatusMethodNotAllowed, "Method not allowed.")
+		}
+		return
+	}
+
+	wh, ok := s.webhooks[r.segments[2]]
+	if !ok {
+		writeError(w, http.StatusNotFound, "Not found.")
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, wh)
+	case http.MethodPut:
+		updated := &webhook{}
+		if err := r.decode(updated); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid JSON: %v", err)
+			return
+		}
+		if updated.URL == "" || updated.Name == "" {
+			writeJSON(w, http.StatusBadRequest, map[string][]string{"url": {"This field is required."}})
+			return
+		}
+		updated.ID = wh.ID
+		if updated.Status == "" {
+			updated.Status = wh.Status
+		}
+		s.webhooks[wh.ID] = updated
+		writeJSON(w, http.StatusOK, updated)
+	case http.MethodPatch:
+		// decoding onto the stored webhook only changes the fields in the body
+		id := wh.ID
+		if err := r.decode(wh); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid JSON: %v", err)
+			return
+		}
+		wh.ID = id
+		writeJSON(w, http.StatusOK, wh)
+	case http.MethodDelete:
+		delete(s.webhooks, wh.ID)
+		s.webhookOrder = remove(s.webhookOrder, wh.ID)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "Method not allowed.")
+	}
+}
+
+// verifyWebhook checks that the URL to verify answers a challenge with a
+// success status and the same challenge.
+func (s *Server) verifyWebhook(w http.ResponseWriter, r *request) {
+	var params struct {
+		VerifyURL string `json:"verify_url"`
+	}
+	if err := r.decode(&params); err != nil || params.VerifyURL == "" {
+		writeError(w, http.StatusBadRequest, "verify_url is required")
+		return
+	}
+
+	challenge := randomHex(16)
+	body, _ := json.Marshal(map[string]string{"challenge": challenge})
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Post(params.VerifyURL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "webhook URL could not be reached: %v", err)
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		writeError(w, http.StatusBadRequest, "webhook URL responded with status %s", strconv.Itoa(resp.StatusCode))
+		return
+	}
+	var answer struct {
+		Challenge string `json:"challenge"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&answer); err != nil || answer.Challenge != challenge {
+		writeError(w, http.StatusBadRequest, "webhook URL did not answer the verification challenge")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": fmt.Sprintf("verified %s", params.VerifyURL)})
+}
+
+func remove(ids []string, id string) []string {
+	for i, v := range ids {
+		if v == id {
+			return append(ids[:i:i], ids[i+1:]...)
+		}
+	}
+	return ids
+}
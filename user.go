@@ -1,12 +1,9 @@
 package upvest
 
 import (
+	"context"
 	"fmt"
 	"net/http"
-	"net/url"
-	"strconv"
-
-	"github.com/pkg/errors"
 )
 
 // UserService handles operations related to the user
@@ -40,6 +37,11 @@ type ChangePasswordParams struct {
 // Create creates a new user
 // For more details https://doc.upvest.co/reference#tenancy_user_create
 func (s *UserService) Create(username, password string, assetIDs []string) (*User, error) {
+	return s.CreateContext(context.Background(), username, password, assetIDs)
+}
+
+// CreateContext is like Create but takes a context.
+func (s *UserService) CreateContext(ctx context.Context, username, password string, assetIDs []string) (*User, error) {
 	u := "/tenancy/users/"
 	usr := &User{}
 	data := map[string]interface{}{
@@ -49,116 +51,111 @@ func (s *UserService) Create(username, password string, assetIDs []string) (*Use
 	}
 	p := &Params{}
 	p.SetAuthProvider(s.auth)
-	err := s.client.Call(http.MethodPost, u, data, usr, p)
+	err := s.client.CallContext(ctx, http.MethodPost, u, data, usr, p)
 	return usr, err
 }
 
 // ChangePassword changes user password with the provided password
 // For more details https://doc.upvest.co/reference#tenancy_user_password_update
 func (s *UserService) ChangePassword(username string, params *ChangePasswordParams) (*User, error) {
+	return s.ChangePasswordContext(context.Background(), username, params)
+}
+
+// ChangePasswordContext is like ChangePassword but takes a context.
+func (s *UserService) ChangePasswordContext(ctx context.Context, username string, params *ChangePasswordParams) (*User, error) {
 	u := fmt.Sprintf("/tenancy/users/%s", username)
 	usr := &User{}
 	p := &Params{}
 	p.SetAuthProvider(s.auth)
-	err := s.client.Call(http.MethodPatch, u, params, usr, p)
+	err := s.client.CallContext(ctx, http.MethodPatch, u, params, usr, p)
 	return usr, err
 }
 
 // Delete permanently deletes a user
 // For more details https://doc.upvest.co/reference#tenancy_user_create
 func (s *UserService) Delete(username string) error {
+	return s.DeleteContext(context.Background(), username)
+}
+
+// DeleteContext is like Delete but takes a context.
+func (s *UserService) DeleteContext(ctx context.Context, username string) error {
 	u := fmt.Sprintf("/tenancy/users/%s", username)
 	resp := &Response{}
 	p := &Params{}
 	p.SetAuthProvider(s.auth)
-	err := s.client.Call(http.MethodDelete, u, map[string]string{}, resp, p)
+	err := s.client.CallContext(ctx, http.MethodDelete, u, map[string]string{}, resp, p)
 	return err
 }
 
 // Get returns the details of a user.
 // For more details see
 func (s *UserService) Get(username string) (*User, error) {
+	return s.GetContext(context.Background(), username)
+}
+
+// GetContext is like Get but takes a context.
+func (s *UserService) GetContext(ctx context.Context, username string) (*User, error) {
 	u := fmt.Sprintf("/tenancy/users/%s", username)
 	user := &User{}
 	p := &Params{}
 	p.SetAuthProvider(s.auth)
-	err := s.client.Call(http.MethodGet, u, nil, user, p)
+	err := s.client.CallContext(ctx, http.MethodGet, u, nil, user, p)
 	return user, err
 }
 
 // List returns list of all users.
 // For more details see https://doc.upvest.co/reference#tenancy_user_list
 func (s *UserService) List() (*UserList, error) {
-	path := "/tenancy/users/"
-	u, _ := url.Parse(path)
-	//q := u.Query()
-	//q.Set("page_size", fmt.Sprintf("%d", maxPageSize))
-	//u.RawQuery = q.Encode()
-
-	p := &Params{}
-	p.SetAuthProvider(s.auth)
-	var results []User
-	users := &UserList{}
-
-	for {
-		err := s.client.Call(http.MethodGet, u.String(), nil, users, p)
-		if err != nil {
-			return nil, errors.Wrap(err, "Could not retrieve list of users")
-		}
-		results = append(results, users.Values...)
-
-		// append page_size param to the returned params
-		u1, err := url.Parse(users.Meta.Next)
-		if err != nil {
-			return nil, errors.Wrap(err, "Can not parse url")
-		}
-		q := u1.Query()
-		q.Set("page_size", strconv.Itoa(MaxPageSize))
-		u.RawQuery = q.Encode()
-		if users.Meta.Next == "" {
-			break
-		}
-	}
+	return s.ListContext(context.Background())
+}
 
-	return &UserList{Values: results}, nil
+// ListContext is like List but takes a context.
+func (s *UserService) ListContext(ctx context.Context) (*UserList, error) {
+	return s.list(s.Iter(ctx, nil))
 }
 
 // ListN returns a specific number of users
 // For more details see https://doc.upvest.co/reference#tenancy_user_list
 func (s *UserService) ListN(count int) (*UserList, error) {
+	return s.ListNContext(context.Background(), count)
+}
+
+// ListNContext is like ListN but takes a context.
+func (s *UserService) ListNContext(ctx context.Context, count int) (*UserList, error) {
+	if count <= 0 {
+		return &UserList{}, nil
+	}
+	return s.list(s.Iter(ctx, &ListOptions{Limit: count}))
+}
+
+// UserIter is an iterator over users.
+type UserIter struct {
+	*Iter
+}
+
+// Value returns the user at the current position
+func (it *UserIter) Value() *User {
+	return it.Current().(*User)
+}
+
+// Iter returns an iterator over users, fetching pages as they are needed.
+func (s *UserService) Iter(ctx context.Context, opts *ListOptions) *UserIter {
 	path := "/tenancy/users/"
-	u, _ := url.Parse(path)
-	// q := u.Query()
-	// q.Set("page_size", fmt.Sprintf("%d", maxPageSize))
-	// u.RawQuery = q.Encode()
+	return &UserIter{s.newIter(ctx, path, opts, func(v interface{}) (interface{}, error) {
+		user := &User{}
+		err := mapstruct(v, user)
+		return user, err
+	})}
+}
 
-	p := &Params{}
-	p.SetAuthProvider(s.auth)
+// list collects the users of the iterator.
+func (s *UserService) list(it *UserIter) (*UserList, error) {
 	var results []User
-	users := &UserList{}
-
-	total := 0
-
-	for total <= count {
-		err := s.client.Call(http.MethodGet, u.String(), nil, users, p)
-		if err != nil {
-			return nil, errors.Wrap(err, "Could not retrieve list of users")
-		}
-		results = append(results, users.Values...)
-		total += len(users.Values)
-
-		// append page_size param to the returned params
-		u1, err := url.Parse(users.Meta.Next)
-		if err != nil {
-			return nil, errors.Wrap(err, "Can not parse url")
-		}
-		q := u1.Query()
-		q.Set("page_size", strconv.Itoa(MaxPageSize))
-		u.RawQuery = q.Encode()
-		if users.Meta.Next == "" {
-			break
-		}
+	for it.Next() {
+		results = append(results, *it.Value())
+	}
+	if err := it.Err(); err != nil {
+		return nil, fmt.Errorf("Could not retrieve list of users: %w", err)
 	}
-
 	return &UserList{Values: results}, nil
 }
@@ -5,9 +5,12 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"math/rand"
 	"net/url"
+	"os"
 	"path"
+	"path/filepath"
 	"reflect"
 	"strings"
 	"time"
@@ -21,6 +24,7 @@ func mapstruct(data interface{}, v interface{}) error {
 		Result:           v,
 		TagName:          "json",
 		WeaklyTypedInput: true,
+		DecodeHook:       mapstructure.ComposeDecodeHookFunc(decodeEventFilter, decodeAmount, decodeUntypedNumber),
 	}
 	decoder, err := mapstructure.NewDecoder(config)
 	if err != nil {
@@ -30,6 +34,40 @@ func mapstruct(data interface{}, v interface{}) error {
 	return err
 }
 
+// decodeUntypedNumber turns the json.Number values of a response into
+// float64 where they are decoded into untyped values, as encoding/json would.
+// Typed fields, such as amounts, are decoded from the exact json.Number.
+func decodeUntypedNumber(from, to reflect.Type, data interface{}) (interface{}, error) {
+	if to.Kind() != reflect.Interface {
+		return data, nil
+	}
+	return untypedNumbers(data), nil
+}
+
+// untypedNumbers returns v with its json.Number values, also those nested in
+// maps and slices, converted to float64.
+func untypedNumbers(v interface{}) interface{} {
+	switch v := v.(type) {
+	case json.Number:
+		if f, err := v.Float64(); err == nil {
+			return f
+		}
+	case map[string]interface{}:
+		copied := make(map[string]interface{}, len(v))
+		for k, e := range v {
+			copied[k] = untypedNumbers(e)
+		}
+		return copied
+	case []interface{}:
+		copied := make([]interface{}, len(v))
+		for i, e := range v {
+			copied[i] = untypedNumbers(e)
+		}
+		return copied
+	}
+	return v
+}
+
 func jsonEncode(data interface{}) (io.ReadWriter, error) {
 	var buf io.ReadWriter
 	buf = new(bytes.Buffer)
@@ -37,6 +75,8 @@ func jsonEncode(data interface{}) (io.ReadWriter, error) {
 	return buf, err
 }
 
+// joinURLs appends paths to basePath. A query string on the last path is
+// kept as the query of the resulting URL.
 func joinURLs(basePath string, paths ...string) (*url.URL, error) {
 	u, err := url.Parse(basePath)
 
@@ -45,6 +85,11 @@ func joinURLs(basePath string, paths ...string) (*url.URL, error) {
 	}
 
 	p2 := append([]string{u.Path}, paths...)
+	if last := p2[len(p2)-1]; strings.Contains(last, "?") {
+		parts := strings.SplitN(last, "?", 2)
+		p2[len(p2)-1] = parts[0]
+		u.RawQuery = parts[1]
+	}
 
 	result := joinPreservingTrailingSlash(p2...)
 
@@ -107,3 +152,26 @@ func addOptions(s string, opt interface{}) (string, error) {
 	u.RawQuery = qs.Encode()
 	return u.String(), nil
 }
+
+// writeFileAtomic writes data to the file name in dir by way of a temporary
+// file, so that concurrent readers never observe a partially written file.
+func writeFileAtomic(dir, name string, data []byte) error {
+	f, err := ioutil.TempFile(dir, "."+name+"-")
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	if err := os.Rename(f.Name(), filepath.Join(dir, name)); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return nil
+}
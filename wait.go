@@ -0,0 +1,301 @@
+package upvest
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+)
+
+// TransactionState is the final state of a submitted transaction
+type TransactionState string
+
+// Final states of a transaction reported by WaitForTransaction
+const (
+	// TransactionConfirmed means the transaction was mined and has the
+	// requested number of confirmations.
+	TransactionConfirmed TransactionState = "confirmed"
+	// TransactionFailed means Upvest reported the transaction as failed.
+	TransactionFailed TransactionState = "failed"
+	// TransactionDropped means the transaction was not mined in time.
+	TransactionDropped TransactionState = "dropped"
+	// TransactionReplaced means another transaction with the same sender
+	// and nonce was mined instead.
+	TransactionReplaced TransactionState = "replaced"
+)
+
+const (
+	// DefaultWaitPollInterval is the delay before WaitForTransaction polls again
+	DefaultWaitPollInterval = 2 * time.Second
+	// DefaultWaitMaxPollInterval is the longest delay between two polls of WaitForTransaction
+	DefaultWaitMaxPollInterval = 30 * time.Second
+)
+
+// WaitOptions configures WaitForTransaction
+type WaitOptions struct {
+	// Confirmations is the number of blocks, including the transaction's
+	// own, to wait for. A zero value means 1. Waiting for more than one
+	// confirmation needs Historical or Receiver.
+	Confirmations int
+
+	// Historical, if set, is used to track the confirmations of the mined
+	// transaction and to detect replacements. The historical data API is
+	// part of the tenancy API.
+	Historical *HistoricalDataService
+
+	// Receiver, if set, makes the wait react to transaction webhook events
+	// instead of waiting for the next poll.
+	Receiver *WebhookReceiver
+
+	// PollInterval is the delay before the second poll. Every further poll
+	// waits twice as long, up to MaxPollInterval. Zero values mean
+	// DefaultWaitPollInterval and DefaultWaitMaxPollInterval.
+	PollInterval    time.Duration
+	MaxPollInterval time.Duration
+
+	// DropAfter, if positive, is how long the transaction may stay unmined
+	// before it is reported as dropped.
+	DropAfter time.Duration
+}
+
+// TransactionOutcome is the final state of a transaction
+type TransactionOutcome struct {
+	State       TransactionState
+	Transaction *Transaction
+	// Mined is the transaction as seen by the historical data API, if it
+	// was mined and WaitOptions.Historical was set.
+	Mined *HDTransaction
+	// Confirmations is the number of confirmations the transaction had
+	// when the wait ended.
+	Confirmations int
+	// ReplacedBy is the hash of the transaction mined in place of this one.
+	ReplacedBy string
+}
+
+// WaitForTransaction waits until a submitted transaction is confirmed,
+// failed, dropped or replaced, polling the transaction with backoff. It
+// returns an error if ctx is done or polling fails first.
+//
+// Usage:
+//
+//	txn, err := clientele.Transaction.Create(walletID, tp)
+//	outcome, err := clientele.Transaction.WaitForTransaction(ctx, walletID, txn.ID, &upvest.WaitOptions{
+//		Confirmations: 12,
+//		Historical:    tenancy.Historical,
+//	})
+func (s *TransactionService) WaitForTransaction(ctx context.Context, walletID, txID string, opts *WaitOptions) (*TransactionOutcome, error) {
+	if opts == nil {
+		opts = &WaitOptions{}
+	}
+	w := &txWaiter{s: s, opts: opts, walletID: walletID, txID: txID, target: opts.Confirmations}
+	if w.target < 1 {
+		w.target = 1
+	}
+	if w.target > 1 && opts.Historical == nil && opts.Receiver == nil {
+		return nil, errors.New("waiting for more than one confirmation needs historical data or a webhook receiver")
+	}
+	if opts.Historical != nil {
+		wallet, err := (&WalletService{s.service}).GetContext(ctx, walletID)
+		if err != nil {
+			return nil, err
+		}
+		w.protocol, w.network = splitProtocol(wallet.Protocol)
+	}
+	var events <-chan *Event
+	if opts.Receiver != nil {
+		var cancel func()
+		events, cancel = opts.Receiver.subscribe()
+		defer cancel()
+	}
+
+	delay := opts.PollInterval
+	if delay <= 0 {
+		delay = DefaultWaitPollInterval
+	}
+	maxDelay := opts.MaxPollInterval
+	if maxDelay <= 0 {
+		maxDelay = DefaultWaitMaxPollInterval
+	}
+	start := time.Now()
+	for {
+		outcome, err := w.poll(ctx)
+		if err != nil || outcome != nil {
+			return outcome, err
+		}
+		if opts.DropAfter > 0 && !w.mined && time.Since(start) > opts.DropAfter {
+			return &TransactionOutcome{State: TransactionDropped, Transaction: w.txn}, nil
+		}
+		if err := w.wait(ctx, delay, events); err != nil {
+			return nil, err
+		}
+		if delay *= 2; delay > maxDelay {
+			delay = maxDelay
+		}
+	}
+}
+
+// splitProtocol splits a wallet protocol such as "ethereum_ropsten" into the
+// protocol and network of the historical data API.
+func splitProtocol(name string) (protocol, network string) {
+	if i := strings.Index(name, "_"); i >= 0 {
+		return name[:i], name[i+1:]
+	}
+	return name, "mainnet"
+}
+
+// txWaiter keeps track of a transaction between the polls of WaitForTransaction.
+type txWaiter struct {
+	s        *TransactionService
+	opts     *WaitOptions
+	walletID string
+	txID     string
+	target   int
+
+	protocol string
+	network  string
+
+	txn    *Transaction
+	mined  bool
+	sender string
+	nonce  string
+	// cursor is where the search for a replacement resumes on the next
+	// poll, so that each poll only reads the sender's newly mined
+	// transactions.
+	cursor string
+	// confirmations is the highest number of confirmations reported by
+	// webhook events.
+	confirmations int
+}
+
+// wait waits for the delay to pass or for a webhook event about the
+// transaction, whichever comes first.
+func (w *txWaiter) wait(ctx context.Context, delay time.Duration, events <-chan *Event) error {
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-timer.C:
+			return nil
+		case e := <-events:
+			if w.event(e) {
+				return nil
+			}
+		}
+	}
+}
+
+// event reports whether a webhook event is about the transaction, recording
+// the confirmations it reports.
+func (w *txWaiter) event(e *Event) bool {
+	if e.EventNoun != EventNounTransaction {
+		return false
+	}
+	typed, err := DecodeEvent(e)
+	if err != nil {
+		return false
+	}
+	te := typed.(*TransactionEvent)
+	if te.Transaction.ID != w.txID && (w.txn == nil || !strings.EqualFold(te.Transaction.TxHash, w.txn.TxHash)) {
+		return false
+	}
+	if e.EventVerb == EventVerbConfirmed && te.Confirmations > w.confirmations {
+		w.confirmations = te.Confirmations
+	}
+	return true
+}
+
+// poll fetches the transaction and returns its outcome if it reached a
+// final state.
+func (w *txWaiter) poll(ctx context.Context) (*TransactionOutcome, error) {
+	txn, err := w.s.GetContext(ctx, w.walletID, w.txID)
+	if err != nil {
+		return nil, err
+	}
+	w.txn = txn
+	outcome := &TransactionOutcome{Transaction: txn, Confirmations: w.confirmations}
+	switch strings.ToUpper(txn.Status) {
+	case "FAILED":
+		outcome.State = TransactionFailed
+		return outcome, nil
+	case "DROPPED":
+		outcome.State = TransactionDropped
+		return outcome, nil
+	case "REPLACED":
+		outcome.State = TransactionReplaced
+		return outcome, nil
+	case "CONFIRMED":
+		if outcome.Confirmations < 1 {
+			outcome.Confirmations = 1
+		}
+	}
+
+	if w.opts.Historical == nil {
+		if outcome.Confirmations >= w.target {
+			outcome.State = TransactionConfirmed
+			return outcome, nil
+		}
+		return nil, nil
+	}
+
+	if txn.TxHash == "" {
+		// not broadcast yet, so there is nothing to look up
+		return nil, nil
+	}
+	hd, err := w.opts.Historical.GetTxByHashContext(ctx, w.protocol, w.network, txn.TxHash)
+	if errors.Is(err, ErrNotFound) {
+		hd, err = nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	w.mined = hd != nil && hd.BlockNumber != ""
+	if hd != nil && hd.Nonce != "" {
+		w.nonce, w.sender = hd.Nonce, hd.From
+	}
+	if w.mined {
+		outcome.Mined = hd
+		outcome.Confirmations = hd.Confirmations
+		if hd.Confirmations >= w.target {
+			outcome.State = TransactionConfirmed
+			return outcome, nil
+		}
+		return nil, nil
+	}
+	return w.replaced(ctx, outcome)
+}
+
+// replaced looks for a mined transaction of the sender with the nonce of the
+// unmined transaction. The sender's transactions are listed in the order
+// they were mined, so the search resumes where the previous poll stopped,
+// re-reading only the last page.
+func (w *txWaiter) replaced(ctx context.Context, outcome *TransactionOutcome) (*TransactionOutcome, error) {
+	if w.nonce == "" {
+		return nil, nil
+	}
+	sender := w.sender
+	if sender == "" {
+		sender = w.txn.Sender
+	}
+	filters := &TxFilters{Cursor: w.cursor}
+	for {
+		list, err := w.opts.Historical.GetTransactionsContext(ctx, w.protocol, w.network, sender, filters)
+		if err != nil {
+			return nil, err
+		}
+		for _, t := range list.Values {
+			if t.Nonce == w.nonce && t.BlockNumber != "" && strings.EqualFold(t.From, sender) &&
+				!strings.EqualFold(t.Hash, w.txn.TxHash) {
+				outcome.State = TransactionReplaced
+				outcome.ReplacedBy = t.Hash
+				return outcome, nil
+			}
+		}
+		if list.NextCursor == "" || len(list.Values) == 0 {
+			w.cursor = filters.Cursor
+			return nil, nil
+		}
+		filters.Cursor = list.NextCursor
+	}
+}
@@ -1,12 +1,9 @@
 package upvest
 
 import (
+	"context"
 	"fmt"
 	"net/http"
-	"net/url"
-	"strconv"
-
-	"github.com/pkg/errors"
 )
 
 // Wallet represents an Upvest wallet
@@ -22,7 +19,7 @@ type Wallet struct {
 
 // Balance has a quantity and an asset
 type Balance struct {
-	Amount   int64  `json:"amount"`
+	Amount   Amount `json:"amount"`
 	AssetID  string `json:"asset_id"`
 	Name     string `json:"name"`
 	Symbol   string `json:"symbol"`
@@ -93,106 +90,104 @@ type Signature struct {
 // Sign signs (the hash of) data with the private key corresponding to this wallet.
 // For more details, see https://doc.upvest.co/reference#kms_sign
 func (s *WalletService) Sign(walletID string, sp *SignatureParams) (*Signature, error) {
+	return s.SignContext(context.Background(), walletID, sp)
+}
+
+// SignContext is like Sign but takes a context.
+func (s *WalletService) SignContext(ctx context.Context, walletID string, sp *SignatureParams) (*Signature, error) {
 	u := fmt.Sprintf("/kms/wallets/%s/sign", walletID)
 	sig := &Signature{}
 	p := &Params{}
 	p.SetAuthProvider(s.auth)
-	err := s.client.Call(http.MethodPost, u, sp, sig, p)
+	err := s.client.CallContext(ctx, http.MethodPost, u, sp, sig, p)
 	return sig, err
 }
 
 // Create creates a new wallet
 // For more details https://doc.upvest.co/reference#kms_wallet_create
 func (s *WalletService) Create(wp *WalletParams) (*Wallet, error) {
+	return s.CreateContext(context.Background(), wp)
+}
+
+// CreateContext is like Create but takes a context.
+func (s *WalletService) CreateContext(ctx context.Context, wp *WalletParams) (*Wallet, error) {
 	u := "/kms/wallets/"
 	wallet := &Wallet{}
 	p := &Params{}
 	p.SetAuthProvider(s.auth)
-	err := s.client.Call(http.MethodPost, u, wp, wallet, p)
+	err := s.client.CallContext(ctx, http.MethodPost, u, wp, wallet, p)
 	return wallet, err
 }
 
 // Get returns the details of a wallet.
 // For more details see https://doc.upvest.co/reference#kms_wallets_read
 func (s *WalletService) Get(walletID string) (*Wallet, error) {
+	return s.GetContext(context.Background(), walletID)
+}
+
+// GetContext is like Get but takes a context.
+func (s *WalletService) GetContext(ctx context.Context, walletID string) (*Wallet, error) {
 	u := fmt.Sprintf("/kms/wallets/%s", walletID)
 	wallet := &Wallet{}
 	p := &Params{}
 	p.SetAuthProvider(s.auth)
-	err := s.client.Call(http.MethodGet, u, nil, wallet, p)
+	err := s.client.CallContext(ctx, http.MethodGet, u, nil, wallet, p)
 	return wallet, err
 }
 
 // List returns list of all wallets.
 // For more details see https://doc.upvest.co/reference#wallet
 func (s *WalletService) List() (*WalletList, error) {
-	path := "/kms/wallets/"
-	u, _ := url.Parse(path)
-	p := &Params{}
-	p.SetAuthProvider(s.auth)
-
-	var results []Wallet
-	wallets := &WalletList{}
-
-	for {
-		err := s.client.Call(http.MethodGet, u.String(), nil, wallets, p)
-		if err != nil {
-			return nil, errors.Wrap(err, "Could not retrieve list of wallets")
-		}
-		results = append(results, wallets.Values...)
-
-		// append page_size param to the returned params
-		u1, err := url.Parse(wallets.Meta.Next)
-		if err != nil {
-			return nil, errors.Wrap(err, "Can not parse url")
-		}
-		q := u1.Query()
-		q.Set("page_size", strconv.Itoa(MaxPageSize))
-		u.RawQuery = q.Encode()
-		if wallets.Meta.Next == "" {
-			break
-		}
-	}
+	return s.ListContext(context.Background())
+}
 
-	return &WalletList{Values: results}, nil
+// ListContext is like List but takes a context.
+func (s *WalletService) ListContext(ctx context.Context) (*WalletList, error) {
+	return s.list(s.Iter(ctx, nil))
 }
 
 // ListN returns a specific number of wallets
 // For more details see https://doc.upvest.co/reference#tenancy_wallet_list
 func (s *WalletService) ListN(count int) (*WalletList, error) {
+	return s.ListNContext(context.Background(), count)
+}
+
+// ListNContext is like ListN but takes a context.
+func (s *WalletService) ListNContext(ctx context.Context, count int) (*WalletList, error) {
+	if count <= 0 {
+		return &WalletList{}, nil
+	}
+	return s.list(s.Iter(ctx, &ListOptions{Limit: count}))
+}
+
+// WalletIter is an iterator over wallets.
+type WalletIter struct {
+	*Iter
+}
+
+// Value returns the wallet at the current position
+func (it *WalletIter) Value() *Wallet {
+	return it.Current().(*Wallet)
+}
+
+// Iter returns an iterator over wallets, fetching pages as they are needed.
+func (s *WalletService) Iter(ctx context.Context, opts *ListOptions) *WalletIter {
 	path := "/kms/wallets/"
-	u, _ := url.Parse(path)
-	// q := u.Query()
-	// q.Set("page_size", fmt.Sprintf("%d", maxPageSize))
-	// u.RawQuery = q.Encode()
+	return &WalletIter{s.newIter(ctx, path, opts, func(v interface{}) (interface{}, error) {
+		wallet := &Wallet{}
+		err := mapstruct(v, wallet)
+		return wallet, err
+	})}
+}
 
-	p := &Params{}
-	p.SetAuthProvider(s.auth)
+// list collects the wallets of the iterator.
+func (s *WalletService) list(it *WalletIter) (*WalletList, error) {
 	var results []Wallet
-	wallets := &WalletList{}
-
-	total := 0
-
-	for total <= count {
-		err := s.client.Call(http.MethodGet, u.String(), nil, wallets, p)
-		if err != nil {
-			return nil, errors.Wrap(err, "Could not retrieve list of wallets")
-		}
-		results = append(results, wallets.Values...)
-		total += len(wallets.Values)
-
-		// append page_size param to the returned params
-		u1, err := url.Parse(wallets.Meta.Next)
-		if err != nil {
-			return nil, errors.Wrap(err, "Can not parse url")
-		}
-		q := u1.Query()
-		q.Set("page_size", strconv.Itoa(MaxPageSize))
-		u.RawQuery = q.Encode()
-		if wallets.Meta.Next == "" {
-			break
-		}
+	for it.Next() {
+		results = append(results, *it.Value())
+	}
+	if err := it.Err(); err != nil {
+		return nil, fmt.Errorf("Could not retrieve list of wallets: %w", err)
 	}
-
 	return &WalletList{Values: results}, nil
 }
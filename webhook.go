@@ -1,12 +1,18 @@
 package upvest
 
 import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"fmt"
 	"net/http"
-	"net/url"
-	"strconv"
+	"time"
+)
 
-	"github.com/pkg/errors"
+// Webhook statuses
+const (
+	WebhookStatusActive   = "ACTIVE"
+	WebhookStatusInactive = "INACTIVE"
 )
 
 // Webhook represents an Upvest webhook
@@ -18,10 +24,9 @@ type Webhook struct {
 	Headers       map[string]string `json:"headers"`
 	Version       string            `json:"version"`
 	Status        string            `json:"status"`
-	//EventFilters  []map[string]EventFilter `json:"event_filters"`
-	// TODO: report inconsistent response schema. event filters should be: [string -> map]
-	// temporarily decode to generic interface
-	EventFilters []interface{} `json:"event_filters"`
+	// EventFilters are decoded from any of the shapes the server returns
+	// them in, see decodeEventFilter.
+	EventFilters []EventFilter `json:"event_filters"`
 }
 
 // EventFilterScope represents one of the configured event filter scopes
@@ -33,8 +38,10 @@ type EventFilter struct {
 	EventVerb          string `json:"event_verb"`
 	LimitToApplication bool   `json:"limit_to_application"`
 	MaxConfirmations   int    `json:"max_confirmations"`
-	ProtocolName       string `json:"procol_name"`
+	ProtocolName       string `json:"protocol_name"`
 	WalletAddress      string `json:"wallet_address"`
+	// Scope is the scope the filter was created from, if the server returned it.
+	Scope EventFilterScope `json:"scope,omitempty"`
 }
 
 // WebhookParams is the set of parameters that can be used when creating a webhook
@@ -49,6 +56,18 @@ type WebhookParams struct {
 	EventFilters []EventFilterScope `json:"event_filters"`
 }
 
+// WebhookPatchParams is the set of parameters that can be changed on an
+// existing webhook. Zero fields are left unchanged.
+type WebhookPatchParams struct {
+	URL           string             `json:"url,omitempty"`
+	Name          string             `json:"name,omitempty"`
+	HMACSecretKey string             `json:"hmac_secret_key,omitempty"`
+	Headers       map[string]string  `json:"headers,omitempty"`
+	Version       string             `json:"version,omitempty"`
+	Status        string             `json:"status,omitempty"`
+	EventFilters  []EventFilterScope `json:"event_filters,omitempty"`
+}
+
 // WebhookService handles operations related to the webhook
 type WebhookService struct {
 	service
@@ -64,108 +83,299 @@ type WebhookList struct {
 // Unlike other resource enndpoints, we can use the same webhook struct to create a new one
 // as the parameters required to create a new one is basically all the fields in the webhook struct.
 // Only difference being that it has not yet been saved on Upvest backend
-// TODO: validate params
+// The event filter scopes are validated before the webhook is sent.
 func (s *WebhookService) Create(wh *WebhookParams) (*Webhook, error) {
+	return s.CreateContext(context.Background(), wh)
+}
+
+// CreateContext is like Create but takes a context.
+func (s *WebhookService) CreateContext(ctx context.Context, wh *WebhookParams) (*Webhook, error) {
+	if err := validateScopes(wh.EventFilters); err != nil {
+		return nil, err
+	}
 	u := "/tenancy/webhooks/"
 	webhook := &Webhook{}
 	p := NewParams(s.auth)
-	err := s.client.Call(http.MethodPost, u, wh, webhook, p)
+	err := s.client.CallContext(ctx, http.MethodPost, u, wh, webhook, p)
 	return webhook, err
 }
 
-// Get retrives and returns a webhook object.
-func (s *WebhookService) Get(webhookID string) (*Webhook, error) {
+// Update replaces all fields of a webhook with those of wh
+func (s *WebhookService) Update(webhookID string, wh *WebhookParams) (*Webhook, error) {
+	return s.UpdateContext(context.Background(), webhookID, wh)
+}
+
+// UpdateContext is like Update but takes a context.
+func (s *WebhookService) UpdateContext(ctx context.Context, webhookID string, wh *WebhookParams) (*Webhook, error) {
+	if err := validateScopes(wh.EventFilters); err != nil {
+		return nil, err
+	}
 	u := fmt.Sprintf("/tenancy/webhooks/%s", webhookID)
 	webhook := &Webhook{}
 	p := NewParams(s.auth)
-	err := s.client.Call(http.MethodGet, u, nil, webhook, p)
+	err := s.client.CallContext(ctx, http.MethodPut, u, wh, webhook, p)
 	return webhook, err
 }
 
-// List returns list of all webhooks.
-func (s *WebhookService) List() (*WebhookList, error) {
-	path := "/tenancy/webhooks/"
-	u, _ := url.Parse(path)
-	p := &Params{}
-	p.SetAuthProvider(s.auth)
+// Patch changes the fields of a webhook which are set in params
+func (s *WebhookService) Patch(webhookID string, params *WebhookPatchParams) (*Webhook, error) {
+	return s.PatchContext(context.Background(), webhookID, params)
+}
 
-	var results []Webhook
-	webhooks := &WebhookList{}
+// PatchContext is like Patch but takes a context.
+func (s *WebhookService) PatchContext(ctx context.Context, webhookID string, params *WebhookPatchParams) (*Webhook, error) {
+	if err := validateScopes(params.EventFilters); err != nil {
+		return nil, err
+	}
+	u := fmt.Sprintf("/tenancy/webhooks/%s", webhookID)
+	webhook := &Webhook{}
+	p := NewParams(s.auth)
+	err := s.client.CallContext(ctx, http.MethodPatch, u, params, webhook, p)
+	return webhook, err
+}
 
-	for {
-		err := s.client.Call(http.MethodGet, u.String(), nil, webhooks, p)
-		if err != nil {
-			return nil, errors.Wrap(err, "Could not retrieve list of webhooks")
-		}
-		results = append(results, webhooks.Values...)
+// Enable makes Upvest resume deliveries to a webhook
+func (s *WebhookService) Enable(webhookID string) (*Webhook, error) {
+	return s.EnableContext(context.Background(), webhookID)
+}
 
-		// append page_size param to the returned params
-		u1, err := url.Parse(webhooks.Meta.Next)
-		if err != nil {
-			return nil, errors.Wrap(err, "Can not parse url")
+// EnableContext is like Enable but takes a context.
+func (s *WebhookService) EnableContext(ctx context.Context, webhookID string) (*Webhook, error) {
+	return s.PatchContext(ctx, webhookID, &WebhookPatchParams{Status: WebhookStatusActive})
+}
+
+// Disable stops deliveries to a webhook without deleting it
+func (s *WebhookService) Disable(webhookID string) (*Webhook, error) {
+	return s.DisableContext(context.Background(), webhookID)
+}
+
+// DisableContext is like Disable but takes a context.
+func (s *WebhookService) DisableContext(ctx context.Context, webhookID string) (*Webhook, error) {
+	return s.PatchContext(ctx, webhookID, &WebhookPatchParams{Status: WebhookStatusInactive})
+}
+
+// SecretRotationError is returned by RotateSecret when it is unknown whether
+// the webhook was changed, e.g. because the response was lost. The receiver
+// keeps accepting both the new and the previous secrets; retry the change
+// with Patch and Secret, or check it with Get, then persist the secret.
+type SecretRotationError struct {
+	WebhookID string
+	// Secret is the new secret the webhook may have been changed to
+	Secret string
+	Err    error
+}
+
+func (e *SecretRotationError) Error() string {
+	return fmt.Sprintf("could not confirm rotation of the secret of webhook %s: %v", e.WebhookID, e.Err)
+}
+
+// Unwrap returns the error of the change
+func (e *SecretRotationError) Unwrap() error {
+	return e.Err
+}
+
+// RotateSecret replaces the HMAC secret key of a webhook with a newly
+// generated one without rejecting deliveries in between. The receiver, if
+// not nil, accepts the new secret before the webhook is changed and keeps
+// accepting its previous secrets for the grace period, after which they are
+// retired. The returned webhook carries the new secret, which should be
+// persisted. If the change may have been applied
+// but failed, a *SecretRotationError carries the new secret.
+func (s *WebhookService) RotateSecret(webhookID string, receiver *WebhookReceiver, grace time.Duration) (*Webhook, error) {
+	return s.RotateSecretContext(context.Background(), webhookID, receiver, grace)
+}
+
+// RotateSecretContext is like RotateSecret but takes a context.
+func (s *WebhookService) RotateSecretContext(ctx context.Context, webhookID string, receiver *WebhookReceiver, grace time.Duration) (*Webhook, error) {
+	secret, err := newWebhookSecret()
+	if err != nil {
+		return nil, err
+	}
+	var old []string
+	if receiver != nil {
+		old = receiver.Secrets()
+		receiver.AddSecret(secret)
+	}
+	webhook, err := s.PatchContext(ctx, webhookID, &WebhookPatchParams{HMACSecretKey: secret})
+	if err != nil {
+		if aerr, ok := asError(err); ok && aerr.StatusCode < http.StatusInternalServerError {
+			// the change was rejected, so the new secret is never used
+			if receiver != nil {
+				receiver.RetireSecret(secret)
+			}
+			return nil, fmt.Errorf("could not rotate webhook secret: %w", err)
 		}
-		q := u1.Query()
-		q.Set("page_size", strconv.Itoa(MaxPageSize))
-		u.RawQuery = q.Encode()
-		if webhooks.Meta.Next == "" {
-			break
+		return nil, &SecretRotationError{WebhookID: webhookID, Secret: secret, Err: err}
+	}
+	webhook.HMACSecretKey = secret
+
+	if receiver != nil {
+		for _, prev := range old {
+			receiver.RetireSecretAfter(prev, grace)
 		}
 	}
+	return webhook, nil
+}
 
-	return &WebhookList{Values: results}, nil
+// Get retrives and returns a webhook object.
+func (s *WebhookService) Get(webhookID string) (*Webhook, error) {
+	return s.GetContext(context.Background(), webhookID)
+}
+
+// GetContext is like Get but takes a context.
+func (s *WebhookService) GetContext(ctx context.Context, webhookID string) (*Webhook, error) {
+	u := fmt.Sprintf("/tenancy/webhooks/%s", webhookID)
+	webhook := &Webhook{}
+	p := NewParams(s.auth)
+	err := s.client.CallContext(ctx, http.MethodGet, u, nil, webhook, p)
+	return webhook, err
+}
+
+// List returns list of all webhooks.
+func (s *WebhookService) List() (*WebhookList, error) {
+	return s.ListContext(context.Background())
+}
+
+// ListContext is like List but takes a context.
+func (s *WebhookService) ListContext(ctx context.Context) (*WebhookList, error) {
+	return s.list(s.Iter(ctx, nil))
 }
 
 // ListN returns a specific number of webhooks
 func (s *WebhookService) ListN(count int) (*WebhookList, error) {
-	path := "/tenancy/webhooks/"
-	u, _ := url.Parse(path)
+	return s.ListNContext(context.Background(), count)
+}
 
-	p := &Params{}
-	p.SetAuthProvider(s.auth)
-	var results []Webhook
-	webhooks := &WebhookList{}
+// ListNContext is like ListN but takes a context.
+func (s *WebhookService) ListNContext(ctx context.Context, count int) (*WebhookList, error) {
+	if count <= 0 {
+		return &WebhookList{}, nil
+	}
+	return s.list(s.Iter(ctx, &ListOptions{Limit: count}))
+}
 
-	total := 0
+// WebhookIter is an iterator over webhooks.
+type WebhookIter struct {
+	*Iter
+}
 
-	for total <= count {
-		err := s.client.Call(http.MethodGet, u.String(), nil, webhooks, p)
-		if err != nil {
-			return nil, errors.Wrap(err, "Could not retrieve list of webhooks")
-		}
-		results = append(results, webhooks.Values...)
-		total += len(webhooks.Values)
+// Value returns the webhook at the current position
+func (it *WebhookIter) Value() *Webhook {
+	return it.Current().(*Webhook)
+}
 
-		// append page_size param to the returned params
-		u1, err := url.Parse(webhooks.Meta.Next)
-		if err != nil {
-			return nil, errors.Wrap(err, "Can not parse url")
-		}
-		q := u1.Query()
-		q.Set("page_size", strconv.Itoa(MaxPageSize))
-		u.RawQuery = q.Encode()
-		if webhooks.Meta.Next == "" {
-			break
-		}
-	}
+// Iter returns an iterator over webhooks, fetching pages as they are needed.
+func (s *WebhookService) Iter(ctx context.Context, opts *ListOptions) *WebhookIter {
+	path := "/tenancy/webhooks/"
+	return &WebhookIter{s.newIter(ctx, path, opts, func(v interface{}) (interface{}, error) {
+		webhook := &Webhook{}
+		err := mapstruct(v, webhook)
+		return webhook, err
+	})}
+}
 
+// list collects the webhooks of the iterator.
+func (s *WebhookService) list(it *WebhookIter) (*WebhookList, error) {
+	var results []Webhook
+	for it.Next() {
+		results = append(results, *it.Value())
+	}
+	if err := it.Err(); err != nil {
+		return nil, fmt.Errorf("Could not retrieve list of webhooks: %w", err)
+	}
 	return &WebhookList{Values: results}, nil
 }
 
 // Delete permanently deletes a webhook
 func (s *WebhookService) Delete(webhookID string) error {
+	return s.DeleteContext(context.Background(), webhookID)
+}
+
+// DeleteContext is like Delete but takes a context.
+func (s *WebhookService) DeleteContext(ctx context.Context, webhookID string) error {
 	u := fmt.Sprintf("/tenancy/webhooks/%s", webhookID)
 	resp := &Response{}
 	p := NewParams(s.auth)
-	err := s.client.Call(http.MethodDelete, u, map[string]string{}, resp, p)
+	err := s.client.CallContext(ctx, http.MethodDelete, u, map[string]string{}, resp, p)
 	return err
 }
 
+// WebhookVerification is the outcome of verifying a webhook URL
+type WebhookVerification struct {
+	URL string
+	// Verified reports whether Upvest reached the URL and it answered the
+	// verification challenge.
+	Verified bool
+	// StatusCode is the status code of the verification endpoint, or 0 if
+	// it could not be reached.
+	StatusCode int
+	// Latency is how long the verification took, including Upvest's request
+	// to the webhook URL.
+	Latency time.Duration
+	// Reason explains why the verification failed, as reported by Upvest if
+	// possible.
+	Reason string
+	// Err is the error the verification failed with.
+	Err error
+}
+
 // Verify a webhook
 func (s *WebhookService) Verify(url string) bool {
+	return s.VerifyContext(context.Background(), url)
+}
+
+// VerifyContext is like Verify but takes a context.
+func (s *WebhookService) VerifyContext(ctx context.Context, url string) bool {
+	return s.VerifyDetailedContext(ctx, url).Verified
+}
+
+// VerifyDetailed is like Verify but returns why the verification failed.
+// Upvest verifies a URL by sending it a challenge, see
+// WebhookVerificationHandler.
+func (s *WebhookService) VerifyDetailed(url string) *WebhookVerification {
+	return s.VerifyDetailedContext(context.Background(), url)
+}
+
+// VerifyDetailedContext is like VerifyDetailed but takes a context.
+func (s *WebhookService) VerifyDetailedContext(ctx context.Context, url string) *WebhookVerification {
 	u := "/tenancy/webhooks-verify/"
 	body := map[string]string{"verify_url": url}
 	resp := &Response{}
 	p := NewParams(s.auth)
-	err := s.client.Call(http.MethodPost, u, body, resp, p)
-	return err == nil
+	start := time.Now()
+	err := s.client.CallContext(ctx, http.MethodPost, u, body, resp, p)
+
+	v := &WebhookVerification{URL: url, Latency: time.Since(start), Err: err}
+	if err == nil {
+		v.Verified = true
+		v.StatusCode = http.StatusOK
+		return v
+	}
+	v.Reason = err.Error()
+	if aerr, ok := asError(err); ok {
+		v.StatusCode = aerr.StatusCode
+		if aerr.Message != "" {
+			v.Reason = aerr.Message
+		}
+	}
+	return v
+}
+
+// validateScopes checks the event filter scopes of a webhook before it is sent.
+func validateScopes(scopes []EventFilterScope) error {
+	for _, scope := range scopes {
+		if _, err := scope.Parse(); err != nil {
+			return fmt.Errorf("%w: %v", ErrValidation, err)
+		}
+	}
+	return nil
+}
+
+// newWebhookSecret returns a random HMAC secret key for a webhook.
+func newWebhookSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("could not generate webhook secret: %w", err)
+	}
+	return hex.EncodeToString(b), nil
 }